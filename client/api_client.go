@@ -11,6 +11,13 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
 )
 
 // APIClient TP平台API客户端
@@ -18,6 +25,8 @@ type APIClient struct {
 	baseURL    string       // API基础URL
 	httpClient *http.Client // HTTP客户端
 	logger     *log.Logger  // 日志记录器
+	metrics    metrics.Recorder
+	tracing    tracing
 }
 
 // APIClientOption 定义客户端配置选项
@@ -37,6 +46,20 @@ func WithLogger(logger *log.Logger) APIClientOption {
 	}
 }
 
+// WithMetrics 设置指标记录器选项
+func WithMetrics(recorder metrics.Recorder) APIClientOption {
+	return func(c *APIClient) {
+		c.metrics = metrics.OrNop(recorder)
+	}
+}
+
+// WithTracing 设置链路追踪选项，请求会创建客户端span并通过请求头传播链路上下文
+func WithTracing(config TracingConfig) APIClientOption {
+	return func(c *APIClient) {
+		c.tracing = newTracing(config)
+	}
+}
+
 // NewAPIClient 创建新的API客户端实例
 func NewAPIClient(baseURL string, opts ...APIClientOption) *APIClient {
 	client := &APIClient{
@@ -44,7 +67,9 @@ func NewAPIClient(baseURL string, opts ...APIClientOption) *APIClient {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		logger: log.New(log.Writer(), "[TP-SDK] ", log.LstdFlags|log.Lshortfile),
+		logger:  log.New(log.Writer(), "[TP-SDK] ", log.LstdFlags|log.Lshortfile),
+		metrics: metrics.Nop{},
+		tracing: newTracing(TracingConfig{}),
 	}
 
 	// 应用配置选项
@@ -57,7 +82,22 @@ func NewAPIClient(baseURL string, opts ...APIClientOption) *APIClient {
 }
 
 // doRequest 执行HTTP请求并处理响应
-func (c *APIClient) doRequest(ctx context.Context, method, path string, reqBody, respBody interface{}) error {
+func (c *APIClient) doRequest(ctx context.Context, method, path string, reqBody, respBody interface{}) (err error) {
+	ctx, span := c.tracing.tracer.Start(ctx, method+" "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	// 构建完整URL
 	url := fmt.Sprintf("%s%s", c.baseURL, path)
 	c.logger.Printf("准备发送请求: method=%s, url=%s", method, url)
@@ -86,17 +126,21 @@ func (c *APIClient) doRequest(ctx context.Context, method, path string, reqBody,
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("Accept", "application/json")
+	c.tracing.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	// 执行请求
 	startTime := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		c.metrics.APIRequest(method, apiEndpoint(path), 0, time.Since(startTime))
 		c.logger.Printf("请求执行失败: %v", err)
 		return fmt.Errorf("执行请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// 记录请求耗时
+	c.metrics.APIRequest(method, apiEndpoint(path), resp.StatusCode, time.Since(startTime))
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	c.logger.Printf("请求完成: 耗时=%v, 状态码=%d", time.Since(startTime), resp.StatusCode)
 
 	// 读取响应体
@@ -133,3 +177,20 @@ func (c *APIClient) Get(ctx context.Context, path string, response interface{})
 func (c *APIClient) Post(ctx context.Context, path string, request, response interface{}) error {
 	return c.doRequest(ctx, http.MethodPost, path, request, response)
 }
+
+// HealthCheck 返回平台API可达性检查函数，能收到任意HTTP响应即视为可达
+func (c *APIClient) HealthCheck() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+		if err != nil {
+			return fmt.Errorf("创建请求失败: %w", err)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("平台API不可达: %w", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+// client/api_client_test.go
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
+)
+
+// endpointRecorder 记录API请求指标的接口名称
+type endpointRecorder struct {
+	metrics.Nop
+	mu        sync.Mutex
+	endpoints []string
+}
+
+func (r *endpointRecorder) APIRequest(_, endpoint string, _ int, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints = append(r.endpoints, endpoint)
+}
+
+func TestAPIClientMetricsEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":200}`))
+	}))
+	defer srv.Close()
+	rec := &endpointRecorder{}
+	c := NewAPIClient(srv.URL, WithLogger(discardLogger), WithMetrics(rec))
+	ctx := context.Background()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{PathDeviceConfig, "device_config"},
+		{PathHeartbeat, "heartbeat"},
+		{PathServiceDevices + "?page=1", "service_devices"},
+		{"/api/v1/device/d1/custom", metrics.EndpointOther},
+		{"/api/v1/device/d2/custom", metrics.EndpointOther},
+	}
+	for _, tt := range tests {
+		if err := c.Post(ctx, tt.path, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, tt := range tests {
+		if rec.endpoints[i] != tt.want {
+			t.Errorf("路径 %s 的接口名称 = %s, 期望 %s", tt.path, rec.endpoints[i], tt.want)
+		}
+	}
+}
@@ -3,8 +3,12 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
 )
 
 // Client SDK主客户端，整合所有功能
@@ -17,6 +21,12 @@ type Client struct {
 	// MQTT客户端
 	mqtt *MQTTClient
 
+	// 设备状态管理
+	status *StatusManager
+
+	// 设备注册表
+	registry *DeviceRegistry
+
 	// 日志
 	logger *log.Logger
 }
@@ -35,6 +45,15 @@ type ClientConfig struct {
 
 	// 日志配置
 	Logger *log.Logger
+
+	// 指标记录器，为空时不记录，Prometheus 实现见 metrics/prommetrics
+	Metrics metrics.Recorder
+
+	// OpenTelemetry 链路追踪配置
+	Tracing TracingConfig
+
+	// 设备在线状态管理配置，为空时不启用设备状态管理，Client.Status() 返回 nil
+	Status *StatusConfig
 }
 
 // NewClient 创建新的SDK客户端实例
@@ -48,7 +67,7 @@ func NewClient(config ClientConfig) (*Client, error) {
 	logger.Printf("初始化SDK客户端")
 
 	// 创建API客户端
-	apiClient := NewAPIClient(config.BaseURL, WithLogger(logger))
+	apiClient := NewAPIClient(config.BaseURL, WithLogger(logger), WithMetrics(config.Metrics), WithTracing(config.Tracing))
 	if apiClient == nil {
 		return nil, fmt.Errorf("创建API客户端失败")
 	}
@@ -59,6 +78,8 @@ func NewClient(config ClientConfig) (*Client, error) {
 		ClientID: config.MQTTClientID,
 		Username: config.MQTTUsername,
 		Password: config.MQTTPassword,
+		Metrics:  config.Metrics,
+		Tracing:  config.Tracing,
 	}, logger)
 	if mqttClient == nil {
 		return nil, fmt.Errorf("创建MQTT客户端失败")
@@ -68,13 +89,18 @@ func NewClient(config ClientConfig) (*Client, error) {
 	deviceAPI := NewDeviceAPI(apiClient)
 	serviceAPI := NewServiceAPI(apiClient)
 
-	return &Client{
-		api:     apiClient,
-		device:  deviceAPI,
-		service: serviceAPI,
-		mqtt:    mqttClient,
-		logger:  logger,
-	}, nil
+	c := &Client{
+		api:      apiClient,
+		device:   deviceAPI,
+		service:  serviceAPI,
+		mqtt:     mqttClient,
+		registry: NewDeviceRegistry(deviceAPI),
+		logger:   logger,
+	}
+	if config.Status != nil {
+		c.status = NewStatusManager(mqttClient, *config.Status, logger)
+	}
+	return c, nil
 }
 
 // Connect 连接到平台
@@ -86,6 +112,9 @@ func (c *Client) Connect() error {
 		c.logger.Printf("MQTT连接失败: %v", err)
 		return fmt.Errorf("MQTT连接失败: %w", err)
 	}
+	if c.status != nil {
+		c.status.Start()
+	}
 
 	c.logger.Printf("平台连接成功")
 	return nil
@@ -106,10 +135,43 @@ func (c *Client) MQTT() *MQTTClient {
 	return c.mqtt
 }
 
+// Status 获取设备状态管理器，未配置 ClientConfig.Status 时返回 nil
+func (c *Client) Status() *StatusManager {
+	return c.status
+}
+
+// Registry 获取设备注册表
+func (c *Client) Registry() *DeviceRegistry {
+	return c.registry
+}
+
+// NewProvisioner 创建使用本客户端设备API的设备自动注册管理器
+func (c *Client) NewProvisioner(config ProvisionConfig) *Provisioner {
+	return NewProvisioner(c.device, config, c.logger)
+}
+
+// DisconnectNotifier 设备断开通知接口，handler.Handler 实现了该接口
+type DisconnectNotifier interface {
+	AddDisconnectListener(listener func(ctx context.Context, deviceID string))
+}
+
+// WatchDisconnect 平台通知设备断开时将设备标记为离线，未启用设备状态管理时不做处理
+func (c *Client) WatchDisconnect(n DisconnectNotifier) {
+	if c.status == nil {
+		return
+	}
+	n.AddDisconnectListener(c.status.HandleDisconnect)
+}
+
 // Close 关闭客户端连接
 func (c *Client) Close() {
 	c.logger.Printf("开始关闭客户端连接")
 
+	// 停止状态上报，停止前会发出尚未上报的状态
+	if c.status != nil {
+		c.status.Stop()
+	}
+
 	// 断开MQTT连接
 	if c.mqtt != nil {
 		c.mqtt.Disconnect()
@@ -117,3 +179,27 @@ func (c *Client) Close() {
 
 	c.logger.Printf("客户端连接已关闭")
 }
+
+// HealthRegistrar 健康检查注册接口，handler.Handler 实现了该接口
+type HealthRegistrar interface {
+	AddCheck(name string, check func(ctx context.Context) error)
+	AddDebugInfo(name string, info func() interface{})
+}
+
+// RegisterHealth 注册MQTT连接、平台API可达性和心跳检查以及MQTT诊断信息，
+// heartbeatMaxAge 为0时不注册心跳检查
+func (c *Client) RegisterHealth(reg HealthRegistrar, heartbeatMaxAge time.Duration) {
+	reg.AddCheck("mqtt", c.mqtt.HealthCheck())
+	reg.AddCheck("platform_api", c.api.HealthCheck())
+	if heartbeatMaxAge > 0 {
+		reg.AddCheck("heartbeat", c.service.HeartbeatCheck(heartbeatMaxAge))
+	}
+	reg.AddDebugInfo("mqtt", func() interface{} {
+		return c.mqtt.Stats()
+	})
+	if c.status != nil {
+		reg.AddDebugInfo("device_status", func() interface{} {
+			return c.status.List()
+		})
+	}
+}
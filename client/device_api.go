@@ -91,7 +91,7 @@ func (d *DeviceAPI) GetDeviceConfig(ctx context.Context, req *DeviceConfigReques
 	d.client.logger.Printf("开始获取设备配置: deviceID=%s", req.DeviceID)
 
 	var resp DeviceConfigResponse
-	err := d.client.Post(ctx, "/api/v1/plugin/device/config", req, &resp)
+	err := d.client.Post(ctx, PathDeviceConfig, req, &resp)
 	if err != nil {
 		d.client.logger.Printf("获取设备配置失败: %v", err)
 		return nil, fmt.Errorf("获取设备配置失败: %w", err)
@@ -107,7 +107,7 @@ func (d *DeviceAPI) DeviceDynamicAuth(ctx context.Context, req *DeviceDynamicAut
 	d.client.logger.Printf("开始设备动态认证: deviceNumber=%s", req.DeviceNumber)
 
 	var resp DeviceDynamicAuthResponse
-	err := d.client.Post(ctx, "/api/v1/device/auth", req, &resp)
+	err := d.client.Post(ctx, PathDeviceAuth, req, &resp)
 	if err != nil {
 		d.client.logger.Printf("设备动态认证失败: %v", err)
 		return nil, fmt.Errorf("设备动态认证失败: %w", err)
@@ -119,7 +119,7 @@ func (d *DeviceAPI) DeviceDynamicAuth(ctx context.Context, req *DeviceDynamicAut
 // GetDeviceByServiceIdentifier 根据服务标识符获取设备信息（带配置）
 func (d *DeviceAPI) GetDeviceByServiceIdentifier(ctx context.Context, req *DeviceListRequest) (*DeviceListResponse, error) {
 	var resp DeviceListResponse
-	err := d.client.Post(ctx, "/api/v1/plugin/devices", req, &resp)
+	err := d.client.Post(ctx, PathServiceDevices, req, &resp)
 	if err != nil {
 		d.client.logger.Printf("获取设备列表失败: %v", err)
 		return nil, fmt.Errorf("获取设备列表失败: %w", err)
@@ -3,11 +3,21 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
 )
 
 // MQTTClient MQTT客户端封装
@@ -18,18 +28,58 @@ type MQTTClient struct {
 	clientID  string
 	username  string
 	password  string
-	connected bool
+	connected atomic.Bool
+	metrics   metrics.Recorder
+	tracing   tracing
+
+	everConnected atomic.Bool // 是否曾连接成功，用于区分首次连接和重连
+
+	mu            sync.Mutex
+	subscriptions map[string]*subscription // 当前订阅，键为主题
+	inFlight      atomic.Int64             // 等待确认的发布数
+
+	hookMu       sync.RWMutex
+	publishHooks []MessageHandler // 发布成功后调用
+	messageHooks []MessageHandler // 收到消息时调用
+	connectHooks []func(bool)     // 连接建立后调用，参数表示是否为重连
+}
+
+// subscription 订阅状态
+type subscription struct {
+	qos       byte
+	received  atomic.Int64 // 已收到的消息数
+	inProcess atomic.Int64 // 正在处理的消息数
+}
+
+// SubscriptionInfo 订阅信息
+type SubscriptionInfo struct {
+	Topic     string `json:"topic"`
+	QoS       byte   `json:"qos"`
+	Received  int64  `json:"received"`
+	InProcess int64  `json:"in_process"`
+}
+
+// MQTTStats MQTT客户端运行状态
+type MQTTStats struct {
+	Connected     bool               `json:"connected"`
+	InFlight      int64              `json:"in_flight"`
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
 }
 
 // MessageHandler 定义消息处理函数类型
 type MessageHandler func(topic string, payload []byte)
 
+// ContextMessageHandler 带上下文的消息处理函数，ctx 携带消费端span
+type ContextMessageHandler func(ctx context.Context, topic string, payload []byte)
+
 // MQTTConfig MQTT配置项
 type MQTTConfig struct {
 	Broker   string
 	ClientID string
 	Username string
 	Password string
+	Metrics  metrics.Recorder // 指标记录器，可为空
+	Tracing  TracingConfig    // 链路追踪配置
 }
 
 // NewMQTTClient 创建MQTT客户端实例
@@ -39,11 +89,14 @@ func NewMQTTClient(config MQTTConfig, logger *log.Logger) *MQTTClient {
 	}
 
 	return &MQTTClient{
-		broker:   config.Broker,
-		clientID: config.ClientID,
-		username: config.Username,
-		password: config.Password,
-		logger:   logger,
+		broker:        config.Broker,
+		clientID:      config.ClientID,
+		username:      config.Username,
+		password:      config.Password,
+		logger:        logger,
+		metrics:       metrics.OrNop(config.Metrics),
+		tracing:       newTracing(config.Tracing),
+		subscriptions: make(map[string]*subscription),
 	}
 }
 
@@ -64,13 +117,26 @@ func (m *MQTTClient) Connect() error {
 	// 设置连接丢失处理函数
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		m.logger.Printf("MQTT连接丢失: %v", err)
-		m.connected = false
+		m.connected.Store(false)
+		m.metrics.MQTTConnectionLost()
 	})
 
 	// 设置连接建立处理函数
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		m.logger.Printf("MQTT连接成功建立")
-		m.connected = true
+		m.connected.Store(true)
+		reconnect := m.everConnected.Swap(true)
+		if reconnect {
+			m.metrics.MQTTReconnect()
+		}
+
+		// 钩子中可能发布消息，不能阻塞paho的连接处理
+		m.hookMu.RLock()
+		hooks := m.connectHooks
+		m.hookMu.RUnlock()
+		for _, hook := range hooks {
+			go hook(reconnect)
+		}
 	})
 
 	// 创建客户端实例
@@ -88,56 +154,191 @@ func (m *MQTTClient) Connect() error {
 
 // Publish 发布消息
 func (m *MQTTClient) Publish(topic string, qos byte, payload interface{}) error {
-	if !m.connected {
+	return m.PublishContext(context.Background(), topic, qos, payload)
+}
+
+// PublishContext 发布消息，ctx 中的链路上下文作为生产者span的父span
+func (m *MQTTClient) PublishContext(ctx context.Context, topic string, qos byte, payload interface{}) error {
+	if !m.connected.Load() {
 		return fmt.Errorf("MQTT客户端未连接")
 	}
 
 	m.logger.Printf("准备发布消息: topic=%s, qos=%d", topic, qos)
 
+	ctx, span := m.tracing.tracer.Start(ctx, "publish "+metrics.TopicClass(topic),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "mqtt"),
+			attribute.String("messaging.operation", "publish"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.Int("messaging.mqtt.qos", int(qos)),
+		),
+	)
+	defer span.End()
+	payload = m.tracing.injectEnvelope(ctx, payload)
+
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
 	token := m.client.Publish(topic, qos, false, payload)
-	if token.Wait() && token.Error() != nil {
+	token.Wait()
+	m.metrics.MQTTPublish(metrics.TopicClass(topic), token.Error())
+	if token.Error() != nil {
+		span.RecordError(token.Error())
+		span.SetStatus(codes.Error, token.Error().Error())
 		m.logger.Printf("消息发布失败: %v", token.Error())
 		return fmt.Errorf("消息发布失败: %w", token.Error())
 	}
 
 	m.logger.Printf("消息发布成功")
+	if raw, ok := payloadBytes(payload); ok {
+		m.hookMu.RLock()
+		hooks := m.publishHooks
+		m.hookMu.RUnlock()
+		for _, hook := range hooks {
+			hook(topic, raw)
+		}
+	}
 	return nil
 }
 
 // Subscribe 订阅主题
 func (m *MQTTClient) Subscribe(topic string, qos byte, handler MessageHandler) error {
-	if !m.connected {
+	return m.SubscribeContext(topic, qos, func(_ context.Context, topic string, payload []byte) {
+		handler(topic, payload)
+	})
+}
+
+// SubscribeContext 订阅主题，每条消息会创建消费者span并通过 ctx 传给处理函数
+func (m *MQTTClient) SubscribeContext(topic string, qos byte, handler ContextMessageHandler) error {
+	if !m.connected.Load() {
 		return fmt.Errorf("MQTT客户端未连接")
 	}
 
 	m.logger.Printf("准备订阅主题: topic=%s, qos=%d", topic, qos)
 
+	sub := &subscription{qos: qos}
+
 	// 将自定义的MessageHandler转换为mqtt.MessageHandler
 	wrapper := func(client mqtt.Client, msg mqtt.Message) {
-		handler(msg.Topic(), msg.Payload())
+		m.metrics.MQTTDelivery(metrics.TopicClass(msg.Topic()))
+		sub.received.Add(1)
+		sub.inProcess.Add(1)
+		defer sub.inProcess.Add(-1)
+
+		ctx, payload := m.tracing.extractEnvelope(context.Background(), msg.Payload())
+		ctx, span := m.tracing.tracer.Start(ctx, "process "+metrics.TopicClass(msg.Topic()),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "mqtt"),
+				attribute.String("messaging.operation", "process"),
+				attribute.String("messaging.destination.name", msg.Topic()),
+				attribute.String("messaging.destination.subscription.name", topic),
+			),
+		)
+		defer span.End()
+
+		m.hookMu.RLock()
+		hooks := m.messageHooks
+		m.hookMu.RUnlock()
+		for _, hook := range hooks {
+			hook(msg.Topic(), payload)
+		}
+		handler(ctx, msg.Topic(), payload)
 	}
 
 	token := m.client.Subscribe(topic, qos, wrapper)
-	if token.Wait() && token.Error() != nil {
+	token.Wait()
+	m.metrics.MQTTSubscribe(metrics.TopicClass(topic), token.Error())
+	if token.Error() != nil {
 		m.logger.Printf("主题订阅失败: %v", token.Error())
 		return fmt.Errorf("主题订阅失败: %w", token.Error())
 	}
 
+	m.mu.Lock()
+	m.subscriptions[topic] = sub
+	m.mu.Unlock()
+
 	m.logger.Printf("主题订阅成功")
 	return nil
 }
 
+// OnPublish 添加发布钩子，每条消息发布成功后调用，payload 为 string 或 []byte 以外类型时不调用
+func (m *MQTTClient) OnPublish(hook MessageHandler) {
+	m.hookMu.Lock()
+	defer m.hookMu.Unlock()
+	m.publishHooks = append(m.publishHooks, hook)
+}
+
+// OnMessage 添加收消息钩子，在订阅的处理函数之前调用
+func (m *MQTTClient) OnMessage(hook MessageHandler) {
+	m.hookMu.Lock()
+	defer m.hookMu.Unlock()
+	m.messageHooks = append(m.messageHooks, hook)
+}
+
+// OnConnect 添加连接钩子，每次连接建立后在新的goroutine中调用，reconnect 表示是否为重连
+func (m *MQTTClient) OnConnect(hook func(reconnect bool)) {
+	m.hookMu.Lock()
+	defer m.hookMu.Unlock()
+	m.connectHooks = append(m.connectHooks, hook)
+}
+
+// payloadBytes 将发布内容转换为字节
+func payloadBytes(payload interface{}) ([]byte, bool) {
+	switch p := payload.(type) {
+	case []byte:
+		return p, true
+	case string:
+		return []byte(p), true
+	default:
+		return nil, false
+	}
+}
+
 // Disconnect 断开MQTT连接
 func (m *MQTTClient) Disconnect() {
-	if m.connected {
+	if m.connected.Load() {
 		m.logger.Printf("准备断开MQTT连接")
 		m.client.Disconnect(250)
-		m.connected = false
+		m.connected.Store(false)
 		m.logger.Printf("MQTT连接已断开")
 	}
 }
 
 // IsConnected 检查是否已连接
 func (m *MQTTClient) IsConnected() bool {
-	return m.connected
+	return m.connected.Load()
+}
+
+// Stats 返回连接状态、订阅列表和待确认消息数
+func (m *MQTTClient) Stats() MQTTStats {
+	stats := MQTTStats{
+		Connected: m.connected.Load(),
+		InFlight:  m.inFlight.Load(),
+	}
+
+	m.mu.Lock()
+	for topic, sub := range m.subscriptions {
+		stats.Subscriptions = append(stats.Subscriptions, SubscriptionInfo{
+			Topic:     topic,
+			QoS:       sub.qos,
+			Received:  sub.received.Load(),
+			InProcess: sub.inProcess.Load(),
+		})
+	}
+	m.mu.Unlock()
+	sort.Slice(stats.Subscriptions, func(i, j int) bool {
+		return stats.Subscriptions[i].Topic < stats.Subscriptions[j].Topic
+	})
+	return stats
+}
+
+// HealthCheck 返回MQTT连接检查函数，未连接时返回错误
+func (m *MQTTClient) HealthCheck() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !m.IsConnected() {
+			return errors.New("MQTT未连接")
+		}
+		return nil
+	}
 }
@@ -0,0 +1,69 @@
+// client/openapi.go
+
+package client
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/openapi"
+)
+
+// 平台接口路径
+const (
+	PathDeviceConfig      = "/api/v1/plugin/device/config"
+	PathDeviceAuth        = "/api/v1/device/auth"
+	PathServiceDevices    = "/api/v1/plugin/devices"
+	PathServiceAccessList = "/api/v1/plugin/service/access/list"
+	PathServiceAccess     = "/api/v1/plugin/service/access"
+	PathHeartbeat         = "/api/v1/plugin/heartbeat"
+)
+
+// apiEndpoint 返回平台接口路径对应的指标名称，其他路径归为 metrics.EndpointOther
+func apiEndpoint(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	switch path {
+	case PathDeviceConfig:
+		return "device_config"
+	case PathDeviceAuth:
+		return "device_auth"
+	case PathServiceDevices:
+		return "service_devices"
+	case PathServiceAccessList:
+		return "service_access_list"
+	case PathServiceAccess:
+		return "service_access"
+	case PathHeartbeat:
+		return "heartbeat"
+	}
+	return metrics.EndpointOther
+}
+
+// TagPlatform 平台接口分组
+const TagPlatform = "platform"
+
+// DescribeAPI 将 DeviceAPI 和 ServiceAPI 调用的平台接口添加到 OpenAPI 文档
+func DescribeAPI(doc *openapi.Document) {
+	doc.AddTag(TagPlatform, "ThingsPanel平台提供给插件调用的接口")
+
+	specs := []openapi.OperationSpec{
+		{OperationID: "getDeviceConfig", Path: PathDeviceConfig, Summary: "获取设备配置",
+			Body: DeviceConfigRequest{}, Response: DeviceConfigResponse{}},
+		{OperationID: "deviceDynamicAuth", Path: PathDeviceAuth, Summary: "设备动态认证",
+			Body: DeviceDynamicAuthRequest{}, Response: DeviceDynamicAuthResponse{}},
+		{OperationID: "getDeviceByServiceIdentifier", Path: PathServiceDevices, Summary: "根据服务标识符获取设备列表",
+			Body: DeviceListRequest{}, Response: DeviceListResponse{}},
+		{OperationID: "getServiceAccessList", Path: PathServiceAccessList, Summary: "获取服务接入点列表",
+			Body: ServiceAccessRequest{}, Response: ServiceAccessListResponse{}},
+		{OperationID: "getServiceAccess", Path: PathServiceAccess, Summary: "获取服务接入点信息",
+			Body: ServiceAccessRequest{}, Response: ServiceAccessResponse{}},
+		{OperationID: "sendHeartbeat", Path: PathHeartbeat, Summary: "发送服务心跳",
+			Body: HeartbeatRequest{}, Response: HeartbeatResponse{}},
+	}
+	for _, spec := range specs {
+		spec.Method = http.MethodPost
+		spec.Tags = []string{TagPlatform}
+		doc.Add(spec)
+	}
+}
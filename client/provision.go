@@ -0,0 +1,293 @@
+// client/provision.go
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ProvisionRequest 设备注册请求
+type ProvisionRequest struct {
+	DeviceNumber       string // 设备编号，必填
+	DeviceName         string // 设备名称，为空时由平台生成
+	ProductKey         string // 产品Key，为空时按 ProvisionConfig 的策略决定
+	ParentDeviceNumber string // 网关设备编号，子设备必填
+	SubDeviceAddr      string // 子设备地址
+}
+
+// ProvisionRecord 设备注册结果
+type ProvisionRecord struct {
+	DeviceNumber       string    `json:"device_number"`
+	DeviceID           string    `json:"device_id"`
+	Voucher            string    `json:"voucher"`
+	ProductKey         string    `json:"product_key,omitempty"`
+	ParentDeviceNumber string    `json:"parent_device_number,omitempty"`
+	SubDeviceAddr      string    `json:"sub_device_addr,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// ProvisionConfig 设备自动注册配置
+type ProvisionConfig struct {
+	// TemplateSecret 设备模板密钥，必填
+	TemplateSecret string
+	// ProductKey 请求未指定产品Key时使用的默认产品Key
+	ProductKey string
+	// ProductKeyFunc 请求未指定产品Key时调用，返回空字符串时使用 ProductKey
+	ProductKeyFunc func(req ProvisionRequest) string
+	// Store 注册结果存储，为空时使用内存存储，重启后不重复注册需使用持久化存储
+	Store ProvisionStore
+	// Rate 每秒最多注册次数，为0时不限制
+	Rate float64
+	// Burst 允许的突发注册次数，默认1
+	Burst int
+}
+
+// Provisioner 设备自动注册管理，首次接入的设备编号通过动态认证接口注册，
+// 注册结果写入存储，子设备在所属网关注册完成后注册
+type Provisioner struct {
+	api    *DeviceAPI
+	logger *log.Logger
+	config ProvisionConfig
+	store  ProvisionStore
+	limit  *tokenBucket
+
+	mu       sync.Mutex
+	inflight map[string]*provisionCall // 正在注册的设备编号
+}
+
+// provisionCall 同一设备编号的并发注册只发起一次请求
+type provisionCall struct {
+	done   chan struct{}
+	parent string // 正在等待注册的网关编号，用于检测网关关系成环
+	record *ProvisionRecord
+	err    error
+}
+
+// NewProvisioner 创建设备自动注册管理器
+func NewProvisioner(api *DeviceAPI, config ProvisionConfig, logger *log.Logger) *Provisioner {
+	if logger == nil {
+		logger = log.New(log.Writer(), "[TP-Provision] ", log.LstdFlags|log.Lshortfile)
+	}
+	store := config.Store
+	if store == nil {
+		store = NewMemoryProvisionStore()
+	}
+	var limit *tokenBucket
+	if config.Rate > 0 {
+		limit = newTokenBucket(config.Rate, config.Burst)
+	}
+	return &Provisioner{
+		api:      api,
+		logger:   logger,
+		config:   config,
+		store:    store,
+		limit:    limit,
+		inflight: make(map[string]*provisionCall),
+	}
+}
+
+// Lookup 查询已注册的设备
+func (p *Provisioner) Lookup(deviceNumber string) (*ProvisionRecord, bool, error) {
+	return p.store.Get(deviceNumber)
+}
+
+// Forget 删除注册记录，设备再次接入时会重新注册
+func (p *Provisioner) Forget(deviceNumber string) error {
+	return p.store.Delete(deviceNumber)
+}
+
+// Provision 返回设备的注册结果，未注册时向平台注册；
+// 子设备所属网关未注册时先以默认策略注册网关
+func (p *Provisioner) Provision(ctx context.Context, req ProvisionRequest) (*ProvisionRecord, error) {
+	if req.DeviceNumber == "" {
+		return nil, fmt.Errorf("设备编号不能为空")
+	}
+	if req.ParentDeviceNumber == req.DeviceNumber {
+		return nil, fmt.Errorf("子设备不能以自身为网关: device_number=%s", req.DeviceNumber)
+	}
+
+	if rec, ok, err := p.store.Get(req.DeviceNumber); err != nil {
+		return nil, fmt.Errorf("读取注册记录失败: %w", err)
+	} else if ok {
+		return rec, nil
+	}
+
+	p.mu.Lock()
+	if call, ok := p.inflight[req.DeviceNumber]; ok {
+		p.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.record, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &provisionCall{done: make(chan struct{})}
+	p.inflight[req.DeviceNumber] = call
+	p.mu.Unlock()
+
+	// 首次查询与其他协程完成注册之间存在间隙，登记后再查一次，避免重复注册；
+	// 查询不持有 p.mu，存储较慢时不阻塞其他设备编号
+	if rec, ok, err := p.store.Get(req.DeviceNumber); err != nil {
+		call.err = fmt.Errorf("读取注册记录失败: %w", err)
+	} else if ok {
+		call.record = rec
+	} else {
+		call.record, call.err = p.register(ctx, req, call)
+	}
+
+	p.mu.Lock()
+	delete(p.inflight, req.DeviceNumber)
+	p.mu.Unlock()
+	close(call.done)
+	return call.record, call.err
+}
+
+// ProvisionGateway 依次注册网关和子设备，子设备的 ParentDeviceNumber 会设置为网关编号，
+// 返回的结果与子设备顺序一致，遇到错误时停止并返回已注册的结果
+func (p *Provisioner) ProvisionGateway(ctx context.Context, gateway ProvisionRequest, subDevices []ProvisionRequest) (*ProvisionRecord, []*ProvisionRecord, error) {
+	gw, err := p.Provision(ctx, gateway)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := make([]*ProvisionRecord, 0, len(subDevices))
+	for _, sub := range subDevices {
+		sub.ParentDeviceNumber = gateway.DeviceNumber
+		rec, err := p.Provision(ctx, sub)
+		if err != nil {
+			return gw, records, err
+		}
+		records = append(records, rec)
+	}
+	return gw, records, nil
+}
+
+// register 调用动态认证接口注册设备并保存结果
+func (p *Provisioner) register(ctx context.Context, req ProvisionRequest, call *provisionCall) (*ProvisionRecord, error) {
+	if req.ParentDeviceNumber != "" {
+		if err := p.waitParent(req.DeviceNumber, req.ParentDeviceNumber, call); err != nil {
+			return nil, err
+		}
+		if _, err := p.Provision(ctx, ProvisionRequest{DeviceNumber: req.ParentDeviceNumber}); err != nil {
+			return nil, fmt.Errorf("注册网关失败: parent_device_number=%s, %w", req.ParentDeviceNumber, err)
+		}
+	}
+
+	productKey := req.ProductKey
+	if productKey == "" && p.config.ProductKeyFunc != nil {
+		productKey = p.config.ProductKeyFunc(req)
+	}
+	if productKey == "" {
+		productKey = p.config.ProductKey
+	}
+
+	if p.limit != nil {
+		if err := p.limit.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	p.logger.Printf("开始注册设备: deviceNumber=%s, parent=%s, productKey=%s", req.DeviceNumber, req.ParentDeviceNumber, productKey)
+	resp, err := p.api.DeviceDynamicAuth(ctx, &DeviceDynamicAuthRequest{
+		TemplateSecret:     p.config.TemplateSecret,
+		DeviceNumber:       req.DeviceNumber,
+		DeviceName:         req.DeviceName,
+		ProductKey:         productKey,
+		SubDeviceAddr:      req.SubDeviceAddr,
+		ParentDeviceNumber: req.ParentDeviceNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != http.StatusOK {
+		return nil, fmt.Errorf("设备注册失败: code=%d, message=%s", resp.Code, resp.Message)
+	}
+	if resp.Data.DeviceID == "" {
+		return nil, fmt.Errorf("设备注册失败: 平台未返回设备ID")
+	}
+
+	rec := &ProvisionRecord{
+		DeviceNumber:       req.DeviceNumber,
+		DeviceID:           resp.Data.DeviceID,
+		Voucher:            resp.Data.Voucher,
+		ProductKey:         productKey,
+		ParentDeviceNumber: req.ParentDeviceNumber,
+		SubDeviceAddr:      req.SubDeviceAddr,
+		CreatedAt:          time.Now(),
+	}
+	if err := p.store.Put(rec); err != nil {
+		// 设备已在平台注册，存储失败只影响重启后的去重
+		p.logger.Printf("保存注册记录失败: deviceNumber=%s, err=%v", req.DeviceNumber, err)
+	}
+	p.logger.Printf("设备注册成功: deviceNumber=%s, deviceID=%s", rec.DeviceNumber, rec.DeviceID)
+	return rec, nil
+}
+
+// waitParent 登记设备正在等待注册的网关，沿正在注册的网关链查找，
+// 链上出现设备自身时说明网关关系成环，直接返回错误而不是等到 ctx 超时
+func (p *Provisioner) waitParent(deviceNumber, parent string, call *provisionCall) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for cur := parent; cur != ""; {
+		if cur == deviceNumber {
+			return fmt.Errorf("网关关系成环: device_number=%s, parent_device_number=%s", deviceNumber, parent)
+		}
+		c, ok := p.inflight[cur]
+		if !ok {
+			break
+		}
+		cur = c.parent
+	}
+	call.parent = parent
+	return nil
+}
+
+// tokenBucket 令牌桶限流
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait 等待获取一个令牌
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
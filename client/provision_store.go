@@ -0,0 +1,152 @@
+// client/provision_store.go
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ProvisionStore 设备注册结果存储，实现需并发安全
+type ProvisionStore interface {
+	// Get 按设备编号读取注册记录，不存在时 ok 为 false
+	Get(deviceNumber string) (rec *ProvisionRecord, ok bool, err error)
+	// Put 保存注册记录
+	Put(rec *ProvisionRecord) error
+	// Delete 删除注册记录
+	Delete(deviceNumber string) error
+}
+
+// MemoryProvisionStore 内存存储，进程重启后丢失
+type MemoryProvisionStore struct {
+	mu      sync.RWMutex
+	records map[string]*ProvisionRecord
+}
+
+// NewMemoryProvisionStore 创建内存存储
+func NewMemoryProvisionStore() *MemoryProvisionStore {
+	return &MemoryProvisionStore{records: make(map[string]*ProvisionRecord)}
+}
+
+// Get 读取注册记录
+func (s *MemoryProvisionStore) Get(deviceNumber string) (*ProvisionRecord, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[deviceNumber]
+	return rec, ok, nil
+}
+
+// Put 保存注册记录
+func (s *MemoryProvisionStore) Put(rec *ProvisionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.DeviceNumber] = rec
+	return nil
+}
+
+// Delete 删除注册记录
+func (s *MemoryProvisionStore) Delete(deviceNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, deviceNumber)
+	return nil
+}
+
+// FileProvisionStore JSON文件存储，每次修改后整体写入临时文件再替换
+type FileProvisionStore struct {
+	path string
+
+	mu      sync.RWMutex
+	records map[string]*ProvisionRecord
+}
+
+// NewFileProvisionStore 创建文件存储，文件存在时加载已有记录
+func NewFileProvisionStore(path string) (*FileProvisionStore, error) {
+	s := &FileProvisionStore{path: path, records: make(map[string]*ProvisionRecord)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("读取注册记录文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+	var list []*ProvisionRecord
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析注册记录文件失败: %w", err)
+	}
+	for _, rec := range list {
+		s.records[rec.DeviceNumber] = rec
+	}
+	return s, nil
+}
+
+// Get 读取注册记录
+func (s *FileProvisionStore) Get(deviceNumber string) (*ProvisionRecord, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[deviceNumber]
+	return rec, ok, nil
+}
+
+// Put 保存注册记录并写入文件
+func (s *FileProvisionStore) Put(rec *ProvisionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.DeviceNumber] = rec
+	return s.saveLocked()
+}
+
+// Delete 删除注册记录并写入文件
+func (s *FileProvisionStore) Delete(deviceNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[deviceNumber]; !ok {
+		return nil
+	}
+	delete(s.records, deviceNumber)
+	return s.saveLocked()
+}
+
+func (s *FileProvisionStore) saveLocked() error {
+	list := make([]*ProvisionRecord, 0, len(s.records))
+	for _, rec := range s.records {
+		list = append(list, rec)
+	}
+	// 按注册时间排序，网关排在子设备之前
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].DeviceNumber < list[j].DeviceNumber
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化注册记录失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("写入注册记录文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入注册记录文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入注册记录文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("写入注册记录文件失败: %w", err)
+	}
+	return nil
+}
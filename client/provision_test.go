@@ -0,0 +1,219 @@
+// client/provision_test.go
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// authPlatform 动态认证接口，按设备编号返回设备ID，记录每个编号的注册次数
+type authPlatform struct {
+	mu    sync.Mutex
+	calls map[string]int
+	delay time.Duration
+}
+
+func (p *authPlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req DeviceDynamicAuthRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	p.mu.Lock()
+	if p.calls == nil {
+		p.calls = make(map[string]int)
+	}
+	p.calls[req.DeviceNumber]++
+	p.mu.Unlock()
+	time.Sleep(p.delay)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeviceDynamicAuthResponse{Code: http.StatusOK, Data: types.DeviceDynamicAuthData{
+		DeviceID: "id-" + req.DeviceNumber,
+		Voucher:  `{"username":"` + req.DeviceNumber + `"}`,
+	}})
+}
+
+func (p *authPlatform) count(deviceNumber string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[deviceNumber]
+}
+
+// hookStore 在读取注册记录时调用 hook，n 为该编号第几次读取（从1开始）
+type hookStore struct {
+	*MemoryProvisionStore
+	mu   sync.Mutex
+	gets map[string]int
+	hook func(deviceNumber string, n int)
+}
+
+func (s *hookStore) Get(deviceNumber string) (*ProvisionRecord, bool, error) {
+	s.mu.Lock()
+	s.gets[deviceNumber]++
+	n := s.gets[deviceNumber]
+	s.mu.Unlock()
+	if s.hook != nil {
+		s.hook(deviceNumber, n)
+	}
+	return s.MemoryProvisionStore.Get(deviceNumber)
+}
+
+func newTestProvisioner(t *testing.T, platform *authPlatform, store ProvisionStore) *Provisioner {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PathDeviceAuth {
+			http.NotFound(w, r)
+			return
+		}
+		platform.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	api := NewDeviceAPI(NewAPIClient(srv.URL, WithLogger(discardLogger)))
+	return NewProvisioner(api, ProvisionConfig{TemplateSecret: "s", Store: store}, discardLogger)
+}
+
+func TestProvisionConcurrentSameNumber(t *testing.T) {
+	platform := &authPlatform{delay: 20 * time.Millisecond}
+	p := newTestProvisioner(t, platform, nil)
+
+	var (
+		wg  sync.WaitGroup
+		ids sync.Map
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec, err := p.Provision(context.Background(), ProvisionRequest{DeviceNumber: "SN1"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids.Store(rec.DeviceID, true)
+		}(i)
+	}
+	wg.Wait()
+
+	if n := platform.count("SN1"); n != 1 {
+		t.Errorf("平台注册 %d 次, 期望 1 次", n)
+	}
+	ids.Range(func(id, _ interface{}) bool {
+		if id != "id-SN1" {
+			t.Errorf("设备ID = %v", id)
+		}
+		return true
+	})
+	if rec, ok, _ := p.Lookup("SN1"); !ok || rec.DeviceID != "id-SN1" {
+		t.Errorf("Lookup(SN1) = %+v, %v", rec, ok)
+	}
+}
+
+func TestProvisionRecheckAfterRegister(t *testing.T) {
+	platform := &authPlatform{}
+	store := &hookStore{MemoryProvisionStore: NewMemoryProvisionStore(), gets: make(map[string]int)}
+	p := newTestProvisioner(t, platform, store)
+
+	// 第一次查询未找到后、登记注册之前，另一个调用完成了同一编号的注册
+	store.hook = func(deviceNumber string, n int) {
+		if n == 1 {
+			if _, err := p.Provision(context.Background(), ProvisionRequest{DeviceNumber: deviceNumber}); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	rec, err := p.Provision(context.Background(), ProvisionRequest{DeviceNumber: "SN1"})
+	if err != nil || rec.DeviceID != "id-SN1" {
+		t.Fatalf("Provision = %+v, %v", rec, err)
+	}
+	if n := platform.count("SN1"); n != 1 {
+		t.Errorf("平台注册 %d 次, 期望登记后再次查询到已有记录", n)
+	}
+}
+
+func TestProvisionSlowStoreDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var blocked atomic.Bool
+	store := &hookStore{MemoryProvisionStore: NewMemoryProvisionStore(), gets: make(map[string]int)}
+	store.hook = func(deviceNumber string, n int) {
+		// 登记后的再次查询阻塞
+		if deviceNumber == "slow" && n == 2 {
+			blocked.Store(true)
+			<-release
+		}
+	}
+	p := newTestProvisioner(t, &authPlatform{}, store)
+
+	go p.Provision(context.Background(), ProvisionRequest{DeviceNumber: "slow"})
+	for !blocked.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Provision(context.Background(), ProvisionRequest{DeviceNumber: "fast"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("其他设备编号的注册被阻塞")
+	}
+}
+
+func TestProvisionSubDevice(t *testing.T) {
+	platform := &authPlatform{}
+	p := newTestProvisioner(t, platform, nil)
+	ctx := context.Background()
+
+	gw, subs, err := p.ProvisionGateway(ctx, ProvisionRequest{DeviceNumber: "GW"}, []ProvisionRequest{
+		{DeviceNumber: "S1", SubDeviceAddr: "1"},
+		{DeviceNumber: "S2", SubDeviceAddr: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gw.DeviceID != "id-GW" || len(subs) != 2 || subs[1].ParentDeviceNumber != "GW" || subs[1].SubDeviceAddr != "2" {
+		t.Errorf("注册结果 = %+v, %+v", gw, subs)
+	}
+
+	// 网关未注册时先注册网关
+	if _, err := p.Provision(ctx, ProvisionRequest{DeviceNumber: "S3", ParentDeviceNumber: "GW2"}); err != nil {
+		t.Fatal(err)
+	}
+	if platform.count("GW2") != 1 || platform.count("GW") != 1 {
+		t.Errorf("网关注册次数 = %v", platform.calls)
+	}
+}
+
+func TestProvisionParentCycle(t *testing.T) {
+	p := newTestProvisioner(t, &authPlatform{}, nil)
+
+	if _, err := p.Provision(context.Background(), ProvisionRequest{DeviceNumber: "A", ParentDeviceNumber: "A"}); err == nil {
+		t.Error("以自身为网关应返回错误")
+	}
+
+	// B 正在注册且等待网关 A，此时以 B 为网关注册 A 会成环
+	done := make(chan struct{})
+	defer close(done)
+	p.mu.Lock()
+	p.inflight["B"] = &provisionCall{done: done, parent: "A"}
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := p.Provision(ctx, ProvisionRequest{DeviceNumber: "A", ParentDeviceNumber: "B"})
+	if err == nil || !strings.Contains(err.Error(), "成环") {
+		t.Errorf("err = %v, 期望立即返回成环错误", err)
+	}
+}
@@ -0,0 +1,494 @@
+// client/registry.go
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// 设备列表分页大小
+const registryPageSize = 100
+
+// 平台未找到设备的结果缓存，避免错误的凭证或编号反复请求平台
+const (
+	defaultMissTTL = 30 * time.Second
+	maxMisses      = 4096
+)
+
+// ErrDeviceNotFound 平台未返回设备，设备不存在或平台拒绝查询
+var ErrDeviceNotFound = errors.New("设备不存在")
+
+// DeviceEntry 注册表中的设备，直连设备和网关的 Device 非空，子设备的 SubDevice 非空
+type DeviceEntry struct {
+	ID              string
+	Number          string
+	Voucher         string
+	ParentID        string // 子设备所属网关的设备ID
+	SubDeviceAddr   string // 子设备地址
+	ServiceAccessID string // 所属服务接入点ID
+	Device          *types.Device
+	SubDevice       *types.SubDevice
+	Session         *Session // 插件会话状态，设备信息刷新后保留
+}
+
+// IsSubDevice 是否为子设备
+func (e *DeviceEntry) IsSubDevice() bool {
+	return e.ParentID != ""
+}
+
+// Session 设备会话状态，并发安全
+type Session struct {
+	mu     sync.RWMutex
+	values map[string]interface{}
+}
+
+// Get 获取会话值
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Set 设置会话值
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]interface{})
+	}
+	s.values[key] = value
+}
+
+// Delete 删除会话值
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// subKey 网关和子设备地址组成的索引键
+type subKey struct {
+	parentID string
+	addr     string
+}
+
+// DeviceRegistry 设备注册表，维护设备ID、设备编号、凭证以及网关子设备地址之间的映射，并发安全
+type DeviceRegistry struct {
+	api *DeviceAPI
+
+	mu       sync.RWMutex
+	byID     map[string]*DeviceEntry
+	byNumber map[string]*DeviceEntry
+	byVouch  map[string]*DeviceEntry
+	bySub    map[subKey]*DeviceEntry
+	children map[string][]string  // 网关ID -> 子设备ID
+	misses   map[string]time.Time // 查找键 -> 未找到结果的过期时间
+	missTTL  time.Duration
+}
+
+// NewDeviceRegistry 创建设备注册表，api 用于按需从平台加载设备，可为空
+func NewDeviceRegistry(api *DeviceAPI) *DeviceRegistry {
+	return &DeviceRegistry{
+		api:      api,
+		byID:     make(map[string]*DeviceEntry),
+		byNumber: make(map[string]*DeviceEntry),
+		byVouch:  make(map[string]*DeviceEntry),
+		bySub:    make(map[subKey]*DeviceEntry),
+		children: make(map[string][]string),
+		misses:   make(map[string]time.Time),
+		missTTL:  defaultMissTTL,
+	}
+}
+
+// SetMissTTL 设置平台未找到设备的结果缓存时间，缓存期内相同的查找不再请求平台，为0时不缓存，默认30秒
+func (r *DeviceRegistry) SetMissTTL(ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.missTTL = ttl
+	if ttl <= 0 {
+		r.misses = make(map[string]time.Time)
+	}
+}
+
+// voucherKey 凭证索引键，解析后重新序列化以忽略字段顺序和空白差异
+func voucherKey(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	v, err := types.ParseVoucher(raw)
+	if err != nil {
+		return raw
+	}
+	return v.String()
+}
+
+// AddDevice 添加或更新设备及其子设备，返回设备条目
+func (r *DeviceRegistry) AddDevice(dev types.Device) *DeviceEntry {
+	return r.addDevice(dev, "")
+}
+
+// AddDevices 批量添加或更新设备
+func (r *DeviceRegistry) AddDevices(devices []types.Device) {
+	for _, dev := range devices {
+		r.addDevice(dev, "")
+	}
+}
+
+// AddServiceAccess 添加服务接入点下的设备，记录设备所属的服务接入点
+func (r *DeviceRegistry) AddServiceAccess(access types.ServiceAccess) {
+	for _, dev := range access.Devices {
+		r.addDevice(dev, access.ServiceAccessID)
+	}
+}
+
+// AddServiceAccessList 添加服务接入点列表中的设备，列表数据不含配置和子设备信息
+func (r *DeviceRegistry) AddServiceAccessList(list []types.ServiceAccessRsp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, access := range list {
+		for _, dev := range access.Devices {
+			serviceAccessID := dev.ServiceAccessID
+			if serviceAccessID == "" {
+				serviceAccessID = access.ID
+			}
+			// 已有完整信息时只补充服务接入点
+			if old, ok := r.byID[dev.ID]; ok {
+				updated := *old
+				updated.ServiceAccessID = serviceAccessID
+				r.putLocked(&updated)
+				continue
+			}
+			r.putLocked(&DeviceEntry{
+				ID:              dev.ID,
+				Number:          dev.DeviceNumber,
+				Voucher:         dev.Voucher,
+				SubDeviceAddr:   dev.SubDeviceAddr,
+				ServiceAccessID: serviceAccessID,
+			})
+		}
+	}
+}
+
+func (r *DeviceRegistry) addDevice(dev types.Device, serviceAccessID string) *DeviceEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if serviceAccessID == "" {
+		if old, ok := r.byID[dev.ID]; ok {
+			serviceAccessID = old.ServiceAccessID
+		}
+	}
+
+	d := dev
+	entry := &DeviceEntry{
+		ID:              dev.ID,
+		Number:          dev.DeviceNumber,
+		Voucher:         dev.Voucher,
+		ServiceAccessID: serviceAccessID,
+		Device:          &d,
+	}
+	r.putLocked(entry)
+
+	// 先移除已不存在的子设备
+	keep := make(map[string]bool, len(dev.SubDevices))
+	for _, sub := range dev.SubDevices {
+		keep[sub.DeviceID] = true
+	}
+	for _, id := range r.children[dev.ID] {
+		if !keep[id] {
+			r.removeLocked(id)
+		}
+	}
+	r.children[dev.ID] = nil
+
+	for i := range dev.SubDevices {
+		sub := dev.SubDevices[i]
+		r.putLocked(&DeviceEntry{
+			ID:              sub.DeviceID,
+			Number:          sub.DeviceNumber,
+			Voucher:         sub.Voucher,
+			ParentID:        dev.ID,
+			SubDeviceAddr:   sub.SubDeviceAddr,
+			ServiceAccessID: serviceAccessID,
+			SubDevice:       &sub,
+		})
+		r.children[dev.ID] = append(r.children[dev.ID], sub.DeviceID)
+	}
+	return entry
+}
+
+// putLocked 写入条目并更新索引，沿用已有条目的会话状态
+func (r *DeviceRegistry) putLocked(entry *DeviceEntry) {
+	if old, ok := r.byID[entry.ID]; ok {
+		entry.Session = old.Session
+		r.unindexLocked(old)
+	}
+	if entry.Session == nil {
+		entry.Session = &Session{}
+	}
+
+	delete(r.misses, "id:"+entry.ID)
+	delete(r.misses, "number:"+entry.Number)
+	delete(r.misses, "voucher:"+voucherKey(entry.Voucher))
+
+	r.byID[entry.ID] = entry
+	if entry.Number != "" {
+		r.byNumber[entry.Number] = entry
+	}
+	if key := voucherKey(entry.Voucher); key != "" {
+		r.byVouch[key] = entry
+	}
+	if entry.ParentID != "" && entry.SubDeviceAddr != "" {
+		r.bySub[subKey{entry.ParentID, entry.SubDeviceAddr}] = entry
+	}
+}
+
+// unindexLocked 移除条目的编号、凭证和子设备地址索引
+func (r *DeviceRegistry) unindexLocked(entry *DeviceEntry) {
+	if r.byNumber[entry.Number] == entry {
+		delete(r.byNumber, entry.Number)
+	}
+	if key := voucherKey(entry.Voucher); r.byVouch[key] == entry {
+		delete(r.byVouch, key)
+	}
+	key := subKey{entry.ParentID, entry.SubDeviceAddr}
+	if r.bySub[key] == entry {
+		delete(r.bySub, key)
+	}
+}
+
+func (r *DeviceRegistry) removeLocked(id string) {
+	entry, ok := r.byID[id]
+	if !ok {
+		return
+	}
+	r.unindexLocked(entry)
+	delete(r.byID, id)
+	for _, childID := range r.children[id] {
+		r.removeLocked(childID)
+	}
+	delete(r.children, id)
+}
+
+// Remove 移除设备，网关的子设备一并移除
+func (r *DeviceRegistry) Remove(deviceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(deviceID)
+}
+
+// HandleDisconnect 平台通知设备断开时移除设备，设备重新接入时会从平台获取最新配置，
+// 签名与 handler.Handler.AddDisconnectListener 的监听器一致
+func (r *DeviceRegistry) HandleDisconnect(_ context.Context, deviceID string) {
+	r.Remove(deviceID)
+}
+
+// ByID 按设备ID查找
+func (r *DeviceRegistry) ByID(deviceID string) (*DeviceEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.byID[deviceID]
+	return e, ok
+}
+
+// ByNumber 按设备编号查找
+func (r *DeviceRegistry) ByNumber(number string) (*DeviceEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.byNumber[number]
+	return e, ok
+}
+
+// ByVoucher 按凭证查找，凭证字段顺序不影响匹配
+func (r *DeviceRegistry) ByVoucher(voucher string) (*DeviceEntry, bool) {
+	key := voucherKey(voucher)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.byVouch[key]
+	return e, ok
+}
+
+// BySubDeviceAddr 按网关设备ID和子设备地址查找子设备
+func (r *DeviceRegistry) BySubDeviceAddr(gatewayID, addr string) (*DeviceEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.bySub[subKey{gatewayID, addr}]
+	return e, ok
+}
+
+// SubDevices 返回网关的子设备，按子设备地址排序
+func (r *DeviceRegistry) SubDevices(gatewayID string) []*DeviceEntry {
+	r.mu.RLock()
+	list := make([]*DeviceEntry, 0, len(r.children[gatewayID]))
+	for _, id := range r.children[gatewayID] {
+		if e, ok := r.byID[id]; ok {
+			list = append(list, e)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].SubDeviceAddr < list[j].SubDeviceAddr })
+	return list
+}
+
+// IDByNumber 设备编号转设备ID
+func (r *DeviceRegistry) IDByNumber(number string) (string, bool) {
+	e, ok := r.ByNumber(number)
+	if !ok {
+		return "", false
+	}
+	return e.ID, true
+}
+
+// NumberByID 设备ID转设备编号
+func (r *DeviceRegistry) NumberByID(deviceID string) (string, bool) {
+	e, ok := r.ByID(deviceID)
+	if !ok {
+		return "", false
+	}
+	return e.Number, true
+}
+
+// List 返回全部设备，按设备ID排序
+func (r *DeviceRegistry) List() []*DeviceEntry {
+	r.mu.RLock()
+	list := make([]*DeviceEntry, 0, len(r.byID))
+	for _, e := range r.byID {
+		list = append(list, e)
+	}
+	r.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Len 设备数量
+func (r *DeviceRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byID)
+}
+
+// Load 分页加载服务标识符下的全部设备
+func (r *DeviceRegistry) Load(ctx context.Context, serviceIdentifier string) error {
+	if r.api == nil {
+		return fmt.Errorf("设备注册表未配置设备API")
+	}
+
+	loaded := 0
+	for page := 1; ; page++ {
+		resp, err := r.api.GetDeviceByServiceIdentifier(ctx, &DeviceListRequest{
+			ServiceIdentifier: serviceIdentifier,
+			Page:              page,
+			PageSize:          registryPageSize,
+		})
+		if err != nil {
+			return err
+		}
+		if resp.Code != http.StatusOK {
+			return fmt.Errorf("获取设备列表失败: code=%d, message=%s", resp.Code, resp.Message)
+		}
+		r.AddDevices(resp.Data.List)
+		loaded += len(resp.Data.List)
+		// 平台未返回总数时 Total 为0，只按短页判断是否结束
+		if len(resp.Data.List) < registryPageSize || (resp.Data.Total > 0 && loaded >= resp.Data.Total) {
+			return nil
+		}
+	}
+}
+
+// Fetch 从平台获取设备配置并写入注册表
+func (r *DeviceRegistry) Fetch(ctx context.Context, req *DeviceConfigRequest) (*DeviceEntry, error) {
+	if r.api == nil {
+		return nil, fmt.Errorf("设备注册表未配置设备API")
+	}
+	resp, err := r.api.GetDeviceConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != http.StatusOK {
+		return nil, fmt.Errorf("获取设备配置失败: code=%d, message=%s: %w", resp.Code, resp.Message, ErrDeviceNotFound)
+	}
+	if resp.Data.ID == "" {
+		return nil, fmt.Errorf("获取设备配置失败: %w", ErrDeviceNotFound)
+	}
+	return r.AddDevice(resp.Data), nil
+}
+
+// resolve 先在注册表中查找，不存在时从平台获取；平台未找到的结果按 missKey 缓存
+func (r *DeviceRegistry) resolve(ctx context.Context, missKey string, req *DeviceConfigRequest, lookup func() (*DeviceEntry, bool)) (*DeviceEntry, error) {
+	if e, ok := lookup(); ok {
+		return e, nil
+	}
+	if r.missed(missKey) {
+		return nil, ErrDeviceNotFound
+	}
+	if _, err := r.Fetch(ctx, req); err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			r.miss(missKey)
+		}
+		return nil, err
+	}
+	if e, ok := lookup(); ok {
+		return e, nil
+	}
+	r.miss(missKey)
+	return nil, ErrDeviceNotFound
+}
+
+// missed 查找键是否在未找到缓存中
+func (r *DeviceRegistry) missed(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	expires, ok := r.misses[key]
+	return ok && time.Now().Before(expires)
+}
+
+// miss 缓存未找到的结果，缓存已满时先清理过期项，仍然已满时不缓存
+func (r *DeviceRegistry) miss(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.missTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	if len(r.misses) >= maxMisses {
+		for k, expires := range r.misses {
+			if !now.Before(expires) {
+				delete(r.misses, k)
+			}
+		}
+		if len(r.misses) >= maxMisses {
+			return
+		}
+	}
+	r.misses[key] = now.Add(r.missTTL)
+}
+
+// ResolveID 按设备ID查找，不存在时从平台获取
+func (r *DeviceRegistry) ResolveID(ctx context.Context, deviceID string) (*DeviceEntry, error) {
+	return r.resolve(ctx, "id:"+deviceID, &DeviceConfigRequest{DeviceID: deviceID}, func() (*DeviceEntry, bool) {
+		return r.ByID(deviceID)
+	})
+}
+
+// ResolveNumber 按设备编号查找，不存在时从平台获取；按编号获取的可能是子设备所属的网关
+func (r *DeviceRegistry) ResolveNumber(ctx context.Context, number string) (*DeviceEntry, error) {
+	return r.resolve(ctx, "number:"+number, &DeviceConfigRequest{DeviceNumber: number}, func() (*DeviceEntry, bool) {
+		return r.ByNumber(number)
+	})
+}
+
+// ResolveVoucher 按凭证查找，不存在时从平台获取；错误信息不包含凭证内容
+func (r *DeviceRegistry) ResolveVoucher(ctx context.Context, voucher string) (*DeviceEntry, error) {
+	return r.resolve(ctx, "voucher:"+voucherKey(voucher), &DeviceConfigRequest{Voucher: voucher}, func() (*DeviceEntry, bool) {
+		return r.ByVoucher(voucher)
+	})
+}
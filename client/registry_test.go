@@ -0,0 +1,257 @@
+// client/registry_test.go
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// fakePlatform 按设备ID、编号、凭证返回设备配置，记录设备配置接口的调用次数
+type fakePlatform struct {
+	mu      sync.Mutex
+	devices []types.Device
+	list    []types.Device // 设备列表接口返回的设备，不返回总数
+	calls   atomic.Int32
+}
+
+func (p *fakePlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case PathDeviceConfig:
+		p.calls.Add(1)
+		var req DeviceConfigRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, d := range p.devices {
+			if (req.DeviceID != "" && d.ID == req.DeviceID) ||
+				(req.DeviceNumber != "" && d.DeviceNumber == req.DeviceNumber) ||
+				(req.Voucher != "" && d.Voucher == req.Voucher) {
+				json.NewEncoder(w).Encode(DeviceConfigResponse{Code: http.StatusOK, Data: d})
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(DeviceConfigResponse{Code: http.StatusNotFound, Message: "设备不存在"})
+	case PathServiceDevices:
+		var req DeviceListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		start := (req.Page - 1) * req.PageSize
+		end := start + req.PageSize
+		if start > len(p.list) {
+			start = len(p.list)
+		}
+		if end > len(p.list) {
+			end = len(p.list)
+		}
+		json.NewEncoder(w).Encode(DeviceListResponse{Code: http.StatusOK, Data: DevicesList{List: p.list[start:end]}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestRegistry(t *testing.T, p *fakePlatform) *DeviceRegistry {
+	t.Helper()
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return NewDeviceRegistry(NewDeviceAPI(NewAPIClient(srv.URL, WithLogger(discardLogger))))
+}
+
+func TestRegistryIndexes(t *testing.T) {
+	r := NewDeviceRegistry(nil)
+	r.AddDevice(types.Device{
+		ID: "gw", DeviceNumber: "GW1", Voucher: `{"username":"u","password":"p"}`,
+		SubDevices: []types.SubDevice{
+			{DeviceID: "s2", DeviceNumber: "S2", SubDeviceAddr: "2"},
+			{DeviceID: "s1", DeviceNumber: "S1", SubDeviceAddr: "1"},
+		},
+	})
+
+	if e, ok := r.ByVoucher(`{ "password": "p", "username": "u" }`); !ok || e.ID != "gw" {
+		t.Errorf("凭证字段顺序和空白不应影响查找")
+	}
+	if id, ok := r.IDByNumber("S1"); !ok || id != "s1" {
+		t.Errorf("IDByNumber(S1) = %q, %v", id, ok)
+	}
+	if e, ok := r.BySubDeviceAddr("gw", "2"); !ok || e.ID != "s2" || !e.IsSubDevice() {
+		t.Errorf("BySubDeviceAddr(gw, 2) = %+v, %v", e, ok)
+	}
+	if subs := r.SubDevices("gw"); len(subs) != 2 || subs[0].ID != "s1" {
+		t.Errorf("SubDevices 应按地址排序: %v", subs)
+	}
+
+	// 会话状态在设备更新后保留，移除的子设备从索引中删除
+	gw, _ := r.ByID("gw")
+	gw.Session.Set("k", 1)
+	r.AddDevice(types.Device{ID: "gw", DeviceNumber: "GW1", SubDevices: []types.SubDevice{{DeviceID: "s1", DeviceNumber: "S1", SubDeviceAddr: "1"}}})
+	if gw, _ := r.ByID("gw"); gw.Session == nil {
+		t.Fatal("会话状态丢失")
+	} else if v, ok := gw.Session.Get("k"); !ok || v != 1 {
+		t.Errorf("会话值 = %v, %v", v, ok)
+	}
+	if _, ok := r.ByID("s2"); ok {
+		t.Errorf("已不存在的子设备应被移除")
+	}
+	if _, ok := r.ByVoucher(`{"username":"u","password":"p"}`); ok {
+		t.Errorf("凭证变化后旧凭证不应再匹配")
+	}
+
+	r.Remove("gw")
+	if r.Len() != 0 {
+		t.Errorf("移除网关后应同时移除子设备, 剩余 %d", r.Len())
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	p := &fakePlatform{devices: []types.Device{{ID: "d1", DeviceNumber: "SN1", Voucher: "v1"}}}
+	r := newTestRegistry(t, p)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		resolve func() (*DeviceEntry, error)
+	}{
+		{"设备ID", func() (*DeviceEntry, error) { return r.ResolveID(ctx, "d1") }},
+		{"设备编号", func() (*DeviceEntry, error) { return r.ResolveNumber(ctx, "SN1") }},
+		{"凭证", func() (*DeviceEntry, error) { return r.ResolveVoucher(ctx, "v1") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := tt.resolve()
+			if err != nil || e.ID != "d1" {
+				t.Fatalf("解析结果 = %+v, %v", e, err)
+			}
+		})
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("平台调用 %d 次, 期望首次获取后使用注册表中的设备", n)
+	}
+}
+
+func TestRegistryResolveMiss(t *testing.T) {
+	p := &fakePlatform{}
+	r := newTestRegistry(t, p)
+	ctx := context.Background()
+	const secret = `{"access_token":"secret-token"}`
+
+	for i := 0; i < 5; i++ {
+		_, err := r.ResolveVoucher(ctx, secret)
+		if !errors.Is(err, ErrDeviceNotFound) {
+			t.Fatalf("err = %v, 期望 ErrDeviceNotFound", err)
+		}
+		if strings.Contains(err.Error(), "secret-token") {
+			t.Fatalf("错误信息包含凭证: %v", err)
+		}
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("平台调用 %d 次, 期望未找到的结果被缓存", n)
+	}
+
+	// 设备加入注册表后缓存失效
+	r.AddDevice(types.Device{ID: "d1", Voucher: secret})
+	if e, err := r.ResolveVoucher(ctx, secret); err != nil || e.ID != "d1" {
+		t.Fatalf("加入设备后解析结果 = %+v, %v", e, err)
+	}
+
+	// 平台新增设备后，缓存过期前不再请求平台
+	p.mu.Lock()
+	p.devices = append(p.devices, types.Device{ID: "d2", DeviceNumber: "SN2"})
+	p.mu.Unlock()
+	r.SetMissTTL(50 * time.Millisecond)
+	r.miss("number:SN2")
+	if _, err := r.ResolveNumber(ctx, "SN2"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("缓存期内 err = %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if e, err := r.ResolveNumber(ctx, "SN2"); err != nil || e.ID != "d2" {
+		t.Fatalf("缓存过期后解析结果 = %+v, %v", e, err)
+	}
+
+	// 关闭缓存后每次都请求平台
+	r.SetMissTTL(0)
+	before := p.calls.Load()
+	r.ResolveID(ctx, "missing")
+	r.ResolveID(ctx, "missing")
+	if n := p.calls.Load() - before; n != 2 {
+		t.Errorf("关闭缓存后平台调用 %d 次, 期望 2", n)
+	}
+}
+
+func TestRegistryMissCacheBounded(t *testing.T) {
+	r := NewDeviceRegistry(nil)
+	for i := 0; i < maxMisses+100; i++ {
+		r.miss(fmt.Sprintf("voucher:%d", i))
+	}
+	if n := len(r.misses); n != maxMisses {
+		t.Errorf("缓存数量 = %d, 期望不超过 %d", n, maxMisses)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	p := &fakePlatform{}
+	for i := 0; i < 20; i++ {
+		p.devices = append(p.devices, types.Device{ID: fmt.Sprintf("d%d", i), DeviceNumber: fmt.Sprintf("SN%d", i), Voucher: fmt.Sprintf("v%d", i)})
+	}
+	r := newTestRegistry(t, p)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(4)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := r.ResolveVoucher(ctx, fmt.Sprintf("v%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			r.AddDevice(types.Device{ID: fmt.Sprintf("d%d", i), DeviceNumber: fmt.Sprintf("SN%d", i), Voucher: fmt.Sprintf("v%d", i)})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			r.ResolveNumber(ctx, fmt.Sprintf("SN%d", i))
+			r.List()
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			r.HandleDisconnect(ctx, fmt.Sprintf("d%d", (i+1)%20))
+			r.SubDevices(fmt.Sprintf("d%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, e := range r.List() {
+		if got, ok := r.ByNumber(e.Number); !ok || got != e {
+			t.Errorf("设备 %s 的编号索引不一致", e.ID)
+		}
+		if got, ok := r.ByVoucher(e.Voucher); !ok || got != e {
+			t.Errorf("设备 %s 的凭证索引不一致", e.ID)
+		}
+	}
+}
+
+func TestRegistryLoadWithoutTotal(t *testing.T) {
+	p := &fakePlatform{}
+	for i := 0; i < 2*registryPageSize+10; i++ {
+		p.list = append(p.list, types.Device{ID: fmt.Sprintf("d%d", i)})
+	}
+	r := newTestRegistry(t, p)
+	if err := r.Load(context.Background(), "svc"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != len(p.list) {
+		t.Errorf("加载 %d 个设备, 期望 %d", r.Len(), len(p.list))
+	}
+}
@@ -5,6 +5,8 @@ package client
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
 )
@@ -12,6 +14,10 @@ import (
 // ServiceAPI 服务接入相关API封装
 type ServiceAPI struct {
 	client *APIClient
+
+	mu               sync.Mutex
+	lastHeartbeat    time.Time // 最近一次心跳成功时间
+	lastHeartbeatErr error     // 最近一次心跳错误
 }
 
 // ServiceAccessRequest 获取服务接入点请求
@@ -56,7 +62,7 @@ func (s *ServiceAPI) GetServiceAccessList(ctx context.Context, req *ServiceAcces
 	s.client.logger.Printf("开始获取服务接入点列表: serviceIdentifier=%s", req.ServiceIdentifier)
 
 	var resp ServiceAccessListResponse
-	err := s.client.Post(ctx, "/api/v1/plugin/service/access/list", req, &resp)
+	err := s.client.Post(ctx, PathServiceAccessList, req, &resp)
 	if err != nil {
 		s.client.logger.Printf("获取服务接入点列表失败: %v", err)
 		return nil, fmt.Errorf("获取服务接入点列表失败: %w", err)
@@ -72,7 +78,7 @@ func (s *ServiceAPI) GetServiceAccess(ctx context.Context, req *ServiceAccessReq
 	s.client.logger.Printf("开始获取服务接入点信息: serviceAccessID=%s", req.ServiceAccessID)
 
 	var resp ServiceAccessResponse
-	err := s.client.Post(ctx, "/api/v1/plugin/service/access", req, &resp)
+	err := s.client.Post(ctx, PathServiceAccess, req, &resp)
 	if err != nil {
 		s.client.logger.Printf("获取服务接入点信息失败: %v", err)
 		return nil, fmt.Errorf("获取服务接入点信息失败: %w", err)
@@ -88,12 +94,50 @@ func (s *ServiceAPI) SendHeartbeat(ctx context.Context, req *HeartbeatRequest) (
 	s.client.logger.Printf("开始发送服务心跳: serviceIdentifier=%s", req.ServiceIdentifier)
 
 	var resp HeartbeatResponse
-	err := s.client.Post(ctx, "/api/v1/plugin/heartbeat", req, &resp)
+	err := s.client.Post(ctx, PathHeartbeat, req, &resp)
 	if err != nil {
 		s.client.logger.Printf("发送服务心跳失败: %v", err)
+		s.recordHeartbeat(err)
 		return nil, fmt.Errorf("发送服务心跳失败: %w", err)
 	}
 
+	s.recordHeartbeat(nil)
 	s.client.logger.Printf("发送服务心跳成功")
 	return &resp, nil
 }
+
+// recordHeartbeat 记录心跳结果
+func (s *ServiceAPI) recordHeartbeat(err error) {
+	s.client.metrics.Heartbeat(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastHeartbeatErr = err
+	if err == nil {
+		s.lastHeartbeat = time.Now()
+	}
+}
+
+// LastHeartbeat 返回最近一次心跳成功时间和最近一次心跳错误
+func (s *ServiceAPI) LastHeartbeat() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastHeartbeat, s.lastHeartbeatErr
+}
+
+// HeartbeatCheck 返回心跳检查函数，最近一次成功心跳超过 maxAge 时返回错误
+func (s *ServiceAPI) HeartbeatCheck(maxAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		last, lastErr := s.LastHeartbeat()
+		if last.IsZero() {
+			if lastErr != nil {
+				return fmt.Errorf("尚未成功发送心跳: %w", lastErr)
+			}
+			return fmt.Errorf("尚未发送心跳")
+		}
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("最近一次心跳成功在 %v 前", age.Truncate(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,327 @@
+// client/status.go
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 设备状态值
+const (
+	StatusOnline  = "1"
+	StatusOffline = "0"
+)
+
+// StatusTopicPrefix 设备状态主题前缀，完整主题为 devices/status/{device_id}
+const StatusTopicPrefix = "devices/status/"
+
+// 未开启超时检测时的重试间隔
+const defaultStatusInterval = 10 * time.Second
+
+// StatusConfig 设备状态管理配置
+type StatusConfig struct {
+	// Timeout 设备超过该时长没有收发消息时上报离线，为0时不做超时检测
+	Timeout time.Duration
+	// CheckInterval 超时检查间隔，默认为 Timeout 的四分之一，最小1秒
+	CheckInterval time.Duration
+	// QoS 状态消息的QoS
+	QoS byte
+	// DeviceID 从收发的消息中提取设备ID，返回空字符串表示与设备无关，
+	// 默认读取JSON消息的 device_id 字段
+	DeviceID func(topic string, payload []byte) string
+}
+
+// DeviceStatus 设备状态
+type DeviceStatus struct {
+	DeviceID string    `json:"device_id"`
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// deviceState 设备状态记录
+type deviceState struct {
+	online   bool
+	lastSeen time.Time
+}
+
+// StatusManager 设备在线状态管理，记录每个设备最后收发消息的时间，
+// 首次有消息时上报在线，超时或平台通知断开时上报离线，MQTT重连后重新上报全部状态
+type StatusManager struct {
+	mqtt     *MQTTClient
+	logger   *log.Logger
+	timeout  time.Duration
+	interval time.Duration
+	qos      byte
+	deviceID func(topic string, payload []byte) string
+
+	mu      sync.Mutex
+	devices map[string]*deviceState
+	dirty   map[string]struct{} // 待上报的设备
+
+	notify    chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewStatusManager 创建设备状态管理器，并在MQTT客户端上注册收发和重连钩子，
+// 需调用 Start 启动上报和超时检测
+func NewStatusManager(mqtt *MQTTClient, config StatusConfig, logger *log.Logger) *StatusManager {
+	if logger == nil {
+		logger = log.New(log.Writer(), "[TP-Status] ", log.LstdFlags|log.Lshortfile)
+	}
+
+	interval := config.CheckInterval
+	if interval <= 0 {
+		interval = defaultStatusInterval
+		if config.Timeout > 0 {
+			interval = config.Timeout / 4
+		}
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	deviceID := config.DeviceID
+	if deviceID == nil {
+		deviceID = payloadDeviceID
+	}
+
+	s := &StatusManager{
+		mqtt:     mqtt,
+		logger:   logger,
+		timeout:  config.Timeout,
+		interval: interval,
+		qos:      config.QoS,
+		deviceID: deviceID,
+		devices:  make(map[string]*deviceState),
+		dirty:    make(map[string]struct{}),
+		notify:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	mqtt.OnPublish(s.observe)
+	mqtt.OnMessage(s.observe)
+	mqtt.OnConnect(func(reconnect bool) {
+		if reconnect {
+			s.Republish()
+		}
+	})
+	return s
+}
+
+// payloadDeviceID 读取JSON消息中的 device_id 字段
+func payloadDeviceID(_ string, payload []byte) string {
+	var msg struct {
+		DeviceID string `json:"device_id"`
+	}
+	if len(payload) == 0 || payload[0] != '{' || json.Unmarshal(payload, &msg) != nil {
+		return ""
+	}
+	return msg.DeviceID
+}
+
+// observe 收发消息钩子
+func (s *StatusManager) observe(topic string, payload []byte) {
+	if strings.HasPrefix(topic, StatusTopicPrefix) {
+		return
+	}
+	if id := s.deviceID(topic, payload); id != "" {
+		s.Touch(id)
+	}
+}
+
+// Touch 记录设备活动时间，设备此前未知或离线时上报在线
+func (s *StatusManager) Touch(deviceID string) {
+	s.mu.Lock()
+	st, ok := s.devices[deviceID]
+	if !ok {
+		st = &deviceState{}
+		s.devices[deviceID] = st
+	}
+	st.lastSeen = time.Now()
+	changed := !st.online
+	st.online = true
+	if changed {
+		s.dirty[deviceID] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.logger.Printf("设备上线: device_id=%s", deviceID)
+		s.wake()
+	}
+}
+
+// SetOffline 将设备标记为离线并上报，设备再次收发消息时重新上线
+func (s *StatusManager) SetOffline(deviceID string) {
+	s.mu.Lock()
+	st, ok := s.devices[deviceID]
+	if !ok {
+		st = &deviceState{online: true}
+		s.devices[deviceID] = st
+	}
+	changed := st.online
+	st.online = false
+	if changed {
+		s.dirty[deviceID] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.logger.Printf("设备离线: device_id=%s", deviceID)
+		s.wake()
+	}
+}
+
+// Remove 移除设备状态记录，不上报状态
+func (s *StatusManager) Remove(deviceID string) {
+	s.mu.Lock()
+	delete(s.devices, deviceID)
+	delete(s.dirty, deviceID)
+	s.mu.Unlock()
+}
+
+// HandleDisconnect 平台通知设备断开时上报离线，签名与 handler.Handler.AddDisconnectListener 的监听器一致
+func (s *StatusManager) HandleDisconnect(_ context.Context, deviceID string) {
+	s.SetOffline(deviceID)
+}
+
+// Status 返回设备状态
+func (s *StatusManager) Status(deviceID string) (DeviceStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.devices[deviceID]
+	if !ok {
+		return DeviceStatus{}, false
+	}
+	return DeviceStatus{DeviceID: deviceID, Online: st.online, LastSeen: st.lastSeen}, true
+}
+
+// List 返回全部设备状态，按设备ID排序
+func (s *StatusManager) List() []DeviceStatus {
+	s.mu.Lock()
+	list := make([]DeviceStatus, 0, len(s.devices))
+	for id, st := range s.devices {
+		list = append(list, DeviceStatus{DeviceID: id, Online: st.online, LastSeen: st.lastSeen})
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// Republish 重新上报全部设备状态
+func (s *StatusManager) Republish() {
+	s.mu.Lock()
+	for id := range s.devices {
+		s.dirty[id] = struct{}{}
+	}
+	s.mu.Unlock()
+	s.wake()
+}
+
+// Start 启动状态上报和超时检测，重复调用无效
+func (s *StatusManager) Start() {
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Stop 停止状态上报和超时检测，停止前上报尚未发出的状态
+func (s *StatusManager) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	started := true
+	s.startOnce.Do(func() { started = false })
+	if started {
+		<-s.done
+	}
+}
+
+func (s *StatusManager) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *StatusManager) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			s.flush()
+			return
+		case <-s.notify:
+			s.flush()
+		case <-ticker.C:
+			s.checkTimeout()
+			s.flush()
+		}
+	}
+}
+
+// checkTimeout 将超时未活动的设备标记为离线
+func (s *StatusManager) checkTimeout() {
+	if s.timeout <= 0 {
+		return
+	}
+	now := time.Now()
+	var expired []string
+
+	s.mu.Lock()
+	for id, st := range s.devices {
+		if st.online && now.Sub(st.lastSeen) > s.timeout {
+			st.online = false
+			s.dirty[id] = struct{}{}
+			expired = append(expired, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range expired {
+		s.logger.Printf("设备超时离线: device_id=%s, timeout=%v", id, s.timeout)
+	}
+}
+
+// flush 上报待上报设备的当前状态，失败的设备留待下次重试
+func (s *StatusManager) flush() {
+	if !s.mqtt.IsConnected() {
+		return
+	}
+
+	s.mu.Lock()
+	pending := make(map[string]bool, len(s.dirty))
+	for id := range s.dirty {
+		if st, ok := s.devices[id]; ok {
+			pending[id] = st.online
+		}
+	}
+	s.dirty = make(map[string]struct{})
+	s.mu.Unlock()
+
+	for id, online := range pending {
+		status := StatusOffline
+		if online {
+			status = StatusOnline
+		}
+		if err := s.mqtt.Publish(StatusTopicPrefix+id, s.qos, status); err != nil {
+			s.logger.Printf("设备状态上报失败: device_id=%s, err=%v", id, err)
+			s.mu.Lock()
+			s.dirty[id] = struct{}{}
+			s.mu.Unlock()
+		}
+	}
+}
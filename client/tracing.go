@@ -0,0 +1,128 @@
+// client/tracing.go
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName 客户端 Tracer 名称
+const tracerName = "github.com/ThingsPanel/tp-protocol-sdk-go/client"
+
+// TraceContextField MQTT消息中携带链路上下文的字段名
+const TraceContextField = "trace_context"
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// TracerProvider 为空时不产生链路数据
+	TracerProvider trace.TracerProvider
+	// Propagator 为空时使用 W3C Trace Context
+	Propagator propagation.TextMapPropagator
+	// MQTTEnvelope 为 true 时，在JSON对象类型的MQTT消息中写入 trace_context 字段，
+	// 并在收到消息时提取后移除该字段；需确保消息接收方能忽略该字段
+	MQTTEnvelope bool
+}
+
+// tracing 客户端链路追踪
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	envelope   bool
+}
+
+func newTracing(config TracingConfig) tracing {
+	tp := config.TracerProvider
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	prop := config.Propagator
+	if prop == nil {
+		prop = propagation.TraceContext{}
+	}
+	return tracing{tracer: tp.Tracer(tracerName), propagator: prop, envelope: config.MQTTEnvelope}
+}
+
+// injectEnvelope 将链路上下文写入JSON对象消息，非JSON对象消息原样返回
+func (t tracing) injectEnvelope(ctx context.Context, payload interface{}) interface{} {
+	if !t.envelope {
+		return payload
+	}
+
+	var raw []byte
+	switch p := payload.(type) {
+	case []byte:
+		raw = p
+	case string:
+		raw = []byte(p)
+	default:
+		return payload
+	}
+
+	fields, ok := decodeObject(raw)
+	if !ok {
+		return payload
+	}
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return payload
+	}
+	encoded, err := json.Marshal(carrier)
+	if err != nil {
+		return payload
+	}
+	fields[TraceContextField] = encoded
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	if _, isString := payload.(string); isString {
+		return string(out)
+	}
+	return out
+}
+
+// extractEnvelope 从消息中提取链路上下文并移除 trace_context 字段
+func (t tracing) extractEnvelope(ctx context.Context, payload []byte) (context.Context, []byte) {
+	if !t.envelope || !bytes.Contains(payload, []byte(TraceContextField)) {
+		return ctx, payload
+	}
+	fields, ok := decodeObject(payload)
+	if !ok {
+		return ctx, payload
+	}
+	rawCarrier, ok := fields[TraceContextField]
+	if !ok {
+		return ctx, payload
+	}
+
+	carrier := propagation.MapCarrier{}
+	if err := json.Unmarshal(rawCarrier, &carrier); err == nil {
+		ctx = t.propagator.Extract(ctx, carrier)
+	}
+	delete(fields, TraceContextField)
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return ctx, payload
+	}
+	return ctx, stripped
+}
+
+func decodeObject(raw []byte) (map[string]json.RawMessage, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
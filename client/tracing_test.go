@@ -0,0 +1,228 @@
+// client/tracing_test.go
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/internal/tracetest"
+)
+
+var discardLogger = log.New(io.Discard, "", 0)
+
+// loopbackMQTT 把发布的消息直接投递给同主题的订阅，记录线上的消息内容
+type loopbackMQTT struct {
+	mqtt.Client
+
+	mu        sync.Mutex
+	handlers  map[string]mqtt.MessageHandler
+	published [][]byte
+}
+
+func (l *loopbackMQTT) Publish(topic string, qos byte, _ bool, payload interface{}) mqtt.Token {
+	var raw []byte
+	switch p := payload.(type) {
+	case []byte:
+		raw = p
+	case string:
+		raw = []byte(p)
+	default:
+		raw = []byte(fmt.Sprint(p))
+	}
+	l.mu.Lock()
+	l.published = append(l.published, raw)
+	h := l.handlers[topic]
+	l.mu.Unlock()
+	if h != nil {
+		h(l, &loopbackMessage{topic: topic, qos: qos, payload: raw})
+	}
+	return &mqtt.DummyToken{}
+}
+
+func (l *loopbackMQTT) Subscribe(topic string, _ byte, callback mqtt.MessageHandler) mqtt.Token {
+	l.mu.Lock()
+	l.handlers[topic] = callback
+	l.mu.Unlock()
+	return &mqtt.DummyToken{}
+}
+
+type loopbackMessage struct {
+	topic   string
+	qos     byte
+	payload []byte
+}
+
+func (m *loopbackMessage) Duplicate() bool   { return false }
+func (m *loopbackMessage) Qos() byte         { return m.qos }
+func (m *loopbackMessage) Retained() bool    { return false }
+func (m *loopbackMessage) Topic() string     { return m.topic }
+func (m *loopbackMessage) MessageID() uint16 { return 0 }
+func (m *loopbackMessage) Payload() []byte   { return m.payload }
+func (m *loopbackMessage) Ack()              {}
+
+func newLoopbackClient(config TracingConfig) (*MQTTClient, *loopbackMQTT) {
+	m := NewMQTTClient(MQTTConfig{Tracing: config}, discardLogger)
+	broker := &loopbackMQTT{handlers: make(map[string]mqtt.MessageHandler)}
+	m.client = broker
+	m.connected.Store(true)
+	return m, broker
+}
+
+func TestTracingMQTTEnvelope(t *testing.T) {
+	tests := []struct {
+		name      string
+		envelope  bool
+		payload   interface{}
+		propagate bool // 消费者span是否应以生产者span为父span
+	}{
+		{"JSON对象", true, []byte(`{"device_id":"d1","values":{"temp":1}}`), true},
+		{"字符串JSON对象", true, `{"device_id":"d1"}`, true},
+		{"非JSON对象", true, []byte(`[1,2]`), false},
+		{"未开启信封", false, []byte(`{"device_id":"d1"}`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tracetest.NewRecorder()
+			m, broker := newLoopbackClient(TracingConfig{TracerProvider: rec, MQTTEnvelope: tt.envelope})
+
+			var (
+				gotCtx     trace.SpanContext
+				gotPayload []byte
+			)
+			err := m.SubscribeContext("plugin/test/devices/telemetry", 1, func(ctx context.Context, topic string, payload []byte) {
+				gotCtx = trace.SpanContextFromContext(ctx)
+				gotPayload = payload
+			})
+			if err != nil {
+				t.Fatalf("订阅失败: %v", err)
+			}
+
+			ctx, parent := rec.Tracer("test").Start(context.Background(), "upstream")
+			if err := m.PublishContext(ctx, "plugin/test/devices/telemetry", 1, tt.payload); err != nil {
+				t.Fatalf("发布失败: %v", err)
+			}
+			parent.End()
+
+			producers := rec.SpansByKind(trace.SpanKindProducer)
+			consumers := rec.SpansByKind(trace.SpanKindConsumer)
+			if len(producers) != 1 || len(consumers) != 1 {
+				t.Fatalf("生产者span %d 个, 消费者span %d 个, 期望各 1 个", len(producers), len(consumers))
+			}
+			producer, consumer := producers[0], consumers[0]
+			if producer.Parent.SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("生产者span的父span应为发布时 ctx 中的span")
+			}
+			if got := producer.Attribute("messaging.destination.name").AsString(); got != "plugin/test/devices/telemetry" {
+				t.Errorf("messaging.destination.name = %q", got)
+			}
+			if gotCtx.SpanID() != consumer.SpanContext.SpanID() {
+				t.Errorf("处理函数的 ctx 未携带消费者span")
+			}
+
+			wire := broker.published[0]
+			var fields map[string]json.RawMessage
+			hasEnvelope := json.Unmarshal(wire, &fields) == nil && fields[TraceContextField] != nil
+			if hasEnvelope != tt.propagate {
+				t.Fatalf("线上消息 %s 是否含 %s = %v, 期望 %v", wire, TraceContextField, hasEnvelope, tt.propagate)
+			}
+
+			if !tt.propagate {
+				if consumer.Parent.IsValid() {
+					t.Errorf("未传递链路上下文时消费者span应为根span")
+				}
+				if string(gotPayload) != string(wire) {
+					t.Errorf("处理函数收到 %s, 期望原样 %s", gotPayload, wire)
+				}
+				return
+			}
+
+			var carrier map[string]string
+			if err := json.Unmarshal(fields[TraceContextField], &carrier); err != nil {
+				t.Fatalf("解析 %s 失败: %v", TraceContextField, err)
+			}
+			want := fmt.Sprintf("00-%s-%s-01", producer.SpanContext.TraceID(), producer.SpanContext.SpanID())
+			if carrier["traceparent"] != want {
+				t.Errorf("traceparent = %q, 期望 %q", carrier["traceparent"], want)
+			}
+			if consumer.Parent.SpanID() != producer.SpanContext.SpanID() || !consumer.Parent.IsRemote() {
+				t.Errorf("消费者span的父span = %v, 期望为生产者span", consumer.Parent)
+			}
+			if consumer.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+				t.Errorf("消费者span未沿用发布方的 TraceID")
+			}
+			var received map[string]json.RawMessage
+			if err := json.Unmarshal(gotPayload, &received); err != nil {
+				t.Fatalf("处理函数收到的消息不是JSON对象: %s", gotPayload)
+			}
+			if _, ok := received[TraceContextField]; ok {
+				t.Errorf("处理函数收到的消息未移除 %s", TraceContextField)
+			}
+			if _, ok := received["device_id"]; !ok {
+				t.Errorf("处理函数收到的消息丢失了原有字段: %s", gotPayload)
+			}
+		})
+	}
+}
+
+func TestTracingAPIClientSpan(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		code   codes.Code
+	}{
+		{"成功", http.StatusOK, codes.Unset},
+		{"平台错误", http.StatusInternalServerError, codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var traceparent string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceparent = r.Header.Get("traceparent")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"code":200,"message":"success","data":{}}`))
+			}))
+			defer srv.Close()
+
+			rec := tracetest.NewRecorder()
+			api := NewDeviceAPI(NewAPIClient(srv.URL, WithLogger(discardLogger), WithTracing(TracingConfig{TracerProvider: rec})))
+			ctx, parent := rec.Tracer("test").Start(context.Background(), "upstream")
+			_, err := api.GetDeviceConfig(ctx, &DeviceConfigRequest{DeviceID: "d1"})
+			parent.End()
+			if (err != nil) != (tt.code == codes.Error) {
+				t.Fatalf("err = %v", err)
+			}
+
+			spans := rec.SpansByKind(trace.SpanKindClient)
+			if len(spans) != 1 {
+				t.Fatalf("客户端span数量 = %d, 期望 1", len(spans))
+			}
+			s := spans[0]
+			if s.Name != http.MethodPost+" "+PathDeviceConfig {
+				t.Errorf("span名称 = %q", s.Name)
+			}
+			if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("客户端span的父span应为调用时 ctx 中的span")
+			}
+			want := fmt.Sprintf("00-%s-%s-01", s.SpanContext.TraceID(), s.SpanContext.SpanID())
+			if traceparent != want {
+				t.Errorf("请求头 traceparent = %q, 期望 %q", traceparent, want)
+			}
+			if s.Status != tt.code {
+				t.Errorf("span状态 = %v, 期望 %v", s.Status, tt.code)
+			}
+		})
+	}
+}
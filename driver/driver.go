@@ -0,0 +1,40 @@
+// driver/driver.go
+
+// Package driver 定义南向协议驱动接口，并提供按设备实例化驱动、
+// 定时采集上报遥测、下发平台控制指令的运行时
+package driver
+
+import (
+	"context"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// Values 点位值，键为点位名称
+type Values map[string]interface{}
+
+// Driver 南向协议驱动，每个设备一个实例，运行时保证同一实例的方法不会并发调用
+type Driver interface {
+	// Open 建立与现场设备的连接
+	Open(ctx context.Context) error
+	// Read 读取全部点位
+	Read(ctx context.Context) (Values, error)
+	// Write 写入点位
+	Write(ctx context.Context, values Values) error
+	// Close 关闭连接
+	Close() error
+	// Health 检查设备连接状态
+	Health(ctx context.Context) error
+}
+
+// SubDeviceDriver 网关驱动可选实现的接口，用于采集和控制网关下的子设备
+type SubDeviceDriver interface {
+	Driver
+	// ReadSubDevices 读取子设备点位，键为子设备ID
+	ReadSubDevices(ctx context.Context) (map[string]Values, error)
+	// WriteSubDevice 写入子设备点位
+	WriteSubDevice(ctx context.Context, sub types.SubDevice, values Values) error
+}
+
+// Factory 根据设备信息创建驱动，驱动配置通常通过 types.DecodeConfig 从设备配置解码
+type Factory func(dev types.Device) (Driver, error)
@@ -0,0 +1,253 @@
+// driver/modbus/client.go
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 默认请求超时
+const defaultTimeout = 5 * time.Second
+
+// Client Modbus TCP 客户端，请求串行执行，并发安全
+type Client struct {
+	address string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	tid  uint16
+}
+
+// NewClient 创建客户端，address 为 host:port，timeout 为0时使用5秒
+func NewClient(address string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Client{address: address, timeout: timeout}
+}
+
+// Connect 建立连接，已连接时直接返回
+func (c *Client) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connectLocked(ctx)
+}
+
+func (c *Client) connectLocked(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return fmt.Errorf("连接Modbus设备失败: %w", err)
+	}
+	c.conn = conn
+	return nil
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Connected 是否已连接
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// ReadCoils 读线圈
+func (c *Client) ReadCoils(ctx context.Context, unit byte, address, quantity uint16) ([]bool, error) {
+	return c.readBits(ctx, unit, FuncReadCoils, address, quantity)
+}
+
+// ReadDiscreteInputs 读离散输入
+func (c *Client) ReadDiscreteInputs(ctx context.Context, unit byte, address, quantity uint16) ([]bool, error) {
+	return c.readBits(ctx, unit, FuncReadDiscreteInputs, address, quantity)
+}
+
+// ReadHoldingRegisters 读保持寄存器
+func (c *Client) ReadHoldingRegisters(ctx context.Context, unit byte, address, quantity uint16) ([]uint16, error) {
+	return c.readRegisters(ctx, unit, FuncReadHoldingRegisters, address, quantity)
+}
+
+// ReadInputRegisters 读输入寄存器
+func (c *Client) ReadInputRegisters(ctx context.Context, unit byte, address, quantity uint16) ([]uint16, error) {
+	return c.readRegisters(ctx, unit, FuncReadInputRegisters, address, quantity)
+}
+
+// WriteSingleCoil 写单个线圈
+func (c *Client) WriteSingleCoil(ctx context.Context, unit byte, address uint16, value bool) error {
+	pdu := make([]byte, 5)
+	pdu[0] = FuncWriteSingleCoil
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	if value {
+		binary.BigEndian.PutUint16(pdu[3:], 0xFF00)
+	}
+	_, err := c.do(ctx, unit, pdu, 5)
+	return err
+}
+
+// WriteSingleRegister 写单个寄存器
+func (c *Client) WriteSingleRegister(ctx context.Context, unit byte, address, value uint16) error {
+	pdu := make([]byte, 5)
+	pdu[0] = FuncWriteSingleRegister
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], value)
+	_, err := c.do(ctx, unit, pdu, 5)
+	return err
+}
+
+// WriteMultipleCoils 写多个线圈
+func (c *Client) WriteMultipleCoils(ctx context.Context, unit byte, address uint16, values []bool) error {
+	if len(values) == 0 || len(values) > maxWriteBits {
+		return fmt.Errorf("线圈数量超出范围: %d", len(values))
+	}
+	data := packBits(values)
+	pdu := make([]byte, 6+len(data))
+	pdu[0] = FuncWriteMultipleCoils
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(len(values)))
+	pdu[5] = byte(len(data))
+	copy(pdu[6:], data)
+	_, err := c.do(ctx, unit, pdu, 5)
+	return err
+}
+
+// WriteMultipleRegisters 写多个寄存器
+func (c *Client) WriteMultipleRegisters(ctx context.Context, unit byte, address uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > maxWriteRegisters {
+		return fmt.Errorf("寄存器数量超出范围: %d", len(values))
+	}
+	data := registersToBytes(values)
+	pdu := make([]byte, 6+len(data))
+	pdu[0] = FuncWriteMultipleRegisters
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(len(values)))
+	pdu[5] = byte(len(data))
+	copy(pdu[6:], data)
+	_, err := c.do(ctx, unit, pdu, 5)
+	return err
+}
+
+func (c *Client) readBits(ctx context.Context, unit, fn byte, address, quantity uint16) ([]bool, error) {
+	if quantity == 0 || quantity > maxReadBits {
+		return nil, fmt.Errorf("读取数量超出范围: %d", quantity)
+	}
+	resp, err := c.do(ctx, unit, readPDU(fn, address, quantity), 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || int(resp[1]) != (int(quantity)+7)/8 || len(resp) != 2+int(resp[1]) {
+		return nil, fmt.Errorf("modbus响应长度错误")
+	}
+	return unpackBits(resp[2:], int(quantity)), nil
+}
+
+func (c *Client) readRegisters(ctx context.Context, unit, fn byte, address, quantity uint16) ([]uint16, error) {
+	if quantity == 0 || quantity > maxReadRegisters {
+		return nil, fmt.Errorf("读取数量超出范围: %d", quantity)
+	}
+	resp, err := c.do(ctx, unit, readPDU(fn, address, quantity), 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || int(resp[1]) != int(quantity)*2 || len(resp) != 2+int(resp[1]) {
+		return nil, fmt.Errorf("modbus响应长度错误")
+	}
+	return bytesToRegisters(resp[2:]), nil
+}
+
+func readPDU(fn byte, address, quantity uint16) []byte {
+	pdu := make([]byte, 5)
+	pdu[0] = fn
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+	return pdu
+}
+
+// do 发送请求并返回响应PDU，wantLen 非0时校验响应长度；
+// 网络错误时关闭连接，下次请求重新连接
+func (c *Client) do(ctx context.Context, unit byte, pdu []byte, wantLen int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.connectLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.roundTrip(ctx, unit, pdu)
+	if err != nil {
+		if _, ok := err.(*ExceptionError); !ok {
+			c.conn.Close()
+			c.conn = nil
+		}
+		return nil, err
+	}
+	if wantLen > 0 && len(resp) != wantLen {
+		return nil, fmt.Errorf("modbus响应长度错误")
+	}
+	return resp, nil
+}
+
+func (c *Client) roundTrip(ctx context.Context, unit byte, pdu []byte) ([]byte, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	c.tid++
+	tid := c.tid
+	if _, err := c.conn.Write(encodeADU(tid, unit, pdu)); err != nil {
+		return nil, fmt.Errorf("发送modbus请求失败: %w", err)
+	}
+
+	for {
+		header := make([]byte, mbapHeaderLen+1)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return nil, fmt.Errorf("读取modbus响应失败: %w", err)
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || mbapHeaderLen+length > maxADULen {
+			return nil, fmt.Errorf("modbus响应长度错误: %d", length)
+		}
+		resp := make([]byte, length-1)
+		if _, err := io.ReadFull(c.conn, resp); err != nil {
+			return nil, fmt.Errorf("读取modbus响应失败: %w", err)
+		}
+		// 丢弃超时请求的迟到响应
+		if binary.BigEndian.Uint16(header[0:]) != tid {
+			continue
+		}
+
+		if resp[0] == pdu[0]|0x80 {
+			if len(resp) < 2 {
+				return nil, fmt.Errorf("modbus响应长度错误")
+			}
+			return nil, &ExceptionError{Function: pdu[0], Code: resp[1]}
+		}
+		if resp[0] != pdu[0] {
+			return nil, fmt.Errorf("modbus响应功能码不匹配: 0x%02X", resp[0])
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,232 @@
+// driver/modbus/codec.go
+
+package modbus
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// registerCount 数据类型占用的寄存器数量
+func registerCount(dataType string) int {
+	switch dataType {
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 2
+	case TypeInt64, TypeUint64, TypeFloat64:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// orderedBytes 按字节序和字序将寄存器转为大端字节，高位在前
+func orderedBytes(regs []uint16, byteOrder, wordOrder string) []byte {
+	out := make([]byte, 0, len(regs)*2)
+	for i := range regs {
+		r := regs[i]
+		if wordOrder == OrderLittle {
+			r = regs[len(regs)-1-i]
+		}
+		if byteOrder == OrderLittle {
+			out = append(out, byte(r), byte(r>>8))
+		} else {
+			out = append(out, byte(r>>8), byte(r))
+		}
+	}
+	return out
+}
+
+// orderedRegisters 为 orderedBytes 的逆过程
+func orderedRegisters(data []byte, byteOrder, wordOrder string) []uint16 {
+	regs := make([]uint16, len(data)/2)
+	for i := range regs {
+		hi, lo := data[i*2], data[i*2+1]
+		if byteOrder == OrderLittle {
+			hi, lo = lo, hi
+		}
+		j := i
+		if wordOrder == OrderLittle {
+			j = len(regs) - 1 - i
+		}
+		regs[j] = uint16(hi)<<8 | uint16(lo)
+	}
+	return regs
+}
+
+// decodeRegisters 按点位定义将寄存器解码为上报值，
+// 未设置倍率和偏移的整数返回 int64/uint64，否则返回 float64
+func decodeRegisters(regs []uint16, p Point) (interface{}, error) {
+	if len(regs) != registerCount(p.DataType) {
+		return nil, fmt.Errorf("点位%s寄存器数量错误", p.Name)
+	}
+	b := orderedBytes(regs, p.ByteOrder, p.WordOrder)
+
+	var f float64
+	switch p.DataType {
+	case TypeBool:
+		return binary.BigEndian.Uint16(b) != 0, nil
+	case TypeInt16:
+		f = float64(int16(binary.BigEndian.Uint16(b)))
+	case TypeUint16:
+		f = float64(binary.BigEndian.Uint16(b))
+	case TypeInt32:
+		f = float64(int32(binary.BigEndian.Uint32(b)))
+	case TypeUint32:
+		f = float64(binary.BigEndian.Uint32(b))
+	case TypeFloat32:
+		f = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case TypeInt64:
+		v := int64(binary.BigEndian.Uint64(b))
+		if unscaled(p) {
+			return v, nil
+		}
+		f = float64(v)
+	case TypeUint64:
+		v := binary.BigEndian.Uint64(b)
+		if unscaled(p) {
+			return v, nil
+		}
+		f = float64(v)
+	case TypeFloat64:
+		f = math.Float64frombits(binary.BigEndian.Uint64(b))
+	default:
+		return nil, fmt.Errorf("点位%s数据类型不支持: %s", p.Name, p.DataType)
+	}
+
+	if unscaled(p) {
+		switch p.DataType {
+		case TypeInt16, TypeInt32:
+			return int64(f), nil
+		case TypeUint16, TypeUint32:
+			return uint64(f), nil
+		}
+		return f, nil
+	}
+	return f*scale(p) + p.Offset, nil
+}
+
+func unscaled(p Point) bool {
+	return scale(p) == 1 && p.Offset == 0
+}
+
+// scale 返回点位倍率，未配置（0）时按 1 处理
+func scale(p Point) float64 {
+	if p.Scale == 0 {
+		return 1
+	}
+	return p.Scale
+}
+
+// encodeRegisters 按点位定义将写入值编码为寄存器
+func encodeRegisters(value interface{}, p Point) ([]uint16, error) {
+	if p.DataType == TypeBool {
+		b, err := toBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("点位%s: %w", p.Name, err)
+		}
+		if b {
+			return []uint16{1}, nil
+		}
+		return []uint16{0}, nil
+	}
+
+	f, err := toFloat(value)
+	if err != nil {
+		return nil, fmt.Errorf("点位%s: %w", p.Name, err)
+	}
+	if !unscaled(p) {
+		f = (f - p.Offset) / scale(p)
+	}
+
+	b := make([]byte, registerCount(p.DataType)*2)
+	switch p.DataType {
+	case TypeInt16:
+		if err := checkRange(p, f, math.MinInt16, math.MaxInt16); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint16(b, uint16(int16(math.Round(f))))
+	case TypeUint16:
+		if err := checkRange(p, f, 0, math.MaxUint16); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint16(b, uint16(math.Round(f)))
+	case TypeInt32:
+		if err := checkRange(p, f, math.MinInt32, math.MaxInt32); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(b, uint32(int32(math.Round(f))))
+	case TypeUint32:
+		if err := checkRange(p, f, 0, math.MaxUint32); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(b, uint32(math.Round(f)))
+	case TypeFloat32:
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+	case TypeInt64:
+		if err := checkRange(p, f, math.MinInt64, math.MaxInt64); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint64(b, uint64(int64(math.Round(f))))
+	case TypeUint64:
+		if err := checkRange(p, f, 0, math.MaxUint64); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint64(b, uint64(math.Round(f)))
+	case TypeFloat64:
+		binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	default:
+		return nil, fmt.Errorf("点位%s数据类型不支持: %s", p.Name, p.DataType)
+	}
+	return orderedRegisters(b, p.ByteOrder, p.WordOrder), nil
+}
+
+func checkRange(p Point, f, min, max float64) error {
+	if math.IsNaN(f) || math.Round(f) < min || math.Round(f) > max {
+		return fmt.Errorf("点位%s写入值超出%s范围: %v", p.Name, p.DataType, f)
+	}
+	return nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case uint64:
+		return float64(x), nil
+	case json.Number:
+		return x.Float64()
+	case string:
+		return strconv.ParseFloat(x, 64)
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("写入值类型不支持: %T", v)
+	}
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		return strconv.ParseBool(x)
+	default:
+		f, err := toFloat(v)
+		if err != nil {
+			return false, err
+		}
+		return f != 0, nil
+	}
+}
@@ -0,0 +1,75 @@
+// driver/modbus/config.go
+
+package modbus
+
+import (
+	"time"
+)
+
+// 功能区，对应读取功能码
+const (
+	AreaCoils            = 1 // 线圈，可读写
+	AreaDiscreteInputs   = 2 // 离散输入，只读
+	AreaHoldingRegisters = 3 // 保持寄存器，可读写
+	AreaInputRegisters   = 4 // 输入寄存器，只读
+)
+
+// 数据类型
+const (
+	TypeBool    = "bool"
+	TypeInt16   = "int16"
+	TypeUint16  = "uint16"
+	TypeInt32   = "int32"
+	TypeUint32  = "uint32"
+	TypeFloat32 = "float32"
+	TypeInt64   = "int64"
+	TypeUint64  = "uint64"
+	TypeFloat64 = "float64"
+)
+
+// 字节序与字序
+const (
+	OrderBig    = "big"
+	OrderLittle = "little"
+)
+
+// Config 设备配置，从 Device.Config 与 ProtocolConfigTemplate 合并后解码，
+// 可用 form.FromStruct(modbus.Config{}) 生成配置表单
+type Config struct {
+	Address string        `json:"address" label:"设备地址" placeholder:"192.168.1.10:502" binding:"required"`
+	UnitID  int           `json:"unit_id" label:"从站地址" default:"1" binding:"min=0,max=255"`
+	Timeout time.Duration `json:"timeout" label:"超时时间" default:"5s"`
+	Points  []Point       `json:"points" label:"点位表"`
+}
+
+// SubDeviceConfig 子设备配置，未配置点位时使用网关的点位表，
+// 从站地址取自 SubDevice.SubDeviceAddr
+type SubDeviceConfig struct {
+	Points []Point `json:"points" label:"点位表"`
+}
+
+// Point 点位定义，上报值 = 原始值 * scale + offset，写入时反向换算
+type Point struct {
+	Name      string  `json:"name" label:"点位名称" binding:"required"`
+	Area      int     `json:"area" label:"功能区" default:"3" options:"1:线圈,2:离散输入,3:保持寄存器,4:输入寄存器" binding:"oneof=1 2 3 4"`
+	Address   int     `json:"address" label:"起始地址" binding:"min=0,max=65535"`
+	DataType  string  `json:"data_type" label:"数据类型" default:"uint16" binding:"oneof=bool int16 uint16 int32 uint32 float32 int64 uint64 float64"`
+	ByteOrder string  `json:"byte_order" label:"字节序" default:"big" options:"big:大端,little:小端" binding:"oneof=big little"`
+	WordOrder string  `json:"word_order" label:"字序" default:"big" options:"big:高字在前,little:低字在前" binding:"oneof=big little"`
+	Scale     float64 `json:"scale" label:"倍率" default:"1"`
+	Offset    float64 `json:"offset" label:"偏移"`
+	ReadOnly  bool    `json:"read_only" label:"只读"`
+}
+
+// registers 点位占用的寄存器或位数量
+func (p Point) registers() int {
+	if p.Area == AreaCoils || p.Area == AreaDiscreteInputs {
+		return 1
+	}
+	return registerCount(p.DataType)
+}
+
+// writable 点位是否可写
+func (p Point) writable() bool {
+	return !p.ReadOnly && (p.Area == AreaCoils || p.Area == AreaHoldingRegisters)
+}
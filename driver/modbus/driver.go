@@ -0,0 +1,271 @@
+// driver/modbus/driver.go
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// 合并读取时允许跨越的最大空闲地址数
+const maxReadGap = 8
+
+// unitPoints 一个从站的点位表
+type unitPoints struct {
+	sub    types.SubDevice
+	unit   byte
+	points []Point
+}
+
+// Driver Modbus TCP 驱动，网关设备的子设备以 SubDeviceAddr 作为从站地址
+type Driver struct {
+	client *Client
+	self   unitPoints
+	subs   map[string]unitPoints // 子设备ID -> 点位表
+}
+
+var _ driver.SubDeviceDriver = (*Driver)(nil)
+
+// New 根据设备配置创建驱动，可直接作为 driver.RuntimeConfig 的 Factory
+func New(dev types.Device) (driver.Driver, error) {
+	cfg, err := types.DecodeConfig[Config](dev)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Driver{
+		client: NewClient(cfg.Address, cfg.Timeout),
+		self:   unitPoints{unit: byte(cfg.UnitID), points: cfg.Points},
+		subs:   make(map[string]unitPoints, len(dev.SubDevices)),
+	}
+	for _, sub := range dev.SubDevices {
+		unit, err := strconv.ParseUint(sub.SubDeviceAddr, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("子设备地址无效: device_id=%s, sub_device_addr=%s", sub.DeviceID, sub.SubDeviceAddr)
+		}
+		subCfg, err := types.DecodeSubDeviceConfig[SubDeviceConfig](sub)
+		if err != nil {
+			return nil, err
+		}
+		points := subCfg.Points
+		if len(points) == 0 {
+			points = cfg.Points
+		}
+		d.subs[sub.DeviceID] = unitPoints{sub: sub, unit: byte(unit), points: points}
+	}
+	return d, nil
+}
+
+// Client 返回底层 Modbus 客户端
+func (d *Driver) Client() *Client {
+	return d.client
+}
+
+// Open 连接设备
+func (d *Driver) Open(ctx context.Context) error {
+	return d.client.Connect(ctx)
+}
+
+// Close 关闭连接
+func (d *Driver) Close() error {
+	return d.client.Close()
+}
+
+// Health 连接断开时返回错误
+func (d *Driver) Health(context.Context) error {
+	if !d.client.Connected() {
+		return errors.New("Modbus设备未连接")
+	}
+	return nil
+}
+
+// Read 读取设备点位
+func (d *Driver) Read(ctx context.Context) (driver.Values, error) {
+	return d.readUnit(ctx, d.self)
+}
+
+// ReadSubDevices 读取全部子设备点位
+func (d *Driver) ReadSubDevices(ctx context.Context) (map[string]driver.Values, error) {
+	out := make(map[string]driver.Values, len(d.subs))
+	for id, up := range d.subs {
+		values, err := d.readUnit(ctx, up)
+		if err != nil {
+			return nil, fmt.Errorf("读取子设备失败: device_id=%s, %w", id, err)
+		}
+		out[id] = values
+	}
+	return out, nil
+}
+
+// Write 写入设备点位
+func (d *Driver) Write(ctx context.Context, values driver.Values) error {
+	return d.writeUnit(ctx, d.self, values)
+}
+
+// WriteSubDevice 写入子设备点位
+func (d *Driver) WriteSubDevice(ctx context.Context, sub types.SubDevice, values driver.Values) error {
+	up, ok := d.subs[sub.DeviceID]
+	if !ok {
+		return fmt.Errorf("子设备不存在: device_id=%s", sub.DeviceID)
+	}
+	return d.writeUnit(ctx, up, values)
+}
+
+// block 一次合并读取的地址区间
+type block struct {
+	area   int
+	start  int
+	end    int // 不含
+	points []Point
+}
+
+// planBlocks 将同一功能区的相邻点位合并为批量读取区间
+func planBlocks(points []Point) []block {
+	sorted := append([]Point(nil), points...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Area != sorted[j].Area {
+			return sorted[i].Area < sorted[j].Area
+		}
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	var blocks []block
+	for _, p := range sorted {
+		end := p.Address + p.registers()
+		limit := maxReadRegisters
+		if p.Area == AreaCoils || p.Area == AreaDiscreteInputs {
+			limit = maxReadBits
+		}
+		if n := len(blocks); n > 0 {
+			b := &blocks[n-1]
+			if b.area == p.Area && p.Address <= b.end+maxReadGap && max(end, b.end)-b.start <= limit {
+				b.end = max(end, b.end)
+				b.points = append(b.points, p)
+				continue
+			}
+		}
+		blocks = append(blocks, block{area: p.Area, start: p.Address, end: end, points: []Point{p}})
+	}
+	return blocks
+}
+
+// readUnit 读取一个从站的全部点位；区间读取返回异常时逐点读取，跳过读取失败的点位
+func (d *Driver) readUnit(ctx context.Context, up unitPoints) (driver.Values, error) {
+	values := make(driver.Values, len(up.points))
+	for _, b := range planBlocks(up.points) {
+		err := d.readBlock(ctx, up.unit, b, values)
+		if err == nil {
+			continue
+		}
+		var exc *ExceptionError
+		if !errors.As(err, &exc) {
+			return nil, err
+		}
+		var lastErr error
+		for _, p := range b.points {
+			single := block{area: p.Area, start: p.Address, end: p.Address + p.registers(), points: []Point{p}}
+			if err := d.readBlock(ctx, up.unit, single, values); err != nil {
+				if !errors.As(err, &exc) {
+					return nil, err
+				}
+				lastErr = err
+			}
+		}
+		if len(values) == 0 && lastErr != nil {
+			return nil, lastErr
+		}
+	}
+	return values, nil
+}
+
+func (d *Driver) readBlock(ctx context.Context, unit byte, b block, values driver.Values) error {
+	start, qty := uint16(b.start), uint16(b.end-b.start)
+	switch b.area {
+	case AreaCoils, AreaDiscreteInputs:
+		read := d.client.ReadCoils
+		if b.area == AreaDiscreteInputs {
+			read = d.client.ReadDiscreteInputs
+		}
+		bits, err := read(ctx, unit, start, qty)
+		if err != nil {
+			return err
+		}
+		for _, p := range b.points {
+			values[p.Name] = bits[p.Address-b.start]
+		}
+	case AreaHoldingRegisters, AreaInputRegisters:
+		read := d.client.ReadHoldingRegisters
+		if b.area == AreaInputRegisters {
+			read = d.client.ReadInputRegisters
+		}
+		regs, err := read(ctx, unit, start, qty)
+		if err != nil {
+			return err
+		}
+		for _, p := range b.points {
+			off := p.Address - b.start
+			v, err := decodeRegisters(regs[off:off+p.registers()], p)
+			if err != nil {
+				return err
+			}
+			values[p.Name] = v
+		}
+	default:
+		return fmt.Errorf("功能区不支持: %d", b.area)
+	}
+	return nil
+}
+
+// writeUnit 按点位名称写入，点位按名称顺序依次写入
+func (d *Driver) writeUnit(ctx context.Context, up unitPoints, values driver.Values) error {
+	byName := make(map[string]Point, len(up.points))
+	for _, p := range up.points {
+		byName[p.Name] = p
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("点位不存在: %s", name)
+		}
+		if !p.writable() {
+			return fmt.Errorf("点位不可写: %s", name)
+		}
+		if err := d.writePoint(ctx, up.unit, p, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) writePoint(ctx context.Context, unit byte, p Point, value interface{}) error {
+	addr := uint16(p.Address)
+	if p.Area == AreaCoils {
+		b, err := toBool(value)
+		if err != nil {
+			return fmt.Errorf("点位%s: %w", p.Name, err)
+		}
+		return d.client.WriteSingleCoil(ctx, unit, addr, b)
+	}
+
+	regs, err := encodeRegisters(value, p)
+	if err != nil {
+		return err
+	}
+	if len(regs) == 1 {
+		return d.client.WriteSingleRegister(ctx, unit, addr, regs[0])
+	}
+	return d.client.WriteMultipleRegisters(ctx, unit, addr, regs)
+}
@@ -0,0 +1,391 @@
+// driver/modbus/driver_test.go
+
+package modbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	srv := NewServer()
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("启动服务端失败: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// configMap 将配置结构体转为设备配置map，与平台下发的配置经过相同的解码
+func configMap(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func openDriver(t *testing.T, dev types.Device) *Driver {
+	t.Helper()
+	drv, err := New(dev)
+	if err != nil {
+		t.Fatalf("创建驱动失败: %v", err)
+	}
+	if err := drv.Open(context.Background()); err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	t.Cleanup(func() { drv.Close() })
+	return drv.(*Driver)
+}
+
+func newDriver(t *testing.T, srv *Server, points ...Point) *Driver {
+	t.Helper()
+	return openDriver(t, types.Device{
+		ID:     "dev",
+		Config: configMap(t, Config{Address: srv.Addr(), UnitID: 1, Points: points}),
+	})
+}
+
+// point 大端、无倍率的点位
+func point(name string, area, address int, dataType string) Point {
+	return Point{Name: name, Area: area, Address: address, DataType: dataType, ByteOrder: OrderBig, WordOrder: OrderBig}
+}
+
+func equalValue(got, want interface{}) bool {
+	if g, ok := got.(float64); ok {
+		if w, ok := want.(float64); ok {
+			return math.Abs(g-w) < 1e-9
+		}
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestDriverReadFunctionCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(s *Server)
+		point Point
+		want  interface{}
+	}{
+		{"01读线圈", func(s *Server) { s.SetCoils(1, 10, true) }, point("v", AreaCoils, 10, TypeBool), true},
+		{"02读离散输入", func(s *Server) { s.SetDiscreteInputs(1, 20, true) }, point("v", AreaDiscreteInputs, 20, TypeBool), true},
+		{"03读保持寄存器", func(s *Server) { s.SetHoldingRegisters(1, 30, 1234) }, point("v", AreaHoldingRegisters, 30, TypeUint16), uint64(1234)},
+		{"04读输入寄存器", func(s *Server) { s.SetInputRegisters(1, 40, 4321) }, point("v", AreaInputRegisters, 40, TypeUint16), uint64(4321)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startServer(t)
+			tt.setup(srv)
+			d := newDriver(t, srv, tt.point)
+			values, err := d.Read(context.Background())
+			if err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+			if !equalValue(values["v"], tt.want) {
+				t.Errorf("v = %#v, 期望 %#v", values["v"], tt.want)
+			}
+		})
+	}
+}
+
+func TestDriverBatchRead(t *testing.T) {
+	srv := startServer(t)
+	srv.SetHoldingRegisters(1, 0, 1, 2, 0, 0, 0, 3)
+	srv.SetCoils(1, 0, true, false, true)
+	d := newDriver(t, srv,
+		point("a", AreaHoldingRegisters, 0, TypeUint16),
+		point("b", AreaHoldingRegisters, 1, TypeUint16),
+		point("c", AreaHoldingRegisters, 5, TypeUint16),
+		point("x", AreaCoils, 0, TypeBool),
+		point("y", AreaCoils, 2, TypeBool),
+	)
+	values, err := d.Read(context.Background())
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	want := driver.Values{"a": uint64(1), "b": uint64(2), "c": uint64(3), "x": true, "y": true}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, 期望 %v", values, want)
+	}
+}
+
+// 数据类型的寄存器布局，写入同一个值时应得到相同的寄存器
+func TestDriverDataTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		point Point
+		regs  []uint16
+		value interface{}
+	}{
+		{"bool", point("v", AreaHoldingRegisters, 0, TypeBool), []uint16{1}, true},
+		{"int16负数", point("v", AreaHoldingRegisters, 0, TypeInt16), []uint16{0xFFFE}, int64(-2)},
+		{"uint16", point("v", AreaHoldingRegisters, 0, TypeUint16), []uint16{0xFFFF}, uint64(65535)},
+		{"int32大端", point("v", AreaHoldingRegisters, 0, TypeInt32), []uint16{0xFFFE, 0x7960}, int64(-100000)},
+		{"int32低字在前", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeInt32, ByteOrder: OrderBig, WordOrder: OrderLittle},
+			[]uint16{0x7960, 0xFFFE}, int64(-100000)},
+		{"uint32小端字节", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeUint32, ByteOrder: OrderLittle, WordOrder: OrderBig},
+			[]uint16{0x3412, 0x7856}, uint64(0x12345678)},
+		{"uint32小端字节低字在前", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeUint32, ByteOrder: OrderLittle, WordOrder: OrderLittle},
+			[]uint16{0x7856, 0x3412}, uint64(0x12345678)},
+		{"float32", point("v", AreaHoldingRegisters, 0, TypeFloat32), []uint16{0x3FC0, 0x0000}, 1.5},
+		{"float32低字在前", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeFloat32, ByteOrder: OrderBig, WordOrder: OrderLittle},
+			[]uint16{0x0000, 0x3FC0}, 1.5},
+		{"int64", point("v", AreaHoldingRegisters, 0, TypeInt64), []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}, int64(-1)},
+		{"uint64", point("v", AreaHoldingRegisters, 0, TypeUint64), []uint16{0x0001, 0x0002, 0x0003, 0x0004}, uint64(0x0001000200030004)},
+		{"float64", point("v", AreaHoldingRegisters, 0, TypeFloat64), []uint16{0xC002, 0, 0, 0}, -2.25},
+		{"int16倍率偏移", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeInt16, ByteOrder: OrderBig, WordOrder: OrderBig, Scale: 0.1, Offset: -40},
+			[]uint16{655}, 25.5},
+		{"uint32倍率", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeUint32, ByteOrder: OrderBig, WordOrder: OrderLittle, Scale: 0.01},
+			[]uint16{0x86A0, 0x0001}, 1000.0},
+		{"未配置倍率只有偏移", Point{Name: "v", Area: AreaHoldingRegisters, DataType: TypeInt16, ByteOrder: OrderBig, WordOrder: OrderBig, Offset: 10},
+			[]uint16{5}, 15.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startServer(t)
+			d := newDriver(t, srv, tt.point)
+
+			srv.SetHoldingRegisters(1, 0, tt.regs...)
+			values, err := d.Read(context.Background())
+			if err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+			if !equalValue(values["v"], tt.value) {
+				t.Errorf("读取 v = %#v, 期望 %#v", values["v"], tt.value)
+			}
+
+			srv.SetHoldingRegisters(1, 0, make([]uint16, len(tt.regs))...)
+			if err := d.Write(context.Background(), driver.Values{"v": tt.value}); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			if got := srv.HoldingRegisters(1, 0, uint16(len(tt.regs))); !reflect.DeepEqual(got, tt.regs) {
+				t.Errorf("写入后寄存器 = %#04x, 期望 %#04x", got, tt.regs)
+			}
+		})
+	}
+}
+
+func TestDriverWrite(t *testing.T) {
+	points := []Point{
+		point("switch", AreaCoils, 3, TypeBool),
+		point("setpoint", AreaHoldingRegisters, 10, TypeInt16),
+		point("target", AreaHoldingRegisters, 20, TypeFloat32),
+		point("status", AreaInputRegisters, 0, TypeUint16),
+		point("alarm", AreaDiscreteInputs, 0, TypeBool),
+		{Name: "locked", Area: AreaHoldingRegisters, Address: 30, DataType: TypeUint16, ByteOrder: OrderBig, WordOrder: OrderBig, ReadOnly: true},
+	}
+	tests := []struct {
+		name    string
+		values  driver.Values
+		wantErr bool
+		check   func(t *testing.T, s *Server)
+	}{
+		{"05写单个线圈", driver.Values{"switch": true}, false, func(t *testing.T, s *Server) {
+			if !s.Coils(1, 3, 1)[0] {
+				t.Errorf("线圈未写入")
+			}
+		}},
+		{"线圈字符串值", driver.Values{"switch": "true"}, false, func(t *testing.T, s *Server) {
+			if !s.Coils(1, 3, 1)[0] {
+				t.Errorf("线圈未写入")
+			}
+		}},
+		{"06写单个寄存器", driver.Values{"setpoint": -5}, false, func(t *testing.T, s *Server) {
+			if got := s.HoldingRegisters(1, 10, 1)[0]; got != 0xFFFB {
+				t.Errorf("寄存器 = %#04x", got)
+			}
+		}},
+		{"16写多个寄存器", driver.Values{"target": json.Number("1.5")}, false, func(t *testing.T, s *Server) {
+			if got := s.HoldingRegisters(1, 20, 2); !reflect.DeepEqual(got, []uint16{0x3FC0, 0}) {
+				t.Errorf("寄存器 = %#04x", got)
+			}
+		}},
+		{"超出范围", driver.Values{"setpoint": 40000}, true, nil},
+		{"只读点位", driver.Values{"locked": 1}, true, nil},
+		{"输入寄存器不可写", driver.Values{"status": 1}, true, nil},
+		{"离散输入不可写", driver.Values{"alarm": true}, true, nil},
+		{"点位不存在", driver.Values{"missing": 1}, true, nil},
+		{"值类型不支持", driver.Values{"setpoint": []int{1}}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startServer(t)
+			d := newDriver(t, srv, points...)
+			err := d.Write(context.Background(), tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, 期望出错 %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, srv)
+			}
+		})
+	}
+}
+
+func TestClientWriteMultipleCoils(t *testing.T) {
+	srv := startServer(t)
+	c := NewClient(srv.Addr(), 0)
+	defer c.Close()
+	values := []bool{true, false, true, true, false, false, true, false, true}
+	if err := c.WriteMultipleCoils(context.Background(), 1, 100, values); err != nil {
+		t.Fatalf("写多个线圈失败: %v", err)
+	}
+	if got := srv.Coils(1, 100, uint16(len(values))); !reflect.DeepEqual(got, values) {
+		t.Errorf("线圈 = %v, 期望 %v", got, values)
+	}
+	got, err := c.ReadCoils(context.Background(), 1, 100, uint16(len(values)))
+	if err != nil {
+		t.Fatalf("读线圈失败: %v", err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("读回 = %v, 期望 %v", got, values)
+	}
+}
+
+func TestClientExceptions(t *testing.T) {
+	srv := startServer(t)
+	c := NewClient(srv.Addr(), 0)
+	defer c.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		fn   byte
+		code byte
+	}{
+		{"非法功能码", func() error {
+			_, err := c.do(ctx, 1, []byte{0x2B, 0, 0, 0, 1}, 0)
+			return err
+		}, 0x2B, ExceptionIllegalFunction},
+		{"读线圈越界", func() error {
+			_, err := c.ReadCoils(ctx, 1, 65535, 2)
+			return err
+		}, FuncReadCoils, ExceptionIllegalDataAddress},
+		{"读保持寄存器越界", func() error {
+			_, err := c.ReadHoldingRegisters(ctx, 1, 65535, 2)
+			return err
+		}, FuncReadHoldingRegisters, ExceptionIllegalDataAddress},
+		// 客户端会先校验读取数量，直接发送请求PDU检查服务端
+		{"读数量为0", func() error {
+			_, err := c.do(ctx, 1, readPDU(FuncReadInputRegisters, 0, 0), 0)
+			return err
+		}, FuncReadInputRegisters, ExceptionIllegalDataValue},
+		{"读数量超限", func() error {
+			_, err := c.do(ctx, 1, readPDU(FuncReadDiscreteInputs, 0, maxReadBits+1), 0)
+			return err
+		}, FuncReadDiscreteInputs, ExceptionIllegalDataValue},
+		{"写单个线圈值非法", func() error {
+			_, err := c.do(ctx, 1, []byte{FuncWriteSingleCoil, 0, 0, 0x12, 0x34}, 0)
+			return err
+		}, FuncWriteSingleCoil, ExceptionIllegalDataValue},
+		{"写多个寄存器越界", func() error {
+			return c.WriteMultipleRegisters(ctx, 1, 65535, []uint16{1, 2})
+		}, FuncWriteMultipleRegisters, ExceptionIllegalDataAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var exc *ExceptionError
+			if !errors.As(err, &exc) {
+				t.Fatalf("err = %v, 期望异常响应", err)
+			}
+			if exc.Function != tt.fn || exc.Code != tt.code {
+				t.Errorf("异常 function=0x%02X code=0x%02X, 期望 function=0x%02X code=0x%02X", exc.Function, exc.Code, tt.fn, tt.code)
+			}
+			// 异常响应不断开连接
+			if !c.Connected() {
+				t.Errorf("异常响应后连接被关闭")
+			}
+		})
+	}
+}
+
+// 合并读取返回异常时逐点读取，跳过失败的点位
+func TestDriverReadExceptionFallback(t *testing.T) {
+	srv := startServer(t)
+	srv.SetHoldingRegisters(1, 65530, 7)
+	d := newDriver(t, srv,
+		point("ok", AreaHoldingRegisters, 65530, TypeUint16),
+		point("overflow", AreaHoldingRegisters, 65535, TypeUint32),
+	)
+	values, err := d.Read(context.Background())
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if !reflect.DeepEqual(values, driver.Values{"ok": uint64(7)}) {
+		t.Errorf("values = %v", values)
+	}
+
+	d = newDriver(t, srv, point("overflow", AreaHoldingRegisters, 65535, TypeUint32))
+	var exc *ExceptionError
+	if _, err := d.Read(context.Background()); !errors.As(err, &exc) || exc.Code != ExceptionIllegalDataAddress {
+		t.Errorf("全部点位失败时 err = %v, 期望非法地址异常", err)
+	}
+}
+
+func TestDriverSubDeviceUnitID(t *testing.T) {
+	srv := startServer(t)
+	gatewayPoints := []Point{point("temp", AreaHoldingRegisters, 0, TypeUint16)}
+	ownPoints := []Point{point("humidity", AreaInputRegisters, 5, TypeUint16), point("fan", AreaCoils, 1, TypeBool)}
+
+	srv.SetHoldingRegisters(1, 0, 11)
+	srv.SetHoldingRegisters(7, 0, 22)
+	srv.SetInputRegisters(9, 5, 33)
+
+	d := openDriver(t, types.Device{
+		ID:     "gw",
+		Config: configMap(t, Config{Address: srv.Addr(), UnitID: 1, Points: gatewayPoints}),
+		SubDevices: []types.SubDevice{
+			{DeviceID: "s7", SubDeviceAddr: "7"},
+			{DeviceID: "s9", SubDeviceAddr: "9", Config: configMap(t, SubDeviceConfig{Points: ownPoints})},
+		},
+	})
+
+	values, err := d.Read(context.Background())
+	if err != nil || values["temp"] != uint64(11) {
+		t.Fatalf("网关读取 = %v, err = %v", values, err)
+	}
+	subs, err := d.ReadSubDevices(context.Background())
+	if err != nil {
+		t.Fatalf("读取子设备失败: %v", err)
+	}
+	want := map[string]driver.Values{
+		"s7": {"temp": uint64(22)},
+		"s9": {"humidity": uint64(33), "fan": false},
+	}
+	if !reflect.DeepEqual(subs, want) {
+		t.Errorf("子设备 = %v, 期望 %v", subs, want)
+	}
+
+	if err := d.WriteSubDevice(context.Background(), types.SubDevice{DeviceID: "s9"}, driver.Values{"fan": true}); err != nil {
+		t.Fatalf("写入子设备失败: %v", err)
+	}
+	if !srv.Coils(9, 1, 1)[0] || srv.Coils(1, 1, 1)[0] {
+		t.Errorf("子设备写入应使用从站地址9")
+	}
+	if err := d.WriteSubDevice(context.Background(), types.SubDevice{DeviceID: "missing"}, driver.Values{"fan": true}); err == nil {
+		t.Errorf("不存在的子设备应返回错误")
+	}
+
+	_, err = New(types.Device{
+		Config:     configMap(t, Config{Address: srv.Addr()}),
+		SubDevices: []types.SubDevice{{DeviceID: "bad", SubDeviceAddr: "300"}},
+	})
+	if err == nil {
+		t.Errorf("子设备地址超出从站范围时应返回错误")
+	}
+}
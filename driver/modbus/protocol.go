@@ -0,0 +1,119 @@
+// driver/modbus/protocol.go
+
+// Package modbus 提供 Modbus TCP 客户端、按设备配置点位表采集的驱动，
+// 以及用于测试和调试的进程内 Modbus TCP 服务端
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 功能码
+const (
+	FuncReadCoils              byte = 0x01
+	FuncReadDiscreteInputs     byte = 0x02
+	FuncReadHoldingRegisters   byte = 0x03
+	FuncReadInputRegisters     byte = 0x04
+	FuncWriteSingleCoil        byte = 0x05
+	FuncWriteSingleRegister    byte = 0x06
+	FuncWriteMultipleCoils     byte = 0x0F
+	FuncWriteMultipleRegisters byte = 0x10
+)
+
+// 异常码
+const (
+	ExceptionIllegalFunction    byte = 0x01
+	ExceptionIllegalDataAddress byte = 0x02
+	ExceptionIllegalDataValue   byte = 0x03
+	ExceptionServerDeviceFailed byte = 0x04
+)
+
+// 单次请求数量上限
+const (
+	maxReadBits       = 2000
+	maxReadRegisters  = 125
+	maxWriteBits      = 1968
+	maxWriteRegisters = 123
+)
+
+// MBAP报文头长度，不含单元标识
+const mbapHeaderLen = 6
+
+// 报文最大长度
+const maxADULen = 260
+
+// ExceptionError 设备返回的异常响应
+type ExceptionError struct {
+	Function byte // 请求的功能码
+	Code     byte // 异常码
+}
+
+// Error 实现 error 接口
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus异常响应: function=0x%02X, code=0x%02X(%s)", e.Function, e.Code, exceptionText(e.Code))
+}
+
+func exceptionText(code byte) string {
+	switch code {
+	case ExceptionIllegalFunction:
+		return "非法功能码"
+	case ExceptionIllegalDataAddress:
+		return "非法数据地址"
+	case ExceptionIllegalDataValue:
+		return "非法数据值"
+	case ExceptionServerDeviceFailed:
+		return "从站设备故障"
+	default:
+		return "未知异常"
+	}
+}
+
+// encodeADU 组装 MBAP 报文
+func encodeADU(tid uint16, unit byte, pdu []byte) []byte {
+	adu := make([]byte, mbapHeaderLen+1+len(pdu))
+	binary.BigEndian.PutUint16(adu[0:], tid)
+	binary.BigEndian.PutUint16(adu[2:], 0) // 协议标识，Modbus 固定为0
+	binary.BigEndian.PutUint16(adu[4:], uint16(1+len(pdu)))
+	adu[6] = unit
+	copy(adu[7:], pdu)
+	return adu
+}
+
+// packBits 将布尔值按 Modbus 规则打包，低位在前
+func packBits(values []bool) []byte {
+	out := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			out[i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	return out
+}
+
+// unpackBits 解包布尔值
+func unpackBits(data []byte, quantity int) []bool {
+	out := make([]bool, quantity)
+	for i := range out {
+		out[i] = data[i/8]&(1<<(uint(i)%8)) != 0
+	}
+	return out
+}
+
+// registersToBytes 寄存器转为大端字节
+func registersToBytes(regs []uint16) []byte {
+	out := make([]byte, len(regs)*2)
+	for i, r := range regs {
+		binary.BigEndian.PutUint16(out[i*2:], r)
+	}
+	return out
+}
+
+// bytesToRegisters 大端字节转为寄存器
+func bytesToRegisters(data []byte) []uint16 {
+	out := make([]uint16, len(data)/2)
+	for i := range out {
+		out[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return out
+}
@@ -0,0 +1,283 @@
+// driver/modbus/server.go
+
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+)
+
+// 每个功能区的地址数量
+const areaSize = 65536
+
+// unitData 一个从站的数据区
+type unitData struct {
+	coils    []bool
+	discrete []bool
+	holding  []uint16
+	input    []uint16
+}
+
+func newUnitData() *unitData {
+	return &unitData{
+		coils:    make([]bool, areaSize),
+		discrete: make([]bool, areaSize),
+		holding:  make([]uint16, areaSize),
+		input:    make([]uint16, areaSize),
+	}
+}
+
+// Server 进程内 Modbus TCP 服务端，用于测试和调试驱动，
+// 每个从站地址有独立的数据区，首次访问时创建
+type Server struct {
+	mu    sync.Mutex
+	units map[byte]*unitData
+
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// NewServer 创建服务端
+func NewServer() *Server {
+	return &Server{units: make(map[byte]*unitData), conns: make(map[net.Conn]struct{})}
+}
+
+// Listen 监听地址并在后台处理连接，address 为 "127.0.0.1:0" 时使用随机端口
+func (s *Server) Listen(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serve(ln)
+	}()
+	return nil
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Close 停止监听并关闭全部连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// SetCoils 设置线圈
+func (s *Server) SetCoils(unit byte, address uint16, values ...bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.unitLocked(unit).coils[address:], values)
+}
+
+// SetDiscreteInputs 设置离散输入
+func (s *Server) SetDiscreteInputs(unit byte, address uint16, values ...bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.unitLocked(unit).discrete[address:], values)
+}
+
+// SetHoldingRegisters 设置保持寄存器
+func (s *Server) SetHoldingRegisters(unit byte, address uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.unitLocked(unit).holding[address:], values)
+}
+
+// SetInputRegisters 设置输入寄存器
+func (s *Server) SetInputRegisters(unit byte, address uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.unitLocked(unit).input[address:], values)
+}
+
+// Coils 读取线圈
+func (s *Server) Coils(unit byte, address, quantity uint16) []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bool(nil), s.unitLocked(unit).coils[address:int(address)+int(quantity)]...)
+}
+
+// HoldingRegisters 读取保持寄存器
+func (s *Server) HoldingRegisters(unit byte, address, quantity uint16) []uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint16(nil), s.unitLocked(unit).holding[address:int(address)+int(quantity)]...)
+}
+
+func (s *Server) unitLocked(unit byte) *unitData {
+	u, ok := s.units[unit]
+	if !ok {
+		u = newUnitData()
+		s.units[unit] = u
+	}
+	return u
+}
+
+func (s *Server) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	header := make([]byte, mbapHeaderLen+1)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || mbapHeaderLen+length > maxADULen {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		resp := s.handle(header[6], pdu)
+		if _, err := conn.Write(encodeADU(binary.BigEndian.Uint16(header[0:]), header[6], resp)); err != nil {
+			return
+		}
+	}
+}
+
+// handle 处理请求PDU，返回响应PDU
+func (s *Server) handle(unit byte, pdu []byte) []byte {
+	fn := pdu[0]
+	resp, code := s.execute(unit, pdu)
+	if code != 0 {
+		return []byte{fn | 0x80, code}
+	}
+	return resp
+}
+
+func (s *Server) execute(unit byte, pdu []byte) ([]byte, byte) {
+	if len(pdu) < 5 {
+		return nil, ExceptionIllegalDataValue
+	}
+	fn := pdu[0]
+	addr := int(binary.BigEndian.Uint16(pdu[1:]))
+	arg := int(binary.BigEndian.Uint16(pdu[3:]))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.unitLocked(unit)
+
+	switch fn {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		if arg < 1 || arg > maxReadBits {
+			return nil, ExceptionIllegalDataValue
+		}
+		if addr+arg > areaSize {
+			return nil, ExceptionIllegalDataAddress
+		}
+		src := u.coils
+		if fn == FuncReadDiscreteInputs {
+			src = u.discrete
+		}
+		data := packBits(src[addr : addr+arg])
+		return append([]byte{fn, byte(len(data))}, data...), 0
+
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		if arg < 1 || arg > maxReadRegisters {
+			return nil, ExceptionIllegalDataValue
+		}
+		if addr+arg > areaSize {
+			return nil, ExceptionIllegalDataAddress
+		}
+		src := u.holding
+		if fn == FuncReadInputRegisters {
+			src = u.input
+		}
+		data := registersToBytes(src[addr : addr+arg])
+		return append([]byte{fn, byte(len(data))}, data...), 0
+
+	case FuncWriteSingleCoil:
+		switch arg {
+		case 0xFF00:
+			u.coils[addr] = true
+		case 0x0000:
+			u.coils[addr] = false
+		default:
+			return nil, ExceptionIllegalDataValue
+		}
+		return pdu[:5], 0
+
+	case FuncWriteSingleRegister:
+		u.holding[addr] = uint16(arg)
+		return pdu[:5], 0
+
+	case FuncWriteMultipleCoils, FuncWriteMultipleRegisters:
+		if len(pdu) < 6 || int(pdu[5]) != len(pdu)-6 {
+			return nil, ExceptionIllegalDataValue
+		}
+		data := pdu[6:]
+		if addr+arg > areaSize {
+			return nil, ExceptionIllegalDataAddress
+		}
+		if fn == FuncWriteMultipleCoils {
+			if arg < 1 || arg > maxWriteBits || len(data) != (arg+7)/8 {
+				return nil, ExceptionIllegalDataValue
+			}
+			copy(u.coils[addr:], unpackBits(data, arg))
+		} else {
+			if arg < 1 || arg > maxWriteRegisters || len(data) != arg*2 {
+				return nil, ExceptionIllegalDataValue
+			}
+			copy(u.holding[addr:], bytesToRegisters(data))
+		}
+		return pdu[:5], 0
+
+	default:
+		return nil, ExceptionIllegalFunction
+	}
+}
@@ -0,0 +1,414 @@
+// driver/runtime.go
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// 默认采集间隔
+const defaultPollInterval = 10 * time.Second
+
+// 相对服务主题前缀 plugin/{服务标识符}/ 的默认主题
+const (
+	TelemetryTopic = "devices/telemetry"           // 遥测上报主题
+	ControlTopic   = "devices/telemetry/control/#" // 控制下发订阅主题，最后一级为设备ID
+)
+
+// MQTT 运行时使用的MQTT操作，*client.MQTTClient 实现了该接口
+type MQTT interface {
+	PublishContext(ctx context.Context, topic string, qos byte, payload interface{}) error
+	SubscribeContext(topic string, qos byte, handler client.ContextMessageHandler) error
+}
+
+// RuntimeConfig 驱动运行时配置
+type RuntimeConfig struct {
+	ServiceIdentifier string        // 服务标识符，用于主题前缀 plugin/{服务标识符}/
+	MQTT              MQTT          // MQTT客户端
+	Factory           Factory       // 驱动工厂
+	PollInterval      time.Duration // 默认采集间隔，设备配置中的 poll_interval 优先，默认10秒
+	QoS               byte          // 遥测消息QoS
+	Logger            *log.Logger
+}
+
+// pollOptions 运行时从设备配置中读取的选项
+type pollOptions struct {
+	PollInterval time.Duration `json:"poll_interval"`
+}
+
+// TelemetryMessage 遥测消息
+type TelemetryMessage struct {
+	DeviceID string `json:"device_id"`
+	Values   Values `json:"values"`
+}
+
+// deviceRuntime 单个设备的驱动实例
+type deviceRuntime struct {
+	device   types.Device
+	driver   Driver
+	interval time.Duration
+
+	mu      sync.Mutex // 串行化驱动调用
+	broken  bool       // 上次采集失败，下次采集前重新连接
+	lastErr error      // 最近一次采集错误
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Runtime 驱动运行时，为每个设备创建一个驱动实例并定时采集，
+// 采集结果作为遥测通过MQTT上报，平台下发的控制指令转给对应驱动写入
+type Runtime struct {
+	config RuntimeConfig
+	logger *log.Logger
+	prefix string
+
+	mu      sync.RWMutex
+	devices map[string]*deviceRuntime
+	parents map[string]string      // 子设备ID -> 网关设备ID
+	locks   map[string]*deviceLock // 设备ID -> 添加、移除设备的锁
+}
+
+// deviceLock 串行化同一设备的添加和移除，refs 为持有或等待该锁的调用数，受 Runtime.mu 保护
+type deviceLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewRuntime 创建驱动运行时
+func NewRuntime(config RuntimeConfig) *Runtime {
+	logger := config.Logger
+	if logger == nil {
+		logger = log.New(log.Writer(), "[TP-Driver] ", log.LstdFlags|log.Lshortfile)
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	return &Runtime{
+		config:  config,
+		logger:  logger,
+		prefix:  "plugin/" + config.ServiceIdentifier + "/",
+		devices: make(map[string]*deviceRuntime),
+		parents: make(map[string]string),
+		locks:   make(map[string]*deviceLock),
+	}
+}
+
+// Start 订阅控制下发主题
+func (r *Runtime) Start() error {
+	if r.config.MQTT == nil {
+		return fmt.Errorf("驱动运行时未配置MQTT客户端")
+	}
+	if err := r.config.MQTT.SubscribeContext(r.prefix+ControlTopic, 1, r.handleControl); err != nil {
+		return fmt.Errorf("订阅控制主题失败: %w", err)
+	}
+	return nil
+}
+
+// AddDevice 为设备创建并打开驱动，开始定时采集；设备已存在时先移除旧实例
+func (r *Runtime) AddDevice(ctx context.Context, dev types.Device) error {
+	if r.config.Factory == nil {
+		return fmt.Errorf("驱动运行时未配置驱动工厂")
+	}
+	opts, err := types.DecodeConfig[pollOptions](dev)
+	if err != nil {
+		return err
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = r.config.PollInterval
+	}
+
+	// 同一设备的添加串行执行，先关闭旧实例，避免同一设备同时存在两个连接
+	unlock := r.lockDevice(dev.ID)
+	defer unlock()
+	r.removeDevice(dev.ID)
+
+	drv, err := r.config.Factory(dev)
+	if err != nil {
+		return fmt.Errorf("创建驱动失败: %w", err)
+	}
+	if err := drv.Open(ctx); err != nil {
+		return fmt.Errorf("打开驱动失败: %w", err)
+	}
+
+	pollCtx, cancel := context.WithCancel(context.Background())
+	d := &deviceRuntime{device: dev, driver: drv, interval: interval, cancel: cancel, done: make(chan struct{})}
+
+	r.mu.Lock()
+	r.devices[dev.ID] = d
+	for _, sub := range dev.SubDevices {
+		r.parents[sub.DeviceID] = dev.ID
+	}
+	r.mu.Unlock()
+
+	r.logger.Printf("设备驱动已启动: deviceID=%s, interval=%v", dev.ID, interval)
+	go r.poll(pollCtx, d)
+	return nil
+}
+
+// RemoveDevice 停止采集并关闭设备驱动
+func (r *Runtime) RemoveDevice(deviceID string) {
+	unlock := r.lockDevice(deviceID)
+	defer unlock()
+	r.removeDevice(deviceID)
+}
+
+// lockDevice 获取设备的添加、移除锁，返回解锁函数
+func (r *Runtime) lockDevice(deviceID string) func() {
+	r.mu.Lock()
+	l, ok := r.locks[deviceID]
+	if !ok {
+		l = &deviceLock{}
+		r.locks[deviceID] = l
+	}
+	l.refs++
+	r.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		r.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(r.locks, deviceID)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// removeDevice 停止采集并关闭设备驱动，调用方需持有设备锁
+func (r *Runtime) removeDevice(deviceID string) {
+	r.mu.Lock()
+	d, ok := r.devices[deviceID]
+	if ok {
+		delete(r.devices, deviceID)
+		for _, sub := range d.device.SubDevices {
+			if r.parents[sub.DeviceID] == deviceID {
+				delete(r.parents, sub.DeviceID)
+			}
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	d.cancel()
+	<-d.done
+	d.mu.Lock()
+	if err := d.driver.Close(); err != nil {
+		r.logger.Printf("关闭驱动失败: deviceID=%s, err=%v", deviceID, err)
+	}
+	d.mu.Unlock()
+	r.logger.Printf("设备驱动已停止: deviceID=%s", deviceID)
+}
+
+// HandleDisconnect 平台通知设备断开时停止驱动，签名与 handler.Handler.AddDisconnectListener 的监听器一致
+func (r *Runtime) HandleDisconnect(_ context.Context, deviceID string) {
+	r.mu.RLock()
+	_, ok := r.devices[deviceID]
+	r.mu.RUnlock()
+	if ok {
+		r.RemoveDevice(deviceID)
+	}
+}
+
+// Devices 返回运行中的设备ID
+func (r *Runtime) Devices() []string {
+	r.mu.RLock()
+	ids := make([]string, 0, len(r.devices))
+	for id := range r.devices {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+	sort.Strings(ids)
+	return ids
+}
+
+// Stop 停止全部设备驱动
+func (r *Runtime) Stop() {
+	for _, id := range r.Devices() {
+		r.RemoveDevice(id)
+	}
+}
+
+// Write 向设备写入点位，子设备的写入转给所属网关的驱动
+func (r *Runtime) Write(ctx context.Context, deviceID string, values Values) error {
+	r.mu.RLock()
+	d, ok := r.devices[deviceID]
+	parentID, isSub := r.parents[deviceID]
+	if !ok && isSub {
+		d, ok = r.devices[parentID]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("设备驱动不存在: deviceID=%s", deviceID)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.device.ID == deviceID {
+		return d.driver.Write(ctx, values)
+	}
+
+	sd, ok := d.driver.(SubDeviceDriver)
+	if !ok {
+		return fmt.Errorf("网关驱动不支持子设备写入: deviceID=%s", deviceID)
+	}
+	for _, sub := range d.device.SubDevices {
+		if sub.DeviceID == deviceID {
+			return sd.WriteSubDevice(ctx, sub, values)
+		}
+	}
+	return fmt.Errorf("子设备不存在: deviceID=%s", deviceID)
+}
+
+// HealthCheck 返回驱动健康检查函数，任一设备连接异常时返回错误，可注册到 handler.Handler.AddCheck
+func (r *Runtime) HealthCheck() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		r.mu.RLock()
+		devices := make([]*deviceRuntime, 0, len(r.devices))
+		for _, d := range r.devices {
+			devices = append(devices, d)
+		}
+		r.mu.RUnlock()
+
+		var errs []error
+		for _, d := range devices {
+			d.mu.Lock()
+			err := d.lastErr
+			if err == nil {
+				err = d.driver.Health(ctx)
+			}
+			d.mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("设备%s: %w", d.device.ID, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// poll 定时采集
+func (r *Runtime) poll(ctx context.Context, d *deviceRuntime) {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		r.collect(ctx, d)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect 执行一次采集并上报
+func (r *Runtime) collect(ctx context.Context, d *deviceRuntime) {
+	d.mu.Lock()
+	if d.broken {
+		d.driver.Close()
+		if err := d.driver.Open(ctx); err != nil {
+			d.lastErr = err
+			d.mu.Unlock()
+			r.logger.Printf("重新连接设备失败: deviceID=%s, err=%v", d.device.ID, err)
+			return
+		}
+		d.broken = false
+	}
+
+	values, err := d.driver.Read(ctx)
+	var subValues map[string]Values
+	if sd, ok := d.driver.(SubDeviceDriver); ok && err == nil {
+		subValues, err = sd.ReadSubDevices(ctx)
+	}
+	d.lastErr = err
+	d.broken = err != nil && ctx.Err() == nil
+	d.mu.Unlock()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Printf("采集失败: deviceID=%s, err=%v", d.device.ID, err)
+		}
+		return
+	}
+
+	if len(values) > 0 {
+		r.publish(ctx, d.device.ID, values)
+	}
+	for id, v := range subValues {
+		if len(v) > 0 {
+			r.publish(ctx, id, v)
+		}
+	}
+}
+
+// publish 上报遥测
+func (r *Runtime) publish(ctx context.Context, deviceID string, values Values) {
+	payload, err := json.Marshal(TelemetryMessage{DeviceID: deviceID, Values: values})
+	if err != nil {
+		r.logger.Printf("序列化遥测失败: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	if err := r.config.MQTT.PublishContext(ctx, r.prefix+TelemetryTopic, r.config.QoS, payload); err != nil {
+		r.logger.Printf("遥测上报失败: deviceID=%s, err=%v", deviceID, err)
+	}
+}
+
+// ParseControl 解析平台下发的控制指令，设备ID取自主题最后一级或消息的 device_id 字段，
+// 消息为点位对象或 {"device_id":..., "values":{...}}
+func ParseControl(topic string, payload []byte) (deviceID string, values Values, err error) {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return "", nil, fmt.Errorf("控制指令格式错误: %w", err)
+	}
+
+	deviceID = topic[strings.LastIndex(topic, "/")+1:]
+	if raw, ok := msg["device_id"]; ok {
+		json.Unmarshal(raw, &deviceID)
+	}
+
+	if raw, ok := msg["values"]; ok {
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return "", nil, fmt.Errorf("控制指令格式错误: %w", err)
+		}
+	} else {
+		if err := json.Unmarshal(payload, &values); err != nil {
+			return "", nil, fmt.Errorf("控制指令格式错误: %w", err)
+		}
+		// 平铺的指令中 device_id 是目标设备，不是点位
+		delete(values, "device_id")
+	}
+
+	if deviceID == "" {
+		return "", nil, fmt.Errorf("控制指令缺少设备ID")
+	}
+	return deviceID, values, nil
+}
+
+// handleControl 处理平台下发的控制指令
+func (r *Runtime) handleControl(ctx context.Context, topic string, payload []byte) {
+	deviceID, values, err := ParseControl(topic, payload)
+	if err != nil {
+		r.logger.Printf("%v: topic=%s", err, topic)
+		return
+	}
+	if err := r.Write(ctx, deviceID, values); err != nil {
+		r.logger.Printf("控制指令执行失败: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	r.logger.Printf("控制指令执行成功: deviceID=%s", deviceID)
+}
@@ -0,0 +1,105 @@
+// driver/runtime_test.go
+
+package driver
+
+import (
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// countingDriver 记录同时打开的连接数
+type countingDriver struct {
+	open    *atomic.Int32
+	maxOpen *atomic.Int32
+}
+
+func (d *countingDriver) Open(context.Context) error {
+	n := d.open.Add(1)
+	for {
+		m := d.maxOpen.Load()
+		if n <= m || d.maxOpen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond) // 放大并发添加的时间窗口
+	return nil
+}
+
+func (d *countingDriver) Read(context.Context) (Values, error) { return nil, nil }
+func (d *countingDriver) Write(context.Context, Values) error  { return nil }
+func (d *countingDriver) Health(context.Context) error         { return nil }
+func (d *countingDriver) Close() error                         { d.open.Add(-1); return nil }
+
+func TestRuntimeAddDeviceConcurrent(t *testing.T) {
+	var open, maxOpen atomic.Int32
+	r := NewRuntime(RuntimeConfig{
+		Factory: func(types.Device) (Driver, error) {
+			return &countingDriver{open: &open, maxOpen: &maxOpen}, nil
+		},
+		PollInterval: time.Hour,
+		Logger:       log.New(io.Discard, "", 0),
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.AddDevice(context.Background(), types.Device{ID: "d1"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := open.Load(); got != 1 {
+		t.Errorf("打开的驱动数量 = %d, 期望 1", got)
+	}
+	if got := maxOpen.Load(); got != 1 {
+		t.Errorf("同一设备同时打开的驱动数量最多为 %d, 期望 1", got)
+	}
+
+	r.Stop()
+	if got := open.Load(); got != 0 {
+		t.Errorf("停止后仍有 %d 个驱动未关闭", got)
+	}
+	if len(r.locks) != 0 {
+		t.Errorf("设备锁未释放: %v", r.locks)
+	}
+}
+
+func TestParseControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    string
+		payload  string
+		deviceID string
+		values   Values
+		wantErr  bool
+	}{
+		{"主题中的设备ID", "plugin/svc/devices/telemetry/control/d1", `{"switch":1}`, "d1", Values{"switch": float64(1)}, false},
+		{"平铺的 device_id 不作为点位", "plugin/svc/devices/telemetry/control/d1", `{"device_id":"x","switch":1}`, "x", Values{"switch": float64(1)}, false},
+		{"values 字段", "plugin/svc/devices/telemetry/control/d1", `{"device_id":"x","values":{"switch":0}}`, "x", Values{"switch": float64(0)}, false},
+		{"缺少设备ID", "control/", `{"switch":1}`, "", nil, true},
+		{"格式错误", "control/d1", `[1]`, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deviceID, values, err := ParseControl(tt.topic, []byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if deviceID != tt.deviceID || !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("ParseControl = %q, %v, 期望 %q, %v", deviceID, values, tt.deviceID, tt.values)
+			}
+		})
+	}
+}
@@ -34,6 +34,11 @@ func main() {
 	logger.Println("\n测试获取设备列表...")
 	deviceList := testGetDeviceList(baseURL, logger)
 	logger.Printf("设备列表: %+v\n", deviceList)
+
+	// 5. 测试获取设备信息
+	logger.Println("\n测试获取设备信息...")
+	deviceInfo := testGetDeviceInfo(baseURL, "DEV001", logger)
+	logger.Printf("设备信息: %+v\n", deviceInfo)
 }
 
 // 获取表单配置
@@ -141,3 +146,24 @@ func testGetDeviceList(baseURL string, logger *log.Logger) map[string]interface{
 
 	return result
 }
+
+// 测试获取设备信息
+func testGetDeviceInfo(baseURL string, key string, logger *log.Logger) map[string]interface{} {
+	params := url.Values{}
+	params.Add("key", key)
+
+	url := fmt.Sprintf("%s/api/v1/plugin/device/info?%s", baseURL, params.Encode())
+
+	resp, err := http.Get(url)
+	if err != nil {
+		logger.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		logger.Fatalf("解析响应失败: %v", err)
+	}
+
+	return result
+}
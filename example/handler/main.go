@@ -3,12 +3,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/ThingsPanel/tp-protocol-sdk-go/form"
 	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
 )
 
+// DeviceConfig 设备配置表单，同时用于渲染表单和解码设备配置
+type DeviceConfig struct {
+	Host string `json:"host" label:"服务器地址" placeholder:"请输入服务器地址" binding:"required"`
+	Port int    `json:"port" label:"端口" default:"502" binding:"required,min=1,max=65535"`
+	Mode string `json:"mode" label:"模式" options:"tcp:TCP,rtu:RTU" default:"tcp"`
+}
+
 func main() {
 	logger := log.New(os.Stdout, "[TP-Example] ", log.LstdFlags|log.Lshortfile)
 
@@ -17,28 +28,29 @@ func main() {
 		Logger: logger,
 	})
 
+	h.Use(handler.Recovery(logger), handler.RequestID())
+
 	// 设置表单配置处理函数
 	h.SetFormConfigHandler(func(req *handler.GetFormConfigRequest) (interface{}, error) {
 		logger.Printf("收到表单配置请求: type=%s", req.FormType)
-		return map[string]interface{}{
-			"fields": []map[string]interface{}{
-				{
-					"name":  "host",
-					"type":  "string",
-					"label": "服务器地址",
-				},
-				{
-					"name":  "port",
-					"type":  "number",
-					"label": "端口",
-				},
-			},
-		}, nil
+		switch req.FormType {
+		case form.FormTypeConfig:
+			// 同一个结构体也可用于 types.DecodeConfig 解码设备配置
+			return form.FromStruct(DeviceConfig{})
+		case form.FormTypeVoucher:
+			return form.New(
+				form.Input("username", "用户名").Required("请输入用户名"),
+				form.Input("password", "密码"),
+			), nil
+		default:
+			return form.New(), nil
+		}
 	})
 
 	// 设置设备断开连接处理函数
-	h.SetDeviceDisconnectHandler(func(req *handler.DeviceDisconnectRequest) error {
-		logger.Printf("设备断开连接: %s", req.DeviceID)
+	h.SetDeviceDisconnectHandlerWithContext(func(ctx context.Context, req *handler.DeviceDisconnectRequest) error {
+		info, _ := handler.RequestInfoFromContext(ctx)
+		logger.Printf("设备断开连接: %s, requestID=%s", req.DeviceID, info.RequestID)
 		return nil
 	})
 
@@ -72,9 +84,26 @@ func main() {
 		}, nil
 	})
 
-	// 启动HTTP服务
+	// 设置通过密钥获取设备信息处理函数
+	h.SetGetDeviceInfoHandler(func(req *handler.GetDeviceInfoRequest) (*handler.GetDeviceInfoResponse, error) {
+		logger.Printf("获取设备信息: key=%s", req.Key)
+		return &handler.GetDeviceInfoResponse{
+			Code:    200,
+			Message: "success",
+			Data: handler.DeviceItem{
+				DeviceName:   "设备1",
+				Description:  "测试设备1",
+				DeviceNumber: req.Key,
+			},
+		}, nil
+	})
+
+	// 启动HTTP服务，收到退出信号后等待处理中的回调完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	logger.Printf("启动HTTP服务...")
-	if err := h.Start(":8080"); err != nil {
+	if err := h.Serve(ctx, ":8080"); err != nil {
 		logger.Fatalf("服务启动失败: %v", err)
 	}
 }
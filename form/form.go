@@ -0,0 +1,155 @@
+// form/form.go
+
+// Package form 构建ThingsPanel表单配置（CFG、VCR、SVCR），
+// 生成的JSON即为表单配置回调中平台前端期望的格式
+package form
+
+import (
+	"encoding/json"
+)
+
+// FieldType 表单字段类型
+type FieldType string
+
+const (
+	TypeInput  FieldType = "input"  // 输入框
+	TypeSelect FieldType = "select" // 下拉选择
+	TypeTable  FieldType = "table"  // 表格，Array 为每行的子字段
+)
+
+// 校验值类型
+const (
+	ValueString = "string"
+	ValueNumber = "number"
+	ValueArray  = "array"
+)
+
+// 平台表单类型
+const (
+	FormTypeConfig         = "CFG"  // 配置表单
+	FormTypeVoucher        = "VCR"  // 凭证表单
+	FormTypeServiceVoucher = "SVCR" // 服务凭证表单
+)
+
+// Option 下拉选项
+type Option struct {
+	Label string      `json:"label"`
+	Value interface{} `json:"value"`
+}
+
+// Validate 字段校验规则
+type Validate struct {
+	Type     string `json:"type,omitempty"`     // 值类型 string/number/array
+	Required bool   `json:"required,omitempty"` // 是否必填
+	Message  string `json:"message,omitempty"`  // 校验失败提示
+	Rules    string `json:"rules,omitempty"`    // 正则表达式，如 /^\d+$/
+}
+
+// Field 表单字段
+type Field struct {
+	DataKey     string      `json:"dataKey"`
+	Label       string      `json:"label"`
+	Placeholder string      `json:"placeholder,omitempty"`
+	Type        FieldType   `json:"type"`
+	Default     interface{} `json:"default,omitempty"` // 默认值
+	Validate    *Validate   `json:"validate,omitempty"`
+	Options     []Option    `json:"options,omitempty"`
+	Array       []*Field    `json:"array,omitempty"` // 表格每行的子字段
+}
+
+// Form 表单定义，序列化为字段数组
+type Form []*Field
+
+// New 创建表单
+func New(fields ...*Field) Form {
+	if fields == nil {
+		fields = []*Field{}
+	}
+	return Form(fields)
+}
+
+// Add 追加字段
+func (f Form) Add(fields ...*Field) Form {
+	return append(f, fields...)
+}
+
+// JSON 序列化为平台表单JSON
+func (f Form) JSON() ([]byte, error) {
+	return json.Marshal(f)
+}
+
+// MarshalJSON 实现 json.Marshaler，没有字段的表单序列化为 []，而不是 null
+func (f Form) MarshalJSON() ([]byte, error) {
+	if f == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]*Field(f))
+}
+
+// Input 创建字符串输入框字段
+func Input(key, label string) *Field {
+	return &Field{DataKey: key, Label: label, Type: TypeInput, Validate: &Validate{Type: ValueString}}
+}
+
+// Number 创建数字输入框字段
+func Number(key, label string) *Field {
+	return &Field{DataKey: key, Label: label, Type: TypeInput, Validate: &Validate{Type: ValueNumber}}
+}
+
+// Select 创建下拉选择字段
+func Select(key, label string, options ...Option) *Field {
+	return &Field{DataKey: key, Label: label, Type: TypeSelect, Options: options, Validate: &Validate{Type: ValueString}}
+}
+
+// Table 创建表格字段，fields 为每一行的列定义
+func Table(key, label string, fields ...*Field) *Field {
+	return &Field{DataKey: key, Label: label, Type: TypeTable, Array: fields, Validate: &Validate{Type: ValueArray}}
+}
+
+// Opt 创建下拉选项
+func Opt(label string, value interface{}) Option {
+	return Option{Label: label, Value: value}
+}
+
+// WithPlaceholder 设置占位提示
+func (f *Field) WithPlaceholder(placeholder string) *Field {
+	f.Placeholder = placeholder
+	return f
+}
+
+// WithDefault 设置默认值
+func (f *Field) WithDefault(value interface{}) *Field {
+	f.Default = value
+	return f
+}
+
+// Required 设置为必填，message 为未填写时的提示
+func (f *Field) Required(message string) *Field {
+	f.validate().Required = true
+	if message != "" {
+		f.validate().Message = message
+	}
+	return f
+}
+
+// Pattern 设置正则校验规则，rules 形如 /^\d+$/
+func (f *Field) Pattern(rules, message string) *Field {
+	f.validate().Rules = rules
+	if message != "" {
+		f.validate().Message = message
+	}
+	return f
+}
+
+// WithOptions 追加下拉选项
+func (f *Field) WithOptions(options ...Option) *Field {
+	f.Options = append(f.Options, options...)
+	return f
+}
+
+func (f *Field) validate() *Validate {
+	if f.Validate == nil {
+		f.Validate = &Validate{}
+	}
+	return f.Validate
+}
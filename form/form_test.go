@@ -0,0 +1,34 @@
+// form/form_test.go
+
+package form
+
+import "testing"
+
+func TestFormJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		form Form
+		want string
+	}{
+		{"空表单", nil, `[]`},
+		{"输入框", New(Input("host", "服务器地址").Required("请输入服务器地址").WithPlaceholder("127.0.0.1")),
+			`[{"dataKey":"host","label":"服务器地址","placeholder":"127.0.0.1","type":"input","validate":{"type":"string","required":true,"message":"请输入服务器地址"}}]`},
+		{"数字和正则", New(Number("port", "端口").WithDefault(502).Pattern(`/^\d+$/`, "端口格式错误")),
+			`[{"dataKey":"port","label":"端口","type":"input","default":502,"validate":{"type":"number","message":"端口格式错误","rules":"/^\\d+$/"}}]`},
+		{"下拉", New(Select("mode", "模式", Opt("TCP", "tcp")).WithOptions(Opt("RTU", "rtu"))),
+			`[{"dataKey":"mode","label":"模式","type":"select","validate":{"type":"string"},"options":[{"label":"TCP","value":"tcp"},{"label":"RTU","value":"rtu"}]}]`},
+		{"表格", New(Table("points", "点位", Input("name", "名称"))),
+			`[{"dataKey":"points","label":"点位","type":"table","validate":{"type":"array"},"array":[{"dataKey":"name","label":"名称","type":"input","validate":{"type":"string"}}]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.form.JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("JSON = %s\n期望 %s", data, tt.want)
+			}
+		})
+	}
+}
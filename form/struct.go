@@ -0,0 +1,236 @@
+// form/struct.go
+
+package form
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/internal/binding"
+)
+
+// FromStruct 根据带标签的结构体生成表单，同一个结构体可再用 types.DecodeConfig 解码提交的配置
+//
+// 支持的标签：
+//   - json:"host"                     字段键名（dataKey）
+//   - label:"服务器地址"                字段标题，缺省使用键名
+//   - placeholder:"请输入服务器地址"     占位提示
+//   - options:"tcp:TCP,rtu:RTU"       下拉选项，格式为 值:标题，逗号分隔，数字和布尔字段的值转换为对应类型
+//   - pattern:"/^\d+$/"               正则校验
+//   - message:"请输入正确的地址"        校验失败提示
+//   - default:"502"                   默认值，数字和布尔字段转换为对应类型
+//   - binding:"required,oneof=tcp rtu" 必填；oneof 在未设置 options 时生成下拉选项，选项值同样按字段类型转换
+//
+// 数字字段生成数字输入框，布尔字段生成是/否下拉，结构体切片生成表格，
+// 匿名嵌入的结构体字段展开到同一层；平台表单没有对象类型的字段，具名的结构体字段返回错误
+func FromStruct(v interface{}) (Form, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("FromStruct 需要结构体或结构体指针，实际为 %v", t)
+	}
+	return fieldsOf(t, map[reflect.Type]bool{})
+}
+
+// MustFromStruct 同 FromStruct，出错时panic，适合在包初始化时定义表单
+func MustFromStruct(v interface{}) Form {
+	f, err := FromStruct(v)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// fieldsOf 生成结构体的字段，expanding 为正在展开的结构体，用于拒绝自引用的结构体
+func fieldsOf(t reflect.Type, expanding map[reflect.Type]bool) (Form, error) {
+	if expanding[t] {
+		return nil, fmt.Errorf("结构体 %s 自引用，无法生成表单", t)
+	}
+	expanding[t] = true
+	defer delete(expanding, t)
+
+	var out Form
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && sf.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			embedded, err := fieldsOf(ft, expanding)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, embedded...)
+			continue
+		}
+
+		key, ok := binding.FieldName(sf, "json")
+		if !ok {
+			continue
+		}
+		field, err := fieldOf(sf, ft, key, expanding)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, field)
+	}
+	return out, nil
+}
+
+func fieldOf(sf reflect.StructField, ft reflect.Type, key string, expanding map[reflect.Type]bool) (*Field, error) {
+	label := sf.Tag.Get("label")
+	if label == "" {
+		label = key
+	}
+
+	rules, err := binding.ParseRules(sf.Tag.Get("binding"))
+	if err != nil {
+		return nil, fmt.Errorf("字段 %s: %w", sf.Name, err)
+	}
+
+	var field *Field
+	switch {
+	case ft == reflect.TypeOf(time.Duration(0)):
+		field = Input(key, label)
+	case ft.Kind() == reflect.Bool:
+		field = Select(key, label, Opt("是", true), Opt("否", false))
+	case isNumber(ft.Kind()):
+		field = Number(key, label)
+	case ft.Kind() == reflect.String:
+		field = Input(key, label)
+	case ft.Kind() == reflect.Slice && indirect(ft.Elem()).Kind() == reflect.Struct:
+		columns, err := fieldsOf(indirect(ft.Elem()), expanding)
+		if err != nil {
+			return nil, err
+		}
+		field = Table(key, label, columns...)
+	case ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}):
+		return nil, fmt.Errorf("字段 %s: 平台表单不支持对象字段，请改为匿名嵌入或结构体切片", sf.Name)
+	default:
+		return nil, fmt.Errorf("字段 %s: 不支持的表单字段类型 %s", sf.Name, sf.Type)
+	}
+
+	if options := sf.Tag.Get("options"); options != "" {
+		field.Type = TypeSelect
+		if field.Options, err = parseOptions(options, ft); err != nil {
+			return nil, fmt.Errorf("字段 %s: %w", sf.Name, err)
+		}
+	} else if len(rules.OneOf) > 0 {
+		field.Type = TypeSelect
+		field.Options = nil
+		for _, o := range rules.OneOf {
+			v, err := optionValue(o, ft)
+			if err != nil {
+				return nil, fmt.Errorf("字段 %s: %w", sf.Name, err)
+			}
+			field.Options = append(field.Options, Opt(o, v))
+		}
+	}
+
+	if def, ok := sf.Tag.Lookup("default"); ok {
+		value, err := parseDefault(def, ft)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %w", sf.Name, err)
+		}
+		field.Default = value
+	}
+
+	field.Placeholder = sf.Tag.Get("placeholder")
+	message := sf.Tag.Get("message")
+	if rules.Required {
+		if message == "" {
+			message = "请输入" + label
+		}
+		field.Required(message)
+	}
+	if pattern := sf.Tag.Get("pattern"); pattern != "" {
+		field.Pattern(pattern, message)
+	}
+	return field, nil
+}
+
+// parseOptions 解析 options 标签，选项值按字段类型转换
+func parseOptions(tag string, ft reflect.Type) ([]Option, error) {
+	var options []Option
+	for _, item := range strings.Split(tag, ",") {
+		value, label, found := strings.Cut(strings.TrimSpace(item), ":")
+		if !found {
+			label = value
+		}
+		v, err := optionValue(value, ft)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, Opt(label, v))
+	}
+	return options, nil
+}
+
+// optionValue 将选项值转换为字段类型，提交的配置与字段类型一致才能解码
+func optionValue(value string, ft reflect.Type) (interface{}, error) {
+	switch {
+	case ft == reflect.TypeOf(time.Duration(0)):
+		return value, nil
+	case ft.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("选项值 %q 不是布尔值", value)
+		}
+		return b, nil
+	case isNumber(ft.Kind()):
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("选项值 %q 不是数字", value)
+		}
+		return n, nil
+	}
+	return value, nil
+}
+
+// parseDefault 解析 default 标签，数字字段转为数字，布尔字段转为布尔值，其他字段保持字符串
+func parseDefault(tag string, ft reflect.Type) (interface{}, error) {
+	switch {
+	case ft == reflect.TypeOf(time.Duration(0)):
+		if _, err := time.ParseDuration(tag); err != nil {
+			return nil, fmt.Errorf("默认值 %q 不是有效的时长", tag)
+		}
+		return tag, nil
+	case ft.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(tag)
+		if err != nil {
+			return nil, fmt.Errorf("默认值 %q 不是布尔值", tag)
+		}
+		return b, nil
+	case isNumber(ft.Kind()):
+		n, err := strconv.ParseFloat(tag, 64)
+		if err != nil {
+			return nil, fmt.Errorf("默认值 %q 不是数字", tag)
+		}
+		return n, nil
+	}
+	return tag, nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
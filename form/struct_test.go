@@ -0,0 +1,117 @@
+// form/struct_test.go
+
+package form
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPoint struct {
+	Name    string `json:"name" label:"名称" binding:"required"`
+	Address uint16 `json:"address" label:"地址"`
+}
+
+type testCommon struct {
+	Timeout time.Duration `json:"timeout" label:"超时" default:"5s"`
+}
+
+type testConfig struct {
+	testCommon
+	Host     string      `json:"host" label:"服务器地址" placeholder:"127.0.0.1" binding:"required"`
+	Port     int         `json:"port" label:"端口" default:"502" binding:"min=1,max=65535"`
+	Mode     string      `json:"mode" label:"模式" binding:"oneof=tcp rtu"`
+	Baud     int         `json:"baud" label:"波特率" binding:"oneof=9600 19200"`
+	Parity   int         `json:"parity" label:"校验" options:"0:无,1:奇,2:偶"`
+	Enabled  bool        `json:"enabled" label:"启用" default:"true"`
+	Secure   bool        `json:"secure" binding:"oneof=true"`
+	Points   []testPoint `json:"points" label:"点位"`
+	internal string
+	Ignored  string `json:"-"`
+}
+
+func TestFromStruct(t *testing.T) {
+	f, err := FromStruct(&testConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]*Field{}
+	var keys []string
+	for _, field := range f {
+		fields[field.DataKey] = field
+		keys = append(keys, field.DataKey)
+	}
+	if want := []string{"timeout", "host", "port", "mode", "baud", "parity", "enabled", "secure", "points"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("字段 = %v, 期望 %v", keys, want)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"匿名嵌入展开且时长默认值为字符串", fields["timeout"].Default, "5s"},
+		{"必填提示", fields["host"].Validate.Message, "请输入服务器地址"},
+		{"占位提示", fields["host"].Placeholder, "127.0.0.1"},
+		{"数字默认值", fields["port"].Default, float64(502)},
+		{"数字字段类型", fields["port"].Validate.Type, ValueNumber},
+		{"字符串 oneof 选项", fields["mode"].Options, []Option{Opt("tcp", "tcp"), Opt("rtu", "rtu")}},
+		{"数字 oneof 选项为数字", fields["baud"].Options, []Option{Opt("9600", float64(9600)), Opt("19200", float64(19200))}},
+		{"数字 options 选项为数字", fields["parity"].Options, []Option{Opt("无", float64(0)), Opt("奇", float64(1)), Opt("偶", float64(2))}},
+		{"布尔默认值", fields["enabled"].Default, true},
+		{"布尔下拉", fields["enabled"].Options, []Option{Opt("是", true), Opt("否", false)}},
+		{"布尔 oneof 替换是/否选项", fields["secure"].Options, []Option{Opt("true", true)}},
+		{"结构体切片生成表格", fields["points"].Type, TypeTable},
+		{"表格列", len(fields["points"].Array), 2},
+		{"表格列必填", fields["points"].Array[0].Validate.Required, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("结果 = %#v, 期望 %#v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromStructError(t *testing.T) {
+	type node struct {
+		Children []node `json:"children"`
+	}
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"非结构体", 1, "需要结构体"},
+		{"具名结构体字段", struct {
+			Point testPoint `json:"point"`
+		}{}, "不支持对象字段"},
+		{"数字 oneof 值无效", struct {
+			Baud int `json:"baud" binding:"oneof=fast slow"`
+		}{}, "不是数字"},
+		{"数字 options 值无效", struct {
+			Baud int `json:"baud" options:"1a:快"`
+		}{}, "不是数字"},
+		{"默认值无效", struct {
+			Port int `json:"port" default:"x"`
+		}{}, "不是数字"},
+		{"不支持的校验规则", struct {
+			Port int `json:"port" binding:"email"`
+		}{}, "不支持的校验规则"},
+		{"不支持的类型", struct {
+			M map[string]string `json:"m"`
+		}{}, "不支持的表单字段类型"},
+		{"自引用", node{}, "自引用"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromStruct(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, 期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// gateway/coap/dtls.go
+
+package coap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/protocol"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+	"github.com/pion/transport/v2/udp"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// PSK握手时解析设备的超时时间
+const pskTimeout = 10 * time.Second
+
+// DTLS握手超时时间，包含PSK解析
+const handshakeTimeout = pskTimeout + 5*time.Second
+
+// VoucherKey 从设备凭证中取预共享密钥，依次使用 password、access_token、username
+func VoucherKey(raw string) ([]byte, error) {
+	v, err := types.ParseVoucher(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"password", "access_token", "username"} {
+		if s := v.Get(key); s != "" {
+			return []byte(s), nil
+		}
+	}
+	return nil, fmt.Errorf("凭证中没有可用作密钥的字段")
+}
+
+// DevicePSK 默认的PSK解析：客户端PSK身份为设备编号，密钥由设备凭证经 VoucherKey 得到
+func (s *Server) DevicePSK(ctx context.Context, identity []byte) ([]byte, string, error) {
+	entry, err := s.config.Bridge.Resolve(ctx, gateway.Identity{DeviceNumber: string(identity)})
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := VoucherKey(entry.Voucher)
+	if err != nil {
+		return nil, "", fmt.Errorf("设备凭证无效: deviceID=%s, %w", entry.ID, err)
+	}
+	return key, entry.ID, nil
+}
+
+// ListenDTLS 监听DTLS地址，使用PSK密码套件。
+// 返回的监听在 Accept 中完成握手；交给 ServeDTLS 时每个连接在各自的协程中握手，
+// 握手缓慢或停滞的对端不会阻塞其他设备接入
+func (s *Server) ListenDTLS(address string) (net.Listener, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("DTLS地址无效: %w", err)
+	}
+	lc := udp.ListenConfig{
+		// 只为握手报文创建连接
+		AcceptFilter: func(packet []byte) bool {
+			pkts, err := recordlayer.UnpackDatagram(packet)
+			if err != nil || len(pkts) < 1 {
+				return false
+			}
+			h := &recordlayer.Header{}
+			if err := h.Unmarshal(pkts[0]); err != nil {
+				return false
+			}
+			return h.ContentType == protocol.ContentTypeHandshake
+		},
+	}
+	parent, err := lc.Listen("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("DTLS监听失败: %w", err)
+	}
+	return &dtlsListener{Listener: parent, config: s.dtlsConfig()}, nil
+}
+
+// dtlsConfig DTLS服务配置
+func (s *Server) dtlsConfig() *dtls.Config {
+	return &dtls.Config{
+		PSK: func(identity []byte) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), pskTimeout)
+			defer cancel()
+			key, _, err := s.config.PSK(ctx, identity)
+			if err != nil {
+				s.logger.Printf("DTLS设备认证失败: identity=%s, err=%v", identity, err)
+			}
+			return key, err
+		},
+		CipherSuites: []dtls.CipherSuiteID{
+			dtls.TLS_PSK_WITH_AES_128_CCM_8,
+			dtls.TLS_PSK_WITH_AES_128_CCM,
+			dtls.TLS_PSK_WITH_AES_128_GCM_SHA256,
+			dtls.TLS_PSK_WITH_AES_128_CBC_SHA256,
+		},
+		ConnectContextMaker: func() (context.Context, func()) {
+			return context.WithTimeout(context.Background(), handshakeTimeout)
+		},
+	}
+}
+
+// dtlsListener 未握手的UDP连接监听，Accept 完成握手后返回
+type dtlsListener struct {
+	net.Listener
+	config *dtls.Config
+}
+
+// Accept 接受连接并完成握手
+func (l *dtlsListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return dtls.Server(c, l.config)
+}
+
+// ServeDTLS 在 ListenDTLS 返回的监听上处理连接，直到 ctx 取消或调用 Close
+func (s *Server) ServeDTLS(ctx context.Context, ln net.Listener) error {
+	if !s.track(ln.Close) {
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.logger.Printf("CoAP DTLS服务已启动: %s", ln.Addr())
+	stop := context.AfterFunc(ctx, func() { s.Close() })
+	defer stop()
+
+	// ListenDTLS 创建的监听在连接协程中握手，其他监听的 Accept 已完成握手
+	accept := ln.Accept
+	handshake := func(c net.Conn) (net.Conn, error) { return c, nil }
+	if dl, ok := ln.(*dtlsListener); ok {
+		accept = dl.Listener.Accept
+		handshake = func(c net.Conn) (net.Conn, error) {
+			hctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+			defer cancel()
+			return dtls.ServerWithContext(hctx, c, dl.config)
+		}
+	}
+
+	for {
+		raw, err := accept()
+		if err != nil {
+			if s.isClosed() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			// 握手失败只影响该连接
+			s.logger.Printf("DTLS握手失败: %v", err)
+			continue
+		}
+		if !s.addConn(raw) {
+			raw.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.removeConn(raw)
+			conn, err := handshake(raw)
+			if err != nil {
+				raw.Close()
+				s.logger.Printf("DTLS握手失败: remote=%s, err=%v", raw.RemoteAddr(), err)
+				return
+			}
+			s.serveDTLSConn(ctx, conn)
+		}()
+	}
+}
+
+// addConn 登记DTLS连接，Close 时关闭，服务已关闭时返回 false
+func (s *Server) addConn(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) removeConn(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+func (s *Server) serveDTLSConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	key := "dtls://" + conn.RemoteAddr().String()
+
+	var identity []byte
+	if dc, ok := conn.(*dtls.Conn); ok {
+		identity = dc.ConnectionState().IdentityHint
+	}
+	pctx, cancel := context.WithTimeout(ctx, pskTimeout)
+	_, deviceID, err := s.config.PSK(pctx, identity)
+	cancel()
+	if err != nil {
+		s.logger.Printf("DTLS设备认证失败: remote=%s, err=%v", conn.RemoteAddr(), err)
+		return
+	}
+
+	p := s.peer(key, func(data []byte) error {
+		_, err := conn.Write(data)
+		return err
+	}, deviceID)
+	defer s.dropPeer(p)
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		m, err := Unmarshal(buf[:n])
+		if err != nil {
+			s.logger.Printf("CoAP消息格式错误: remote=%s, err=%v", key, err)
+			continue
+		}
+		s.peer(key, nil, deviceID)
+		s.handle(ctx, p, m)
+	}
+}
+
+// dropPeer DTLS连接关闭时删除对端并取消其订阅
+func (s *Server) dropPeer(p *peer) {
+	s.mu.Lock()
+	if s.peers[p.key] == p {
+		delete(s.peers, p.key)
+	}
+	var dropped []*observer
+	for id, o := range s.observers {
+		if o.peer == p {
+			dropped = append(dropped, o)
+			delete(s.observers, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, o := range dropped {
+		s.config.Bridge.Detach(o.deviceID, o)
+	}
+}
@@ -0,0 +1,313 @@
+// gateway/coap/message.go
+
+package coap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type 消息类型
+type Type uint8
+
+// 消息类型
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+// Code 请求方法或响应码，高3位为类别，低5位为详情
+type Code uint8
+
+// 请求方法
+const (
+	Empty  Code = 0
+	GET    Code = 1
+	POST   Code = 2
+	PUT    Code = 3
+	DELETE Code = 4
+)
+
+// 响应码
+const (
+	Created               Code = 2<<5 | 1
+	Deleted               Code = 2<<5 | 2
+	Valid                 Code = 2<<5 | 3
+	Changed               Code = 2<<5 | 4
+	Content               Code = 2<<5 | 5
+	BadRequest            Code = 4<<5 | 0
+	Unauthorized          Code = 4<<5 | 1
+	NotFound              Code = 4<<5 | 4
+	MethodNotAllowed      Code = 4<<5 | 5
+	UnsupportedFormat     Code = 4<<5 | 15
+	InternalServerError   Code = 5<<5 | 0
+	ServiceUnavailable    Code = 5<<5 | 3
+	GatewayTimeout        Code = 5<<5 | 4
+	RequestEntityTooLarge Code = 4<<5 | 13
+)
+
+// String 返回 "2.05" 形式的响应码
+func (c Code) String() string {
+	return fmt.Sprintf("%d.%02d", c>>5, c&0x1f)
+}
+
+// IsRequest 是否为请求方法
+func (c Code) IsRequest() bool {
+	return c >= GET && c < 32
+}
+
+// OptionID 选项编号
+type OptionID uint16
+
+// 常用选项
+const (
+	OptionObserve       OptionID = 6
+	OptionURIPath       OptionID = 11
+	OptionContentFormat OptionID = 12
+	OptionURIQuery      OptionID = 15
+)
+
+// 内容格式
+const (
+	FormatText   = 0
+	FormatOctets = 42
+	FormatJSON   = 50
+	FormatCBOR   = 60
+)
+
+// Option 消息选项
+type Option struct {
+	ID    OptionID
+	Value []byte
+}
+
+// Message CoAP消息
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageID uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+// Option 返回选项的第一个值
+func (m *Message) Option(id OptionID) ([]byte, bool) {
+	for _, o := range m.Options {
+		if o.ID == id {
+			return o.Value, true
+		}
+	}
+	return nil, false
+}
+
+// AddOption 添加选项
+func (m *Message) AddOption(id OptionID, value []byte) {
+	m.Options = append(m.Options, Option{ID: id, Value: value})
+}
+
+// SetUint 设置整数选项，替换已有的同编号选项
+func (m *Message) SetUint(id OptionID, v uint32) {
+	opts := m.Options[:0]
+	for _, o := range m.Options {
+		if o.ID != id {
+			opts = append(opts, o)
+		}
+	}
+	m.Options = append(opts, Option{ID: id, Value: encodeUint(v)})
+}
+
+// Uint 读取整数选项
+func (m *Message) Uint(id OptionID) (uint32, bool) {
+	v, ok := m.Option(id)
+	if !ok {
+		return 0, false
+	}
+	return decodeUint(v), true
+}
+
+// Path 返回以 / 连接的 Uri-Path
+func (m *Message) Path() string {
+	var segs []string
+	for _, o := range m.Options {
+		if o.ID == OptionURIPath {
+			segs = append(segs, string(o.Value))
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// SetPath 设置 Uri-Path
+func (m *Message) SetPath(path string) {
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if seg != "" {
+			m.AddOption(OptionURIPath, []byte(seg))
+		}
+	}
+}
+
+// Query 返回 Uri-Query 中的参数
+func (m *Message) Query() map[string]string {
+	q := make(map[string]string)
+	for _, o := range m.Options {
+		if o.ID != OptionURIQuery {
+			continue
+		}
+		k, v, _ := strings.Cut(string(o.Value), "=")
+		q[k] = v
+	}
+	return q
+}
+
+// Marshal 编码消息
+func (m *Message) Marshal() ([]byte, error) {
+	if len(m.Token) > 8 {
+		return nil, fmt.Errorf("Token长度超过8字节")
+	}
+	buf := make([]byte, 4, 4+len(m.Token)+len(m.Payload)+16)
+	buf[0] = 1<<6 | byte(m.Type)<<4 | byte(len(m.Token))
+	buf[1] = byte(m.Code)
+	binary.BigEndian.PutUint16(buf[2:], m.MessageID)
+	buf = append(buf, m.Token...)
+
+	opts := append([]Option(nil), m.Options...)
+	sort.SliceStable(opts, func(i, j int) bool { return opts[i].ID < opts[j].ID })
+	prev := 0
+	for _, o := range opts {
+		if len(o.Value) > maxOptionLength {
+			return nil, fmt.Errorf("选项 %d 长度超过 %d 字节", o.ID, maxOptionLength)
+		}
+		delta := int(o.ID) - prev
+		prev = int(o.ID)
+		dn, dext := optionNibble(delta)
+		ln, lext := optionNibble(len(o.Value))
+		buf = append(buf, dn<<4|ln)
+		buf = append(buf, dext...)
+		buf = append(buf, lext...)
+		buf = append(buf, o.Value...)
+	}
+
+	if len(m.Payload) > 0 {
+		buf = append(buf, 0xFF)
+		buf = append(buf, m.Payload...)
+	}
+	return buf, nil
+}
+
+// Unmarshal 解码消息
+func Unmarshal(data []byte) (*Message, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("消息长度不足")
+	}
+	if data[0]>>6 != 1 {
+		return nil, fmt.Errorf("协议版本不支持: %d", data[0]>>6)
+	}
+	tkl := int(data[0] & 0x0f)
+	if tkl > 8 || len(data) < 4+tkl {
+		return nil, fmt.Errorf("Token长度错误")
+	}
+	m := &Message{
+		Type:      Type(data[0] >> 4 & 0x03),
+		Code:      Code(data[1]),
+		MessageID: binary.BigEndian.Uint16(data[2:]),
+		Token:     append([]byte(nil), data[4:4+tkl]...),
+	}
+
+	rest := data[4+tkl:]
+	prev := 0
+	for len(rest) > 0 {
+		if rest[0] == 0xFF {
+			if len(rest) == 1 {
+				return nil, fmt.Errorf("负载标记后没有负载")
+			}
+			m.Payload = append([]byte(nil), rest[1:]...)
+			break
+		}
+		head := rest[0]
+		rest = rest[1:]
+		delta, n, err := readOptionNibble(head>>4, rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+		length, n, err := readOptionNibble(head&0x0f, rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+		if len(rest) < length {
+			return nil, fmt.Errorf("选项长度错误")
+		}
+		prev += delta
+		if prev > 0xFFFF {
+			return nil, fmt.Errorf("选项编号超出范围")
+		}
+		m.Options = append(m.Options, Option{ID: OptionID(prev), Value: append([]byte(nil), rest[:length]...)})
+		rest = rest[length:]
+	}
+	return m, nil
+}
+
+// 选项值的最大长度，2字节扩展可表示的上限
+const maxOptionLength = 0xFFFF + 269
+
+// optionNibble 编码选项增量或长度
+func optionNibble(v int) (byte, []byte) {
+	switch {
+	case v < 13:
+		return byte(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	default:
+		ext := make([]byte, 2)
+		binary.BigEndian.PutUint16(ext, uint16(v-269))
+		return 14, ext
+	}
+}
+
+// readOptionNibble 解码选项增量或长度，返回值和使用的扩展字节数
+func readOptionNibble(nibble byte, ext []byte) (int, int, error) {
+	switch nibble {
+	case 13:
+		if len(ext) < 1 {
+			return 0, 0, fmt.Errorf("选项扩展字节不足")
+		}
+		return int(ext[0]) + 13, 1, nil
+	case 14:
+		if len(ext) < 2 {
+			return 0, 0, fmt.Errorf("选项扩展字节不足")
+		}
+		return int(binary.BigEndian.Uint16(ext)) + 269, 2, nil
+	case 15:
+		return 0, 0, fmt.Errorf("选项格式错误")
+	default:
+		return int(nibble), 0, nil
+	}
+}
+
+func encodeUint(v uint32) []byte {
+	switch {
+	case v == 0:
+		return nil
+	case v < 1<<8:
+		return []byte{byte(v)}
+	case v < 1<<16:
+		return []byte{byte(v >> 8), byte(v)}
+	case v < 1<<24:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	default:
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+}
+
+func decodeUint(b []byte) uint32 {
+	var v uint32
+	for _, x := range b {
+		v = v<<8 | uint32(x)
+	}
+	return v
+}
@@ -0,0 +1,163 @@
+// gateway/coap/message_test.go
+
+package coap
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	long := []byte(strings.Repeat("v", 300))
+	tests := []struct {
+		name string
+		msg  *Message
+	}{
+		{"空消息", &Message{Type: Confirmable, Code: Empty, MessageID: 1}},
+		{"带Token和负载", &Message{Type: NonConfirmable, Code: POST, MessageID: 0xBEEF, Token: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Payload: []byte(`{"temp":1}`)}},
+		{"路径和查询", func() *Message {
+			m := &Message{Type: Confirmable, Code: GET, MessageID: 7}
+			m.SetPath("/control/")
+			m.AddOption(OptionURIQuery, []byte("voucher=v1"))
+			m.SetUint(OptionObserve, 0)
+			return m
+		}()},
+		{"1字节扩展增量和长度", &Message{Type: Acknowledgement, Code: Content, Options: []Option{
+			{ID: 60, Value: bytes.Repeat([]byte{1}, 13)},
+			{ID: 60 + 200, Value: bytes.Repeat([]byte{2}, 268)},
+		}}},
+		{"2字节扩展增量和长度", &Message{Type: Reset, Code: Changed, Options: []Option{
+			{ID: 2048, Value: long},
+		}}},
+		{"同编号选项保持顺序", &Message{Code: GET, Options: []Option{
+			{ID: OptionURIPath, Value: []byte("a")},
+			{ID: OptionURIPath, Value: []byte("b")},
+			{ID: OptionURIPath, Value: nil},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.msg.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Unmarshal(data)
+			if err != nil {
+				t.Fatalf("解码失败: %v, 报文 %x", err, data)
+			}
+			want := normalize(tt.msg)
+			if !reflect.DeepEqual(normalize(got), want) {
+				t.Errorf("解码结果 = %+v, 期望 %+v", got, want)
+			}
+			again, err := got.Marshal()
+			if err != nil || !bytes.Equal(again, data) {
+				t.Errorf("重新编码 = %x, 期望 %x", again, data)
+			}
+		})
+	}
+}
+
+// normalize 把空切片统一为 nil，选项按编号排序，便于比较
+func normalize(m *Message) Message {
+	out := *m
+	if len(out.Token) == 0 {
+		out.Token = nil
+	}
+	if len(out.Payload) == 0 {
+		out.Payload = nil
+	}
+	out.Options = nil
+	for _, o := range m.Options {
+		if len(o.Value) == 0 {
+			o.Value = nil
+		}
+		out.Options = append(out.Options, o)
+	}
+	sort.SliceStable(out.Options, func(i, j int) bool { return out.Options[i].ID < out.Options[j].ID })
+	return out
+}
+
+func TestMessageAccessors(t *testing.T) {
+	m := &Message{Code: GET}
+	m.SetPath("devices/telemetry")
+	m.AddOption(OptionURIQuery, []byte("voucher=v1"))
+	m.AddOption(OptionURIQuery, []byte("flag"))
+	m.SetUint(OptionObserve, 1)
+	m.SetUint(OptionObserve, 0x123456)
+
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := got.Path(); p != "devices/telemetry" {
+		t.Errorf("Path() = %q", p)
+	}
+	if q := got.Query(); q["voucher"] != "v1" || len(q) != 2 {
+		t.Errorf("Query() = %v", q)
+	}
+	if v, ok := got.Uint(OptionObserve); !ok || v != 0x123456 {
+		t.Errorf("Uint(Observe) = %d, %v", v, ok)
+	}
+	if _, ok := got.Uint(OptionContentFormat); ok {
+		t.Errorf("不存在的选项应返回 false")
+	}
+	if Content.String() != "2.05" || !GET.IsRequest() || Content.IsRequest() || Empty.IsRequest() {
+		t.Errorf("响应码判断错误")
+	}
+}
+
+func TestUintOption(t *testing.T) {
+	for _, v := range []uint32{0, 1, 0xFF, 0x100, 0xFFFF, 0x10000, 0xFFFFFF, 0x1000000, 0xFFFFFFFF} {
+		if got := decodeUint(encodeUint(v)); got != v {
+			t.Errorf("decodeUint(encodeUint(%d)) = %d", v, got)
+		}
+	}
+	if len(encodeUint(0)) != 0 {
+		t.Errorf("0 应编码为空值")
+	}
+}
+
+func TestMessageMarshalError(t *testing.T) {
+	m := &Message{Token: make([]byte, 9)}
+	if _, err := m.Marshal(); err == nil {
+		t.Fatal("Token超过8字节应返回错误")
+	}
+	m = &Message{Options: []Option{{ID: OptionURIPath, Value: make([]byte, maxOptionLength+1)}}}
+	if _, err := m.Marshal(); err == nil {
+		t.Fatal("选项值超过最大长度应返回错误")
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"空报文", nil},
+		{"长度不足", []byte{0x40, 0x01, 0x00}},
+		{"版本错误", []byte{0x80, 0x01, 0x00, 0x01}},
+		{"Token长度超过8", []byte{0x49, 0x01, 0x00, 0x01, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"Token不完整", []byte{0x44, 0x01, 0x00, 0x01, 1, 2}},
+		{"负载标记后没有负载", []byte{0x40, 0x02, 0x00, 0x01, 0xFF}},
+		{"选项增量为15", []byte{0x40, 0x01, 0x00, 0x01, 0xF1, 'a'}},
+		{"选项长度为15", []byte{0x40, 0x01, 0x00, 0x01, 0x1F}},
+		{"缺少1字节扩展增量", []byte{0x40, 0x01, 0x00, 0x01, 0xD0}},
+		{"缺少2字节扩展长度", []byte{0x40, 0x01, 0x00, 0x01, 0x1E, 0x00}},
+		{"选项值不完整", []byte{0x40, 0x01, 0x00, 0x01, 0xB5, 'a', 'b'}},
+		{"选项编号超出范围", []byte{0x40, 0x01, 0x00, 0x01, 0xE0, 0xFF, 0xFF, 0xE0, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := Unmarshal(tt.data); err == nil {
+				t.Fatalf("应返回错误, 实际解码为 %+v", m)
+			}
+		})
+	}
+}
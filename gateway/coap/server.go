@@ -0,0 +1,650 @@
+// gateway/coap/server.go
+
+// Package coap 设备以CoAP接入：设备向资源 POST 遥测、属性和事件，
+// 对控制资源发起 Observe 接收控制指令；支持以设备凭证作为预共享密钥的 DTLS
+package coap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// UDP报文最大长度
+const maxDatagram = 65535
+
+// 每个对端缓存的确认消息响应数量，用于重复消息直接重发响应
+const responseCacheSize = 16
+
+// Resource 资源类型
+type Resource int
+
+// 资源类型
+const (
+	ResourceTelemetry  Resource = iota + 1 // 遥测，POST/PUT
+	ResourceAttributes                     // 属性，POST/PUT
+	ResourceEvent                          // 事件，POST，负载为 {"method":"...","params":{...}}
+	ResourceControl                        // 控制指令，GET + Observe
+)
+
+// DefaultResources 默认资源路径
+var DefaultResources = map[string]Resource{
+	"telemetry":  ResourceTelemetry,
+	"attributes": ResourceAttributes,
+	"event":      ResourceEvent,
+	"control":    ResourceControl,
+}
+
+// Config CoAP服务配置
+type Config struct {
+	Address     string          // UDP监听地址，ListenAndServe 使用，为空时不监听
+	DTLSAddress string          // DTLS监听地址，ListenAndServe 使用，为空时不监听
+	Bridge      *gateway.Bridge // 网关
+	Codec       gateway.Codec   // 遥测和属性负载编解码，默认JSON
+	// Resources 资源路径 -> 资源类型，默认 DefaultResources
+	Resources map[string]Resource
+	// PSK DTLS根据客户端的PSK身份返回密钥和设备ID，默认 DevicePSK
+	PSK func(ctx context.Context, identity []byte) (key []byte, deviceID string, err error)
+	// ObserveTTL 超过该时间未收到设备消息时取消订阅并将设备置为离线，默认10分钟
+	ObserveTTL time.Duration
+	// Workers 处理明文消息的协程数，消息按来源地址分配，同一地址的消息按顺序处理，默认8
+	Workers int
+	// QueueSize 每个处理协程的消息队列长度，队列已满时丢弃消息，默认64
+	QueueSize int
+	Logger    *log.Logger
+}
+
+// Server CoAP设备接入服务
+type Server struct {
+	config Config
+	logger *log.Logger
+
+	mu        sync.Mutex
+	closers   []func() error        // 监听的关闭函数
+	conns     map[net.Conn]struct{} // DTLS连接
+	peers     map[string]*peer      // 对端地址 -> 对端
+	observers map[string]*observer  // 设备ID -> 控制指令订阅
+	closed    bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+	nextMID   uint16
+}
+
+// NewServer 创建CoAP服务
+func NewServer(config Config) (*Server, error) {
+	if config.Bridge == nil {
+		return nil, fmt.Errorf("CoAP服务未配置网关")
+	}
+	if config.Codec == nil {
+		config.Codec = gateway.JSONCodec{}
+	}
+	if config.Resources == nil {
+		config.Resources = DefaultResources
+	}
+	if config.ObserveTTL <= 0 {
+		config.ObserveTTL = 10 * time.Minute
+	}
+	if config.Workers <= 0 {
+		config.Workers = 8
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 64
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = config.Bridge.Logger()
+	}
+	s := &Server{
+		config:    config,
+		logger:    logger,
+		conns:     make(map[net.Conn]struct{}),
+		peers:     make(map[string]*peer),
+		observers: make(map[string]*observer),
+		done:      make(chan struct{}),
+	}
+	if s.config.PSK == nil {
+		s.config.PSK = s.DevicePSK
+	}
+	return s, nil
+}
+
+// ListenAndServe 监听 Config.Address 和 Config.DTLSAddress，直到 ctx 取消或调用 Close
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.config.Address == "" && s.config.DTLSAddress == "" {
+		return fmt.Errorf("CoAP服务未配置监听地址")
+	}
+	errCh := make(chan error, 2)
+	n := 0
+	if s.config.Address != "" {
+		pc, err := net.ListenPacket("udp", s.config.Address)
+		if err != nil {
+			return fmt.Errorf("CoAP监听失败: %w", err)
+		}
+		n++
+		go func() { errCh <- s.Serve(ctx, pc) }()
+	}
+	if s.config.DTLSAddress != "" {
+		ln, err := s.ListenDTLS(s.config.DTLSAddress)
+		if err != nil {
+			s.Close()
+			return err
+		}
+		n++
+		go func() { errCh <- s.ServeDTLS(ctx, ln) }()
+	}
+
+	var first error
+	for i := 0; i < n; i++ {
+		if err := <-errCh; err != nil && first == nil {
+			first = err
+			s.Close()
+		}
+	}
+	return first
+}
+
+// Serve 在 pc 上处理明文CoAP消息，直到 ctx 取消或调用 Close
+func (s *Server) Serve(ctx context.Context, pc net.PacketConn) error {
+	if !s.track(pc.Close) {
+		pc.Close()
+		return net.ErrClosed
+	}
+	s.logger.Printf("CoAP服务已启动: %s", pc.LocalAddr())
+	stop := context.AfterFunc(ctx, func() { s.Close() })
+	defer stop()
+
+	// 认证设备可能请求平台接口，消息交给处理协程，读取循环不被阻塞
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queues := make([]chan request, s.config.Workers)
+	for i := range queues {
+		queues[i] = make(chan request, s.config.QueueSize)
+		s.wg.Add(1)
+		go func(queue <-chan request) {
+			defer s.wg.Done()
+			s.worker(ctx, pc, queue)
+		}(queues[i])
+	}
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("CoAP读取失败: %w", err)
+		}
+		// 消息格式正确后才分配处理，无效报文不会创建对端
+		m, err := Unmarshal(buf[:n])
+		if err != nil {
+			s.logger.Printf("CoAP消息格式错误: remote=%s, err=%v", addr, err)
+			continue
+		}
+		s.dispatch(queues, request{addr: addr, msg: m})
+	}
+}
+
+// request 待处理的明文消息
+type request struct {
+	addr net.Addr
+	msg  *Message
+}
+
+// dispatch 按来源地址把消息放入处理队列，队列已满时丢弃
+func (s *Server) dispatch(queues []chan request, req request) {
+	h := fnv.New32a()
+	h.Write([]byte(req.addr.String()))
+	select {
+	case queues[h.Sum32()%uint32(len(queues))] <- req:
+	default:
+		s.logger.Printf("CoAP消息处理队列已满，丢弃消息: remote=%s", req.addr)
+	}
+}
+
+// worker 依次处理队列中的消息，直到 ctx 取消
+func (s *Server) worker(ctx context.Context, pc net.PacketConn, queue <-chan request) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-queue:
+			addr := req.addr
+			p := s.peer(addr.String(), func(data []byte) error {
+				_, err := pc.WriteTo(data, addr)
+				return err
+			}, "")
+			s.handle(ctx, p, req.msg)
+		}
+	}
+}
+
+// Close 停止监听，取消全部订阅
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	closers := s.closers
+	conns := make([]net.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	observers := make([]*observer, 0, len(s.observers))
+	for _, o := range s.observers {
+		observers = append(observers, o)
+	}
+	s.observers = make(map[string]*observer)
+	s.peers = make(map[string]*peer)
+	s.mu.Unlock()
+
+	var err error
+	for _, c := range closers {
+		if e := c(); e != nil && err == nil && !errors.Is(e, net.ErrClosed) {
+			err = e
+		}
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+	for _, o := range observers {
+		s.config.Bridge.Detach(o.deviceID, o)
+	}
+	s.wg.Wait()
+	return err
+}
+
+// track 登记需要在 Close 时关闭的资源，首次登记时启动清理协程，服务已关闭时返回 false
+func (s *Server) track(closer func() error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if len(s.closers) == 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.janitor()
+		}()
+	}
+	s.closers = append(s.closers, closer)
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// peer 返回对端，不存在时创建
+func (s *Server) peer(key string, send func([]byte) error, deviceID string) *peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.peers[key]
+	if !ok {
+		p = &peer{key: key, send: send, deviceID: deviceID, responses: make(map[uint16][]byte)}
+		p.persistent = deviceID != ""
+		s.peers[key] = p
+	}
+	p.lastSeen = time.Now()
+	return p
+}
+
+func (s *Server) messageID() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextMID++
+	return s.nextMID
+}
+
+// handle 处理一个CoAP消息
+func (s *Server) handle(ctx context.Context, p *peer, m *Message) {
+	switch m.Type {
+	case Reset:
+		s.handleReset(p, m.MessageID)
+		return
+	case Acknowledgement:
+		return
+	}
+	if m.Code == Empty {
+		// CoAP ping
+		if m.Type == Confirmable {
+			s.write(p, &Message{Type: Reset, MessageID: m.MessageID})
+		}
+		return
+	}
+	if !m.Code.IsRequest() {
+		return
+	}
+	if m.Type == Confirmable {
+		if resp, ok := p.response(m.MessageID); ok {
+			p.send(resp)
+			return
+		}
+	}
+
+	resp := s.serve(ctx, p, m)
+	resp.Token = m.Token
+	if m.Type == Confirmable {
+		resp.Type = Acknowledgement
+		resp.MessageID = m.MessageID
+	} else {
+		resp.Type = NonConfirmable
+		resp.MessageID = s.messageID()
+	}
+	data, err := resp.Marshal()
+	if err != nil {
+		s.logger.Printf("CoAP响应编码失败: %v", err)
+		return
+	}
+	if m.Type == Confirmable {
+		p.cache(m.MessageID, data)
+	}
+	if err := p.send(data); err != nil {
+		s.logger.Printf("CoAP响应发送失败: remote=%s, err=%v", p.key, err)
+	}
+}
+
+func (s *Server) write(p *peer, m *Message) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	return p.send(data)
+}
+
+// serve 处理请求，返回响应
+func (s *Server) serve(ctx context.Context, p *peer, m *Message) *Message {
+	path := m.Path()
+	res, ok := s.config.Resources[path]
+	if !ok {
+		return errorResponse(NotFound, "资源不存在: "+path)
+	}
+	deviceID, err := s.authenticate(ctx, p, m)
+	if err != nil {
+		s.logger.Printf("CoAP设备认证失败: remote=%s, err=%v", p.key, err)
+		return errorResponse(Unauthorized, "设备认证失败")
+	}
+	s.config.Bridge.Touch(deviceID)
+	s.touchObserver(deviceID)
+
+	switch res {
+	case ResourceTelemetry, ResourceAttributes:
+		if m.Code != POST && m.Code != PUT {
+			return errorResponse(MethodNotAllowed, "")
+		}
+		values, err := s.config.Codec.Decode(m.Payload)
+		if err != nil {
+			return errorResponse(BadRequest, err.Error())
+		}
+		publish := s.config.Bridge.Publish
+		if res == ResourceAttributes {
+			publish = s.config.Bridge.PublishAttributes
+		}
+		if err := publish(ctx, deviceID, values); err != nil {
+			s.logger.Printf("CoAP上报失败: deviceID=%s, path=%s, err=%v", deviceID, path, err)
+			return errorResponse(ServiceUnavailable, "")
+		}
+		return &Message{Code: Changed}
+
+	case ResourceEvent:
+		if m.Code != POST {
+			return errorResponse(MethodNotAllowed, "")
+		}
+		var event gateway.Event
+		if err := json.Unmarshal(m.Payload, &event); err != nil {
+			return errorResponse(BadRequest, "事件格式错误")
+		}
+		if err := s.config.Bridge.PublishEvent(ctx, deviceID, event); err != nil {
+			s.logger.Printf("CoAP事件上报失败: deviceID=%s, err=%v", deviceID, err)
+			return errorResponse(BadRequest, err.Error())
+		}
+		return &Message{Code: Changed}
+
+	case ResourceControl:
+		if m.Code != GET {
+			return errorResponse(MethodNotAllowed, "")
+		}
+		resp := &Message{Code: Content}
+		obs, ok := m.Uint(OptionObserve)
+		switch {
+		case ok && obs == 0:
+			o := s.observe(p, deviceID, m.Token)
+			resp.SetUint(OptionObserve, o.nextSeq())
+		case ok && obs == 1:
+			s.cancelObserve(deviceID, m.Token)
+		}
+		return resp
+
+	default:
+		return errorResponse(NotFound, "")
+	}
+}
+
+// authenticate 识别请求的设备：DTLS连接使用握手时的PSK身份，
+// 明文请求从 Uri-Query 读取 voucher、access_token 或 username/password
+func (s *Server) authenticate(ctx context.Context, p *peer, m *Message) (string, error) {
+	if p.deviceID != "" {
+		return p.deviceID, nil
+	}
+	q := m.Query()
+	var voucher string
+	switch {
+	case q["voucher"] != "":
+		voucher = q["voucher"]
+	case q["access_token"] != "":
+		voucher = types.NewAccessTokenVoucher(q["access_token"]).String()
+	case q["username"] != "" && q["password"] != "":
+		voucher = types.NewBasicVoucher(q["username"], q["password"]).String()
+	case q["username"] != "":
+		voucher = types.NewUsernameVoucher(q["username"]).String()
+	default:
+		return "", fmt.Errorf("缺少设备凭证")
+	}
+	entry, err := s.config.Bridge.Resolve(ctx, gateway.Identity{Voucher: voucher})
+	if err != nil {
+		return "", err
+	}
+	return entry.ID, nil
+}
+
+func errorResponse(code Code, msg string) *Message {
+	m := &Message{Code: code}
+	if msg != "" {
+		m.SetUint(OptionContentFormat, FormatText)
+		m.Payload = []byte(msg)
+	}
+	return m
+}
+
+// observe 登记设备的控制指令订阅，替换设备已有的订阅
+func (s *Server) observe(p *peer, deviceID string, token []byte) *observer {
+	o := &observer{server: s, peer: p, deviceID: deviceID, token: append([]byte(nil), token...), lastSeen: time.Now()}
+	s.mu.Lock()
+	s.observers[deviceID] = o
+	s.mu.Unlock()
+	s.config.Bridge.Attach(deviceID, o)
+	return o
+}
+
+// cancelObserve 取消订阅
+func (s *Server) cancelObserve(deviceID string, token []byte) {
+	s.mu.Lock()
+	o, ok := s.observers[deviceID]
+	if ok && string(o.token) == string(token) {
+		delete(s.observers, deviceID)
+	} else {
+		ok = false
+	}
+	s.mu.Unlock()
+	if ok {
+		s.config.Bridge.Detach(deviceID, o)
+	}
+}
+
+func (s *Server) touchObserver(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.observers[deviceID]; ok {
+		o.lastSeen = time.Now()
+	}
+}
+
+// handleReset 设备以RST回复通知时取消订阅
+func (s *Server) handleReset(p *peer, mid uint16) {
+	s.mu.Lock()
+	var found *observer
+	for id, o := range s.observers {
+		if o.peer == p && o.lastMID == mid {
+			found = o
+			delete(s.observers, id)
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found != nil {
+		s.logger.Printf("设备拒绝控制指令通知，取消订阅: deviceID=%s", found.deviceID)
+		s.config.Bridge.Detach(found.deviceID, found)
+	}
+}
+
+// janitor 定期清理过期的订阅和对端
+func (s *Server) janitor() {
+	interval := s.config.ObserveTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.expire(time.Now())
+		}
+	}
+}
+
+func (s *Server) expire(now time.Time) {
+	s.mu.Lock()
+	var expired []*observer
+	for id, o := range s.observers {
+		if now.Sub(o.lastSeen) >= s.config.ObserveTTL {
+			expired = append(expired, o)
+			delete(s.observers, id)
+		}
+	}
+	for key, p := range s.peers {
+		if now.Sub(p.lastSeen) >= s.config.ObserveTTL && !p.persistent {
+			delete(s.peers, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, o := range expired {
+		s.logger.Printf("控制指令订阅过期: deviceID=%s", o.deviceID)
+		s.config.Bridge.Detach(o.deviceID, o)
+	}
+}
+
+// peer 一个对端地址或DTLS连接
+type peer struct {
+	key        string
+	send       func([]byte) error
+	deviceID   string // DTLS握手认证的设备ID
+	persistent bool   // DTLS连接，连接关闭时删除，不按时间过期
+	lastSeen   time.Time
+
+	mu        sync.Mutex
+	responses map[uint16][]byte
+	order     []uint16
+}
+
+func (p *peer) response(mid uint16) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, ok := p.responses[mid]
+	return data, ok
+}
+
+func (p *peer) cache(mid uint16, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.responses[mid]; !ok {
+		p.order = append(p.order, mid)
+	}
+	p.responses[mid] = data
+	if len(p.order) > responseCacheSize {
+		delete(p.responses, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+// observer 设备对控制资源的订阅，实现 gateway.Session
+type observer struct {
+	server   *Server
+	peer     *peer
+	deviceID string
+	token    []byte
+	lastSeen time.Time // 受 server.mu 保护
+
+	mu      sync.Mutex
+	seq     uint32
+	lastMID uint16 // 受 server.mu 保护
+}
+
+func (o *observer) nextSeq() uint32 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq = (o.seq + 1) & 0xFFFFFF
+	return o.seq
+}
+
+// Send 以Observe通知下发控制指令
+func (o *observer) Send(_ context.Context, values driver.Values) error {
+	s := o.server
+	payload, err := s.config.Codec.Encode(values)
+	if err != nil {
+		return fmt.Errorf("编码控制指令失败: %w", err)
+	}
+	mid := s.messageID()
+	m := &Message{Type: NonConfirmable, Code: Content, MessageID: mid, Token: o.token, Payload: payload}
+	m.SetUint(OptionObserve, o.nextSeq())
+	if _, ok := s.config.Codec.(gateway.JSONCodec); ok {
+		m.SetUint(OptionContentFormat, FormatJSON)
+	} else {
+		m.SetUint(OptionContentFormat, FormatOctets)
+	}
+
+	s.mu.Lock()
+	o.lastMID = mid
+	s.mu.Unlock()
+	return s.write(o.peer, m)
+}
+
+// Close 取消订阅
+func (o *observer) Close() error {
+	s := o.server
+	s.mu.Lock()
+	if s.observers[o.deviceID] == o {
+		delete(s.observers, o.deviceID)
+	}
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,228 @@
+// gateway/coap/server_test.go
+
+package coap
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v2"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+var discardLogger = log.New(io.Discard, "", 0)
+
+// newTestServer 创建服务，注册表中有设备 d1（凭证 v1），未知凭证会请求 platform
+func newTestServer(t *testing.T, platform http.HandlerFunc, config Config) *Server {
+	t.Helper()
+	api := httptest.NewServer(platform)
+	t.Cleanup(api.Close)
+	registry := client.NewDeviceRegistry(client.NewDeviceAPI(client.NewAPIClient(api.URL, client.WithLogger(discardLogger))))
+	registry.AddDevice(types.Device{ID: "d1", DeviceNumber: "SN1", Voucher: "v1"})
+	config.Bridge = gateway.New(gateway.Config{Registry: registry, Logger: discardLogger})
+	config.Logger = discardLogger
+	srv, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// send 发送确认请求并等待响应
+func send(t *testing.T, conn net.Conn, mid uint16, voucher string) (*Message, error) {
+	t.Helper()
+	m := &Message{Type: Confirmable, Code: POST, MessageID: mid, Payload: []byte(`{"temp":1}`)}
+	m.SetPath("telemetry")
+	m.AddOption(OptionURIQuery, []byte("voucher="+voucher))
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxDatagram)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(buf[:n])
+}
+
+func TestServeSlowAuthDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, Config{})
+	t.Cleanup(func() { close(release) })
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), pc)
+
+	slow, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	// 未知凭证的认证阻塞在平台接口上
+	m := &Message{Type: Confirmable, Code: POST, MessageID: 1}
+	m.SetPath("telemetry")
+	m.AddOption(OptionURIQuery, []byte("voucher=unknown"))
+	data, _ := m.Marshal()
+	slow.Write(data)
+
+	resp, err := send(t, fast, 2, "v1")
+	if err != nil {
+		t.Fatalf("其他设备的请求被阻塞: %v", err)
+	}
+	if resp.Type != Acknowledgement || resp.MessageID != 2 {
+		t.Errorf("响应 = %+v", resp)
+	}
+}
+
+func TestServeMalformedCreatesNoPeer(t *testing.T) {
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {}, Config{})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), pc)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 10; i++ {
+		conn.Write([]byte{0x80, 0x01, 0x00, byte(i)})
+	}
+	// 同一来源地址的消息按顺序处理，收到响应时之前的报文已被读取
+	if _, err := send(t, conn, 100, "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	peers := len(srv.peers)
+	srv.mu.Unlock()
+	if peers != 1 {
+		t.Errorf("对端数量 = %d, 期望只有发送有效消息的 1 个", peers)
+	}
+}
+
+func TestServeDTLSSlowHandshake(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {}, Config{
+		PSK: func(ctx context.Context, identity []byte) ([]byte, string, error) {
+			if string(identity) == "slow" {
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+				return nil, "", ctx.Err()
+			}
+			return []byte("secret"), "d1", nil
+		},
+	})
+	ln, err := srv.ListenDTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeDTLS(context.Background(), ln)
+	addr := ln.Addr().(*net.UDPAddr)
+
+	dial := func(ctx context.Context, identity string) (*dtls.Conn, error) {
+		return dtls.DialWithContext(ctx, "udp", addr, &dtls.Config{
+			PSK:             func([]byte) ([]byte, error) { return []byte("secret"), nil },
+			PSKIdentityHint: []byte(identity),
+			CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		})
+	}
+
+	slowCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dial(slowCtx, "slow")
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancelFast := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelFast()
+	conn, err := dial(ctx, "dev")
+	if err != nil {
+		t.Fatalf("握手被其他连接阻塞: %v", err)
+	}
+	defer conn.Close()
+
+	resp, err := send(t, conn, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != Acknowledgement {
+		t.Errorf("响应 = %+v", resp)
+	}
+}
+
+func TestServeDTLSConnTracking(t *testing.T) {
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {}, Config{
+		PSK: func(context.Context, []byte) ([]byte, string, error) { return []byte("secret"), "d1", nil },
+	})
+	ln, err := srv.ListenDTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeDTLS(context.Background(), ln)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		conn, err := dtls.DialWithContext(ctx, "udp", ln.Addr().(*net.UDPAddr), &dtls.Config{
+			PSK:             func([]byte) ([]byte, error) { return []byte("secret"), nil },
+			PSKIdentityHint: []byte("dev"),
+			CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		})
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := send(t, conn, uint16(i), ""); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+
+	// 连接关闭后从服务中移除
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		srv.mu.Lock()
+		conns, closers := len(srv.conns), len(srv.closers)
+		srv.mu.Unlock()
+		if conns == 0 && closers == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("连接 %d 个, 关闭函数 %d 个, 期望 0 和 1", conns, closers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+// gateway/codec.go
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+)
+
+// Identity 设备身份，按 DeviceID、Voucher、DeviceNumber 的优先级解析
+type Identity struct {
+	DeviceID     string `json:"device_id,omitempty"`
+	DeviceNumber string `json:"device_number,omitempty"`
+	Voucher      string `json:"voucher,omitempty"`
+}
+
+// ParseIdentity 默认的注册包解析：JSON对象读取 device_id、device_number、voucher 字段，
+// voucher 可以是字符串或对象；其他内容去掉首尾空白后作为设备编号
+func ParseIdentity(data []byte) (Identity, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return Identity{}, fmt.Errorf("注册包为空")
+	}
+	if trimmed[0] != '{' {
+		return Identity{DeviceNumber: string(trimmed)}, nil
+	}
+
+	var msg struct {
+		DeviceID     string          `json:"device_id"`
+		DeviceNumber string          `json:"device_number"`
+		Voucher      json.RawMessage `json:"voucher"`
+	}
+	if err := json.Unmarshal(trimmed, &msg); err != nil {
+		return Identity{}, fmt.Errorf("注册包格式错误: %w", err)
+	}
+	id := Identity{DeviceID: msg.DeviceID, DeviceNumber: msg.DeviceNumber}
+	if len(msg.Voucher) > 0 && string(msg.Voucher) != "null" {
+		var s string
+		if err := json.Unmarshal(msg.Voucher, &s); err == nil {
+			id.Voucher = s
+		} else {
+			id.Voucher = string(msg.Voucher)
+		}
+	}
+	if id == (Identity{}) {
+		return Identity{}, fmt.Errorf("注册包缺少设备身份")
+	}
+	return id, nil
+}
+
+// Codec 设备报文编解码
+type Codec interface {
+	// Decode 将上行报文解码为点位值
+	Decode(data []byte) (driver.Values, error)
+	// Encode 将控制指令编码为下行报文
+	Encode(values driver.Values) ([]byte, error)
+}
+
+// JSONCodec 报文为JSON对象
+type JSONCodec struct{}
+
+// Decode 解码JSON对象
+func (JSONCodec) Decode(data []byte) (driver.Values, error) {
+	var values driver.Values
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("报文格式错误: %w", err)
+	}
+	return values, nil
+}
+
+// Encode 编码为JSON对象
+func (JSONCodec) Encode(values driver.Values) ([]byte, error) {
+	return json.Marshal(values)
+}
+
+// CodecFuncs 由函数组成的编解码器，适合自定义二进制协议
+type CodecFuncs struct {
+	DecodeFunc func(data []byte) (driver.Values, error)
+	EncodeFunc func(values driver.Values) ([]byte, error)
+}
+
+// Decode 调用 DecodeFunc
+func (c CodecFuncs) Decode(data []byte) (driver.Values, error) {
+	if c.DecodeFunc == nil {
+		return nil, fmt.Errorf("未实现上行报文解码")
+	}
+	return c.DecodeFunc(data)
+}
+
+// Encode 调用 EncodeFunc
+func (c CodecFuncs) Encode(values driver.Values) ([]byte, error) {
+	if c.EncodeFunc == nil {
+		return nil, fmt.Errorf("未实现下行报文编码")
+	}
+	return c.EncodeFunc(values)
+}
@@ -0,0 +1,363 @@
+// gateway/gateway.go
+
+// Package gateway 提供设备直连接入的公共部分：设备身份解析、遥测上报、
+// 控制指令按设备路由到连接以及平台通知断开时关闭连接，
+// tcp、udp 等子包实现具体的传输方式
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+)
+
+// 上报主题，相对于 plugin/{服务标识符}/，属性和事件主题后面跟消息ID
+const (
+	AttributesTopic = "devices/attributes" // 属性上报主题
+	EventTopic      = "devices/event"      // 事件上报主题
+)
+
+// 下发订阅主题，相对于 plugin/{服务标识符}/，倒数第二级为设备ID，最后一级为消息ID
+const (
+	AttributesSetTopic = "devices/attributes/set/+/+" // 属性设置
+	CommandTopic       = "devices/command/+/+"        // 命令
+)
+
+// DownlinkType 下发消息类型
+type DownlinkType string
+
+// 下发消息类型
+const (
+	DownlinkControl       DownlinkType = "control"        // 控制指令
+	DownlinkAttributesSet DownlinkType = "attributes_set" // 属性设置
+	DownlinkCommand       DownlinkType = "command"        // 命令
+)
+
+// Downlink 平台下发的消息
+type Downlink struct {
+	Type      DownlinkType  `json:"type"`
+	MessageID string        `json:"message_id,omitempty"`
+	Method    string        `json:"method,omitempty"` // 命令方法
+	Values    driver.Values `json:"values,omitempty"` // 控制指令、属性设置的值或命令参数
+}
+
+// DownlinkSession 可接收属性设置和命令的连接，未实现时这两类消息被丢弃
+type DownlinkSession interface {
+	Session
+	SendDownlink(ctx context.Context, d Downlink) error
+}
+
+// Event 设备事件
+type Event struct {
+	Method string        `json:"method"`
+	Params driver.Values `json:"params"`
+}
+
+// Session 设备连接，由传输层实现
+type Session interface {
+	// Send 向设备下发控制指令
+	Send(ctx context.Context, values driver.Values) error
+	// Close 关闭连接
+	Close() error
+}
+
+// Config 网关配置
+type Config struct {
+	ServiceIdentifier string                 // 服务标识符，用于主题前缀 plugin/{服务标识符}/
+	MQTT              driver.MQTT            // MQTT客户端
+	Registry          *client.DeviceRegistry // 设备注册表，用于解析设备身份
+	Status            *client.StatusManager  // 设备状态管理，可为空；设备连接时上线，断开时离线
+	QoS               byte                   // 遥测消息QoS
+	Logger            *log.Logger
+	// Fallback 控制指令的目标设备没有连接时调用，可为空；
+	// 与 driver.Runtime 同时使用时设为 runtime.Write，由网关统一订阅控制主题
+	Fallback func(ctx context.Context, deviceID string, values driver.Values) error
+	// Downlinks 为 true 时 Start 额外订阅属性设置和命令主题，转发给实现 DownlinkSession 的连接；
+	// 默认关闭，此时只订阅控制主题，已有传输层的行为不变
+	Downlinks bool
+}
+
+// Bridge 连接设备与平台，传输层在设备完成身份识别后调用 Attach 登记连接
+type Bridge struct {
+	config Config
+	logger *log.Logger
+	prefix string
+
+	mu       sync.RWMutex
+	sessions map[string]Session // 设备ID -> 连接
+}
+
+// New 创建网关
+func New(config Config) *Bridge {
+	logger := config.Logger
+	if logger == nil {
+		logger = log.New(log.Writer(), "[TP-Gateway] ", log.LstdFlags|log.Lshortfile)
+	}
+	return &Bridge{
+		config:   config,
+		logger:   logger,
+		prefix:   "plugin/" + config.ServiceIdentifier + "/",
+		sessions: make(map[string]Session),
+	}
+}
+
+// Logger 返回网关日志
+func (b *Bridge) Logger() *log.Logger {
+	return b.logger
+}
+
+// Start 订阅控制下发主题，Config.Downlinks 为 true 时同时订阅属性设置和命令主题
+func (b *Bridge) Start() error {
+	if b.config.MQTT == nil {
+		return fmt.Errorf("网关未配置MQTT客户端")
+	}
+	if err := b.config.MQTT.SubscribeContext(b.prefix+driver.ControlTopic, 1, b.handleControl); err != nil {
+		return fmt.Errorf("订阅控制主题失败: %w", err)
+	}
+	if !b.config.Downlinks {
+		return nil
+	}
+	if err := b.config.MQTT.SubscribeContext(b.prefix+AttributesSetTopic, 1, b.handleAttributesSet); err != nil {
+		return fmt.Errorf("订阅属性设置主题失败: %w", err)
+	}
+	if err := b.config.MQTT.SubscribeContext(b.prefix+CommandTopic, 1, b.handleCommand); err != nil {
+		return fmt.Errorf("订阅命令主题失败: %w", err)
+	}
+	return nil
+}
+
+// Resolve 解析设备身份，依次按设备ID、凭证、设备编号查找，注册表中没有时从平台获取
+func (b *Bridge) Resolve(ctx context.Context, id Identity) (*client.DeviceEntry, error) {
+	if b.config.Registry == nil {
+		return nil, fmt.Errorf("网关未配置设备注册表")
+	}
+	switch {
+	case id.DeviceID != "":
+		return b.config.Registry.ResolveID(ctx, id.DeviceID)
+	case id.Voucher != "":
+		return b.config.Registry.ResolveVoucher(ctx, id.Voucher)
+	case id.DeviceNumber != "":
+		return b.config.Registry.ResolveNumber(ctx, id.DeviceNumber)
+	default:
+		return nil, fmt.Errorf("设备身份为空")
+	}
+}
+
+// Authenticate 按凭证认证设备身份：身份必须携带凭证，同时带有设备ID或设备编号时须与凭证对应的设备一致
+func (b *Bridge) Authenticate(ctx context.Context, id Identity) (*client.DeviceEntry, error) {
+	if id.Voucher == "" {
+		return nil, fmt.Errorf("设备身份缺少凭证")
+	}
+	entry, err := b.Resolve(ctx, Identity{Voucher: id.Voucher})
+	if err != nil {
+		return nil, err
+	}
+	if (id.DeviceID != "" && id.DeviceID != entry.ID) || (id.DeviceNumber != "" && id.DeviceNumber != entry.Number) {
+		return nil, fmt.Errorf("设备身份与凭证不符: deviceID=%s, deviceNumber=%s", id.DeviceID, id.DeviceNumber)
+	}
+	return entry, nil
+}
+
+// Publish 上报设备遥测
+func (b *Bridge) Publish(ctx context.Context, deviceID string, values driver.Values) error {
+	if b.config.MQTT == nil {
+		return fmt.Errorf("网关未配置MQTT客户端")
+	}
+	payload, err := json.Marshal(driver.TelemetryMessage{DeviceID: deviceID, Values: values})
+	if err != nil {
+		return fmt.Errorf("序列化遥测失败: %w", err)
+	}
+	return b.config.MQTT.PublishContext(ctx, b.prefix+driver.TelemetryTopic, b.config.QoS, payload)
+}
+
+// PublishAttributes 上报设备属性
+func (b *Bridge) PublishAttributes(ctx context.Context, deviceID string, values driver.Values) error {
+	return b.publishMessage(ctx, AttributesTopic, deviceID, values)
+}
+
+// PublishEvent 上报设备事件
+func (b *Bridge) PublishEvent(ctx context.Context, deviceID string, event Event) error {
+	if event.Method == "" {
+		return fmt.Errorf("事件缺少method")
+	}
+	return b.publishMessage(ctx, EventTopic, deviceID, driver.Values{"method": event.Method, "params": event.Params})
+}
+
+// publishMessage 发布到带消息ID的主题
+func (b *Bridge) publishMessage(ctx context.Context, topic, deviceID string, values driver.Values) error {
+	if b.config.MQTT == nil {
+		return fmt.Errorf("网关未配置MQTT客户端")
+	}
+	payload, err := json.Marshal(driver.TelemetryMessage{DeviceID: deviceID, Values: values})
+	if err != nil {
+		return fmt.Errorf("序列化消息失败: %w", err)
+	}
+	return b.config.MQTT.PublishContext(ctx, b.prefix+topic+"/"+newMessageID(), b.config.QoS, payload)
+}
+
+func newMessageID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Attach 登记设备连接，设备已有连接时关闭旧连接
+func (b *Bridge) Attach(deviceID string, s Session) {
+	b.mu.Lock()
+	old, ok := b.sessions[deviceID]
+	b.sessions[deviceID] = s
+	b.mu.Unlock()
+
+	if ok && old != s {
+		b.logger.Printf("设备重复连接，关闭旧连接: deviceID=%s", deviceID)
+		old.Close()
+	}
+	if b.config.Status != nil {
+		b.config.Status.Touch(deviceID)
+	}
+	b.logger.Printf("设备已连接: deviceID=%s", deviceID)
+}
+
+// Detach 注销设备连接，仅当 s 为当前登记的连接时生效
+func (b *Bridge) Detach(deviceID string, s Session) {
+	b.mu.Lock()
+	cur, ok := b.sessions[deviceID]
+	if ok && cur == s {
+		delete(b.sessions, deviceID)
+	}
+	b.mu.Unlock()
+
+	if ok && cur == s {
+		if b.config.Status != nil {
+			b.config.Status.SetOffline(deviceID)
+		}
+		b.logger.Printf("设备已断开: deviceID=%s", deviceID)
+	}
+}
+
+// Session 返回设备当前连接
+func (b *Bridge) Session(deviceID string) (Session, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	s, ok := b.sessions[deviceID]
+	return s, ok
+}
+
+// Touch 记录设备活动，用于没有持久连接的传输方式
+func (b *Bridge) Touch(deviceID string) {
+	if b.config.Status != nil {
+		b.config.Status.Touch(deviceID)
+	}
+}
+
+// Send 向设备下发控制指令，设备没有连接时交给 Fallback 处理
+func (b *Bridge) Send(ctx context.Context, deviceID string, values driver.Values) error {
+	if s, ok := b.Session(deviceID); ok {
+		return s.Send(ctx, values)
+	}
+	if b.config.Fallback != nil {
+		return b.config.Fallback(ctx, deviceID, values)
+	}
+	return fmt.Errorf("设备未连接: deviceID=%s", deviceID)
+}
+
+// SendDownlink 向设备下发消息，控制指令同 Send；属性设置和命令要求连接实现 DownlinkSession
+func (b *Bridge) SendDownlink(ctx context.Context, deviceID string, d Downlink) error {
+	s, ok := b.Session(deviceID)
+	if ds, isDownlink := s.(DownlinkSession); ok && isDownlink {
+		return ds.SendDownlink(ctx, d)
+	}
+	if d.Type == DownlinkControl {
+		return b.Send(ctx, deviceID, d.Values)
+	}
+	if !ok {
+		return fmt.Errorf("设备未连接: deviceID=%s", deviceID)
+	}
+	return fmt.Errorf("设备连接不支持%s消息: deviceID=%s", d.Type, deviceID)
+}
+
+// HandleDisconnect 平台通知设备断开时关闭设备连接，签名与 handler.Handler.AddDisconnectListener 的监听器一致
+func (b *Bridge) HandleDisconnect(_ context.Context, deviceID string) {
+	s, ok := b.Session(deviceID)
+	if !ok {
+		return
+	}
+	b.logger.Printf("平台通知设备断开，关闭连接: deviceID=%s", deviceID)
+	s.Close()
+	b.Detach(deviceID, s)
+}
+
+// handleControl 处理平台下发的控制指令
+func (b *Bridge) handleControl(ctx context.Context, topic string, payload []byte) {
+	deviceID, values, err := driver.ParseControl(topic, payload)
+	if err != nil {
+		b.logger.Printf("%v: topic=%s", err, topic)
+		return
+	}
+	if err := b.Send(ctx, deviceID, values); err != nil {
+		b.logger.Printf("控制指令下发失败: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	b.logger.Printf("控制指令下发成功: deviceID=%s", deviceID)
+}
+
+// handleAttributesSet 处理平台下发的属性设置
+func (b *Bridge) handleAttributesSet(ctx context.Context, topic string, payload []byte) {
+	deviceID, messageID, err := parseDownlinkTopic(topic)
+	if err != nil {
+		b.logger.Printf("%v: topic=%s", err, topic)
+		return
+	}
+	var values driver.Values
+	if err := json.Unmarshal(payload, &values); err != nil {
+		b.logger.Printf("属性设置格式错误: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	d := Downlink{Type: DownlinkAttributesSet, MessageID: messageID, Values: values}
+	if err := b.SendDownlink(ctx, deviceID, d); err != nil {
+		b.logger.Printf("属性设置下发失败: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	b.logger.Printf("属性设置下发成功: deviceID=%s, messageID=%s", deviceID, messageID)
+}
+
+// handleCommand 处理平台下发的命令，负载为 {"method":"...","params":{...}}
+func (b *Bridge) handleCommand(ctx context.Context, topic string, payload []byte) {
+	deviceID, messageID, err := parseDownlinkTopic(topic)
+	if err != nil {
+		b.logger.Printf("%v: topic=%s", err, topic)
+		return
+	}
+	var cmd Event
+	if err := json.Unmarshal(payload, &cmd); err != nil || cmd.Method == "" {
+		b.logger.Printf("命令格式错误: deviceID=%s, payload=%s", deviceID, payload)
+		return
+	}
+	d := Downlink{Type: DownlinkCommand, MessageID: messageID, Method: cmd.Method, Values: cmd.Params}
+	if err := b.SendDownlink(ctx, deviceID, d); err != nil {
+		b.logger.Printf("命令下发失败: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	b.logger.Printf("命令下发成功: deviceID=%s, messageID=%s", deviceID, messageID)
+}
+
+// parseDownlinkTopic 从下发主题中取设备ID和消息ID
+func parseDownlinkTopic(topic string) (deviceID, messageID string, err error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", fmt.Errorf("下发主题缺少设备ID或消息ID")
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
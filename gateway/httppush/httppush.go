@@ -0,0 +1,418 @@
+// gateway/httppush/httppush.go
+
+// Package httppush 设备以HTTP POST接入：设备使用凭证上报遥测、属性和事件，
+// 平台下发的控制指令暂存在队列中，随下一次请求的响应返回
+package httppush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// 设备接口路径
+const (
+	PathTelemetry  = "/api/v1/device/telemetry"  // POST 上报遥测
+	PathAttributes = "/api/v1/device/attributes" // POST 上报属性
+	PathEvent      = "/api/v1/device/event"      // POST 上报事件，请求体为 {"method":"...","params":{...}}
+	PathCommands   = "/api/v1/device/commands"   // GET 获取待下发的控制指令
+)
+
+// HeaderVoucher 携带设备凭证原文的请求头
+const HeaderVoucher = "X-TP-Voucher"
+
+// Config HTTP接入配置
+type Config struct {
+	Bridge *gateway.Bridge // 网关
+	Codec  gateway.Codec   // 遥测和属性请求体编解码，默认JSON
+	// MaxBodyBytes 请求体大小上限，默认1MB
+	MaxBodyBytes int64
+	// QueueSize 每个设备暂存的控制指令数量上限，超出时丢弃最早的指令，默认32
+	QueueSize int
+	// CommandTTL 控制指令暂存时间，超时未被设备取走的指令丢弃，默认10分钟
+	CommandTTL time.Duration
+	// SessionTTL 超过该时间未收到设备请求时注销设备并置为离线，默认10分钟
+	SessionTTL time.Duration
+	Logger     *log.Logger
+}
+
+// Commands 响应中的待下发指令
+type Commands struct {
+	Commands []driver.Values `json:"commands"`
+}
+
+// Handler 设备HTTP接入处理器
+type Handler struct {
+	config Config
+	logger *log.Logger
+	mux    *http.ServeMux
+
+	mu    sync.Mutex
+	boxes map[string]*mailbox // 设备ID -> 指令队列
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New 创建HTTP接入处理器并启动清理协程，不再使用时调用 Stop
+func New(config Config) (*Handler, error) {
+	if config.Bridge == nil {
+		return nil, fmt.Errorf("HTTP接入未配置网关")
+	}
+	if config.Codec == nil {
+		config.Codec = gateway.JSONCodec{}
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 32
+	}
+	if config.CommandTTL <= 0 {
+		config.CommandTTL = 10 * time.Minute
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = 10 * time.Minute
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = config.Bridge.Logger()
+	}
+
+	h := &Handler{config: config, logger: logger, boxes: make(map[string]*mailbox)}
+	h.mux = http.NewServeMux()
+	for _, rt := range h.Routes() {
+		h.mux.Handle(rt.Method+" "+rt.Path, rt.Handler)
+	}
+	h.Start()
+	return h, nil
+}
+
+// Routes 返回设备接口路由，可挂载到 gin、echo、chi 等任意路由框架
+func (h *Handler) Routes() []handler.Route {
+	return []handler.Route{
+		{Name: "device_telemetry", Method: http.MethodPost, Path: PathTelemetry, Handler: http.HandlerFunc(h.handleTelemetry)},
+		{Name: "device_attributes", Method: http.MethodPost, Path: PathAttributes, Handler: http.HandlerFunc(h.handleAttributes)},
+		{Name: "device_event", Method: http.MethodPost, Path: PathEvent, Handler: http.HandlerFunc(h.handleEvent)},
+		{Name: "device_commands", Method: http.MethodGet, Path: PathCommands, Handler: http.HandlerFunc(h.handleCommands)},
+	}
+}
+
+// Register 将设备接口注册到回调服务，与回调接口共用同一端口，不经过回调认证
+func (h *Handler) Register(hh *handler.Handler) {
+	for _, rt := range h.Routes() {
+		hh.Handle(rt.Method, rt.Path, rt.Handler)
+	}
+}
+
+// ServeHTTP 实现 http.Handler 接口
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Start 启动清理协程，注销超过 SessionTTL 未请求的设备；
+// New 已经启动，Stop 之后需要继续使用时再调用
+func (h *Handler) Start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stop != nil {
+		return
+	}
+	h.stop = make(chan struct{})
+	h.wg.Add(1)
+	go func(stop chan struct{}) {
+		defer h.wg.Done()
+		h.janitor(stop)
+	}(h.stop)
+}
+
+// Stop 停止清理协程并注销全部设备
+func (h *Handler) Stop() {
+	h.mu.Lock()
+	stop := h.stop
+	h.stop = nil
+	boxes := make([]*mailbox, 0, len(h.boxes))
+	for _, b := range h.boxes {
+		boxes = append(boxes, b)
+	}
+	h.boxes = make(map[string]*mailbox)
+	h.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		h.wg.Wait()
+	}
+	for _, b := range boxes {
+		h.config.Bridge.Detach(b.deviceID, b)
+	}
+}
+
+func (h *Handler) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	h.handleValues(w, r, h.config.Bridge.Publish)
+}
+
+func (h *Handler) handleAttributes(w http.ResponseWriter, r *http.Request) {
+	h.handleValues(w, r, h.config.Bridge.PublishAttributes)
+}
+
+func (h *Handler) handleValues(w http.ResponseWriter, r *http.Request, publish func(context.Context, string, driver.Values) error) {
+	deviceID, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	values, err := h.config.Codec.Decode(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := publish(r.Context(), deviceID, values); err != nil {
+		h.logger.Printf("HTTP上报失败: deviceID=%s, path=%s, err=%v", deviceID, r.URL.Path, err)
+		writeJSON(w, http.StatusServiceUnavailable, "publish failed", nil)
+		return
+	}
+	h.respond(w, deviceID)
+}
+
+func (h *Handler) handleEvent(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	var event gateway.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeJSON(w, http.StatusBadRequest, "事件格式错误", nil)
+		return
+	}
+	if err := h.config.Bridge.PublishEvent(r.Context(), deviceID, event); err != nil {
+		h.logger.Printf("HTTP事件上报失败: deviceID=%s, err=%v", deviceID, err)
+		writeJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	h.respond(w, deviceID)
+}
+
+func (h *Handler) handleCommands(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	h.respond(w, deviceID)
+}
+
+// respond 返回成功响应，data 中带上设备待下发的控制指令；
+// 响应写入失败时设备没有收到指令，放回队列等待下一次请求
+func (h *Handler) respond(w http.ResponseWriter, deviceID string) {
+	b := h.mailbox(deviceID)
+	cmds := b.drain(time.Now())
+	if len(cmds) == 0 {
+		writeJSON(w, http.StatusOK, "", nil)
+		return
+	}
+	values := make([]driver.Values, len(cmds))
+	for i, p := range cmds {
+		values[i] = p.values
+	}
+	err := writeJSON(w, http.StatusOK, "", Commands{Commands: values})
+	if err == nil {
+		// 响应可能仍在缓冲区中，刷新后才能确认已写入连接
+		if err = http.NewResponseController(w).Flush(); errors.Is(err, http.ErrNotSupported) {
+			err = nil
+		}
+	}
+	if err != nil {
+		h.logger.Printf("控制指令响应写入失败，放回队列: deviceID=%s, err=%v", deviceID, err)
+		b.requeue(cmds)
+	}
+}
+
+// authenticate 按凭证识别设备，依次读取 X-TP-Voucher 请求头、
+// Authorization（Bearer 为访问令牌，Basic 为用户名密码）请求头；
+// 不读取查询参数，避免凭证出现在URL、代理和访问日志中
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	voucher := r.Header.Get(HeaderVoucher)
+	if voucher == "" {
+		auth := r.Header.Get("Authorization")
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok && token != "" {
+			voucher = types.NewAccessTokenVoucher(strings.TrimSpace(token)).String()
+		} else if user, pass, ok := r.BasicAuth(); ok {
+			if pass == "" {
+				voucher = types.NewUsernameVoucher(user).String()
+			} else {
+				voucher = types.NewBasicVoucher(user, pass).String()
+			}
+		}
+	}
+	if voucher == "" {
+		writeJSON(w, http.StatusUnauthorized, "unauthorized", nil)
+		return "", false
+	}
+
+	entry, err := h.config.Bridge.Resolve(r.Context(), gateway.Identity{Voucher: voucher})
+	if err != nil {
+		h.logger.Printf("HTTP设备认证失败: remote=%s, err=%v", r.RemoteAddr, err)
+		writeJSON(w, http.StatusUnauthorized, "unauthorized", nil)
+		return "", false
+	}
+	return entry.ID, true
+}
+
+func (h *Handler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.config.MaxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, "request body too large", nil)
+		} else {
+			writeJSON(w, http.StatusBadRequest, err.Error(), nil)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+// writeJSON 写入与回调接口相同格式的响应
+func writeJSON(w http.ResponseWriter, status int, message string, data interface{}) error {
+	if message == "" && status < http.StatusBadRequest {
+		message = "success"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(handler.CommonResponse{Code: status, Message: message, Data: data})
+}
+
+// mailbox 返回设备的指令队列，设备首次请求时登记到网关
+func (h *Handler) mailbox(deviceID string) *mailbox {
+	now := time.Now()
+	h.mu.Lock()
+	b, ok := h.boxes[deviceID]
+	if !ok {
+		b = &mailbox{handler: h, deviceID: deviceID}
+		h.boxes[deviceID] = b
+	}
+	b.lastSeen = now
+	h.mu.Unlock()
+
+	if ok {
+		h.config.Bridge.Touch(deviceID)
+	} else {
+		h.config.Bridge.Attach(deviceID, b)
+	}
+	return b
+}
+
+func (h *Handler) janitor(stop chan struct{}) {
+	interval := h.config.SessionTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			h.expire(now)
+		}
+	}
+}
+
+func (h *Handler) expire(now time.Time) {
+	h.mu.Lock()
+	var expired []*mailbox
+	for id, b := range h.boxes {
+		if now.Sub(b.lastSeen) >= h.config.SessionTTL {
+			expired = append(expired, b)
+			delete(h.boxes, id)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, b := range expired {
+		h.logger.Printf("设备长时间未请求，注销: deviceID=%s", b.deviceID)
+		h.config.Bridge.Detach(b.deviceID, b)
+	}
+}
+
+// pending 暂存的控制指令
+type pending struct {
+	values driver.Values
+	at     time.Time
+}
+
+// mailbox 设备的控制指令队列，实现 gateway.Session
+type mailbox struct {
+	handler  *Handler
+	deviceID string
+	lastSeen time.Time // 受 handler.mu 保护
+
+	mu    sync.Mutex
+	queue []pending
+}
+
+// Send 暂存控制指令，等待设备下一次请求时返回
+func (b *mailbox) Send(_ context.Context, values driver.Values) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = append(b.queue, pending{values: values, at: time.Now()})
+	if n := len(b.queue) - b.handler.config.QueueSize; n > 0 {
+		b.handler.logger.Printf("控制指令队列已满，丢弃最早的%d条: deviceID=%s", n, b.deviceID)
+		b.queue = b.queue[n:]
+	}
+	return nil
+}
+
+// Close 删除设备的指令队列，设备再次请求时重新登记
+func (b *mailbox) Close() error {
+	h := b.handler
+	h.mu.Lock()
+	if h.boxes[b.deviceID] == b {
+		delete(h.boxes, b.deviceID)
+	}
+	h.mu.Unlock()
+	return nil
+}
+
+// drain 取出未过期的控制指令
+func (b *mailbox) drain(now time.Time) []pending {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []pending
+	for _, p := range b.queue {
+		if now.Sub(p.at) < b.handler.config.CommandTTL {
+			out = append(out, p)
+		}
+	}
+	b.queue = nil
+	return out
+}
+
+// requeue 将未送达的指令放回队列头部，保留原有的暂存时间
+func (b *mailbox) requeue(cmds []pending) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = append(cmds, b.queue...)
+	if n := len(b.queue) - b.handler.config.QueueSize; n > 0 {
+		b.handler.logger.Printf("控制指令队列已满，丢弃最早的%d条: deviceID=%s", n, b.deviceID)
+		b.queue = b.queue[n:]
+	}
+}
@@ -0,0 +1,194 @@
+// gateway/httppush/httppush_test.go
+
+package httppush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// recordMQTT 记录发布的主题
+type recordMQTT struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (m *recordMQTT) PublishContext(_ context.Context, topic string, _ byte, _ interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.topics = append(m.topics, topic)
+	return nil
+}
+
+func (m *recordMQTT) SubscribeContext(string, byte, client.ContextMessageHandler) error {
+	return nil
+}
+
+func newTestHandler(t *testing.T, config Config) (*Handler, *gateway.Bridge, *recordMQTT) {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	registry := client.NewDeviceRegistry(nil)
+	registry.AddDevice(types.Device{ID: "d1", Voucher: `{"access_token":"tok"}`})
+	registry.AddDevice(types.Device{ID: "d2", Voucher: `{"username":"u","password":"p"}`})
+	mqtt := &recordMQTT{}
+	bridge := gateway.New(gateway.Config{ServiceIdentifier: "svc", MQTT: mqtt, Registry: registry, Logger: logger})
+	config.Bridge = bridge
+	config.Logger = logger
+	h, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Stop)
+	return h, bridge, mqtt
+}
+
+// do 发送请求，返回状态码和响应中的指令
+func do(t *testing.T, h http.Handler, r *http.Request) (int, []driver.Values) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var resp struct {
+		Data Commands `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Data.Commands
+}
+
+func TestHandlerAuth(t *testing.T) {
+	h, _, mqtt := newTestHandler(t, Config{})
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		status int
+	}{
+		{"无凭证", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"凭证请求头", func(r *http.Request) { r.Header.Set(HeaderVoucher, `{"access_token":"tok"}`) }, http.StatusOK},
+		{"Bearer令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok") }, http.StatusOK},
+		{"Basic认证", func(r *http.Request) { r.SetBasicAuth("u", "p") }, http.StatusOK},
+		{"错误令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer bad") }, http.StatusUnauthorized},
+		{"错误密码", func(r *http.Request) { r.SetBasicAuth("u", "x") }, http.StatusUnauthorized},
+		{"不接受查询参数", func(r *http.Request) { r.URL.RawQuery = "access_token=tok" }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, PathTelemetry, strings.NewReader(`{"temp":1}`))
+			tt.setup(r)
+			if status, _ := do(t, h, r); status != tt.status {
+				t.Errorf("状态码 = %d, 期望 %d", status, tt.status)
+			}
+		})
+	}
+
+	mqtt.mu.Lock()
+	defer mqtt.mu.Unlock()
+	if len(mqtt.topics) != 3 || mqtt.topics[0] != "plugin/svc/"+driver.TelemetryTopic {
+		t.Errorf("发布主题 = %v, 期望认证通过的 3 次遥测", mqtt.topics)
+	}
+}
+
+func TestHandlerBodyTooLarge(t *testing.T) {
+	h, _, _ := newTestHandler(t, Config{MaxBodyBytes: 16})
+	r := httptest.NewRequest(http.MethodPost, PathAttributes, strings.NewReader(`{"name":"`+strings.Repeat("x", 32)+`"}`))
+	r.Header.Set("Authorization", "Bearer tok")
+	if status, _ := do(t, h, r); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("状态码 = %d, 期望 413", status)
+	}
+}
+
+func TestHandlerCommandDrain(t *testing.T) {
+	h, bridge, _ := newTestHandler(t, Config{QueueSize: 2})
+	get := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, PathCommands, nil)
+		r.Header.Set("Authorization", "Bearer tok")
+		return r
+	}
+	ctx := context.Background()
+
+	if err := bridge.Send(ctx, "d1", driver.Values{"switch": 1}); err == nil {
+		t.Fatal("设备首次请求前不应有连接")
+	}
+	if _, cmds := do(t, h, get()); len(cmds) != 0 {
+		t.Fatalf("指令 = %v, 期望为空", cmds)
+	}
+
+	// 超出队列长度时丢弃最早的指令
+	for i := 1; i <= 3; i++ {
+		if err := bridge.Send(ctx, "d1", driver.Values{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, cmds := do(t, h, get())
+	if len(cmds) != 2 || cmds[0]["n"] != float64(2) || cmds[1]["n"] != float64(3) {
+		t.Errorf("指令 = %v, 期望 n=2 和 n=3", cmds)
+	}
+	if _, cmds := do(t, h, get()); len(cmds) != 0 {
+		t.Errorf("取走后再次请求 = %v, 期望为空", cmds)
+	}
+}
+
+// failingWriter 写入响应时返回错误，模拟设备已断开
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestHandlerRequeueOnWriteFailure(t *testing.T) {
+	h, bridge, _ := newTestHandler(t, Config{})
+	get := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, PathCommands, nil)
+		r.Header.Set("Authorization", "Bearer tok")
+		return r
+	}
+	do(t, h, get())
+	bridge.Send(context.Background(), "d1", driver.Values{"switch": 1})
+
+	h.ServeHTTP(failingWriter{httptest.NewRecorder()}, get())
+
+	if _, cmds := do(t, h, get()); len(cmds) != 1 || cmds[0]["switch"] != float64(1) {
+		t.Errorf("写入失败后再次请求 = %v, 期望重新返回指令", cmds)
+	}
+}
+
+func TestHandlerSessionExpires(t *testing.T) {
+	h, bridge, _ := newTestHandler(t, Config{SessionTTL: 100 * time.Millisecond})
+	r := httptest.NewRequest(http.MethodGet, PathCommands, nil)
+	r.Header.Set("Authorization", "Bearer tok")
+	do(t, h, r)
+	if _, ok := bridge.Session("d1"); !ok {
+		t.Fatal("请求后设备应已登记")
+	}
+
+	// 未调用 Start，New 已启动清理协程
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := bridge.Session("d1"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("超过 SessionTTL 的设备未注销")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.boxes) != 0 {
+		t.Errorf("指令队列 %d 个, 期望已清理", len(h.boxes))
+	}
+}
@@ -0,0 +1,195 @@
+// gateway/tcp/framer.go
+
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 默认最大帧长度
+const defaultMaxLength = 64 * 1024
+
+// Framer 将字节流切分为帧
+type Framer interface {
+	// ReadFrame 读取一帧，返回的数据不含帧头和分隔符
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	// WriteFrame 写入一帧
+	WriteFrame(w io.Writer, frame []byte) error
+}
+
+// FramerFuncs 由函数组成的分帧器，用于自定义协议；WriteFunc 为空时原样写入
+type FramerFuncs struct {
+	ReadFunc  func(r *bufio.Reader) ([]byte, error)
+	WriteFunc func(w io.Writer, frame []byte) error
+}
+
+// ReadFrame 调用 ReadFunc
+func (f FramerFuncs) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	if f.ReadFunc == nil {
+		return nil, fmt.Errorf("未实现分帧读取")
+	}
+	return f.ReadFunc(r)
+}
+
+// WriteFrame 调用 WriteFunc
+func (f FramerFuncs) WriteFrame(w io.Writer, frame []byte) error {
+	if f.WriteFunc == nil {
+		_, err := w.Write(frame)
+		return err
+	}
+	return f.WriteFunc(w, frame)
+}
+
+// LengthPrefixed 长度前缀分帧，帧头为负载长度
+type LengthPrefixed struct {
+	Size         int  // 长度字段字节数：1、2、4，默认2
+	LittleEndian bool // 长度字段是否为小端，默认大端
+	MaxLength    int  // 最大负载长度，默认64KB
+}
+
+// ReadFrame 读取一帧
+func (f LengthPrefixed) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	size := f.size()
+	head := make([]byte, size)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	var n uint64
+	switch size {
+	case 1:
+		n = uint64(head[0])
+	case 2:
+		n = uint64(f.order().Uint16(head))
+	case 4:
+		n = uint64(f.order().Uint32(head))
+	default:
+		return nil, fmt.Errorf("长度字段字节数不支持: %d", size)
+	}
+	if n > uint64(maxLength(f.MaxLength)) {
+		return nil, fmt.Errorf("帧长度超出限制: %d", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// WriteFrame 写入一帧
+func (f LengthPrefixed) WriteFrame(w io.Writer, frame []byte) error {
+	size := f.size()
+	if size < 4 && len(frame) >= 1<<(8*size) {
+		return fmt.Errorf("帧长度超出长度字段范围: %d", len(frame))
+	}
+	head := make([]byte, size)
+	switch size {
+	case 1:
+		head[0] = byte(len(frame))
+	case 2:
+		f.order().PutUint16(head, uint16(len(frame)))
+	case 4:
+		f.order().PutUint32(head, uint32(len(frame)))
+	default:
+		return fmt.Errorf("长度字段字节数不支持: %d", size)
+	}
+	_, err := w.Write(append(head, frame...))
+	return err
+}
+
+func (f LengthPrefixed) size() int {
+	if f.Size == 0 {
+		return 2
+	}
+	return f.Size
+}
+
+func (f LengthPrefixed) order() binary.ByteOrder {
+	if f.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Delimiter 分隔符分帧，默认以换行分隔，读取时去掉行尾的 \r
+type Delimiter struct {
+	Delim     []byte // 分隔符，默认 "\n"
+	MaxLength int    // 最大帧长度，默认64KB
+}
+
+// ReadFrame 读取一帧，跳过空帧
+func (f Delimiter) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	delim := f.delim()
+	limit := maxLength(f.MaxLength)
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b)
+		if bytes.HasSuffix(buf, delim) {
+			frame := buf[:len(buf)-len(delim)]
+			if bytes.Equal(delim, []byte("\n")) {
+				frame = bytes.TrimSuffix(frame, []byte("\r"))
+			}
+			if len(frame) == 0 {
+				buf = buf[:0]
+				continue
+			}
+			return frame, nil
+		}
+		if len(buf) > limit+len(delim) {
+			return nil, fmt.Errorf("帧长度超出限制: %d", len(buf))
+		}
+	}
+}
+
+// WriteFrame 写入一帧并追加分隔符
+func (f Delimiter) WriteFrame(w io.Writer, frame []byte) error {
+	_, err := w.Write(append(append([]byte(nil), frame...), f.delim()...))
+	return err
+}
+
+func (f Delimiter) delim() []byte {
+	if len(f.Delim) == 0 {
+		return []byte("\n")
+	}
+	return f.Delim
+}
+
+// Fixed 定长分帧
+type Fixed struct {
+	Size int // 帧长度
+}
+
+// ReadFrame 读取一帧
+func (f Fixed) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	if f.Size <= 0 {
+		return nil, fmt.Errorf("帧长度无效: %d", f.Size)
+	}
+	frame := make([]byte, f.Size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// WriteFrame 写入一帧，长度必须与 Size 一致
+func (f Fixed) WriteFrame(w io.Writer, frame []byte) error {
+	if len(frame) != f.Size {
+		return fmt.Errorf("帧长度应为%d: %d", f.Size, len(frame))
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+func maxLength(n int) int {
+	if n <= 0 {
+		return defaultMaxLength
+	}
+	return n
+}
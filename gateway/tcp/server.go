@@ -0,0 +1,274 @@
+// gateway/tcp/server.go
+
+// Package tcp 设备以TCP长连接接入：连接后首帧为注册包，用于识别设备，
+// 之后的帧解码后作为遥测上报，控制指令编码后写回连接
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+)
+
+// Config TCP服务配置
+type Config struct {
+	Address string          // 监听地址，ListenAndServe 使用
+	Bridge  *gateway.Bridge // 网关
+	Framer  Framer          // 分帧器，默认按换行分隔
+	Codec   gateway.Codec   // 报文编解码，默认JSON
+	// Identify 从注册包解析设备身份，默认 gateway.ParseIdentity
+	Identify        func(frame []byte) (gateway.Identity, error)
+	RegisterTimeout time.Duration // 等待注册包的超时时间，默认10秒
+	IdleTimeout     time.Duration // 连接空闲超时时间，为0时不限制
+	RegisterAck     []byte        // 注册成功后回复的帧，为空时不回复
+	// TrustIdentity 为 true 时信任注册包中不带凭证的设备ID或设备编号，
+	// 任何能连上端口的客户端都能冒充设备接收控制指令，仅适用于可信网络。
+	// 默认注册包必须携带 voucher，带有设备ID或设备编号时须与凭证对应的设备一致
+	TrustIdentity bool
+	Logger        *log.Logger
+}
+
+// Server TCP设备接入服务
+type Server struct {
+	config Config
+	logger *log.Logger
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[*conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer 创建TCP服务
+func NewServer(config Config) (*Server, error) {
+	if config.Bridge == nil {
+		return nil, fmt.Errorf("TCP服务未配置网关")
+	}
+	if config.Framer == nil {
+		config.Framer = Delimiter{}
+	}
+	if config.Codec == nil {
+		config.Codec = gateway.JSONCodec{}
+	}
+	if config.Identify == nil {
+		config.Identify = gateway.ParseIdentity
+	}
+	if config.RegisterTimeout <= 0 {
+		config.RegisterTimeout = 10 * time.Second
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = config.Bridge.Logger()
+	}
+	return &Server{config: config, logger: logger, conns: make(map[*conn]struct{})}, nil
+}
+
+// ListenAndServe 监听 Config.Address 并处理连接，直到 ctx 取消或调用 Close
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("TCP监听失败: %w", err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve 在 ln 上处理连接，直到 ctx 取消或调用 Close
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+	s.logger.Printf("TCP服务已启动: %s", ln.Addr())
+
+	stop := context.AfterFunc(ctx, func() { s.Close() })
+	defer stop()
+
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("TCP接受连接失败: %w", err)
+		}
+
+		c := &conn{server: s, nc: nc, reader: bufio.NewReader(nc)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			c.serve(ctx)
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Addr 返回监听地址，未监听时返回空
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Close 停止监听，关闭全部连接并等待连接处理结束
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// conn 一个设备连接，实现 gateway.Session
+type conn struct {
+	server *Server
+	nc     net.Conn
+	reader *bufio.Reader
+
+	writeMu  sync.Mutex
+	deviceID string
+}
+
+// Send 编码控制指令并写入连接
+func (c *conn) Send(_ context.Context, values driver.Values) error {
+	data, err := c.server.config.Codec.Encode(values)
+	if err != nil {
+		return fmt.Errorf("编码控制指令失败: %w", err)
+	}
+	return c.writeFrame(data)
+}
+
+// Close 关闭连接
+func (c *conn) Close() error {
+	return c.nc.Close()
+}
+
+func (c *conn) writeFrame(frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.nc.SetWriteDeadline(time.Now().Add(c.server.config.RegisterTimeout))
+	defer c.nc.SetWriteDeadline(time.Time{})
+	return c.server.config.Framer.WriteFrame(c.nc, frame)
+}
+
+func (c *conn) readFrame(timeout time.Duration) ([]byte, error) {
+	if timeout > 0 {
+		c.nc.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		c.nc.SetReadDeadline(time.Time{})
+	}
+	return c.server.config.Framer.ReadFrame(c.reader)
+}
+
+func (c *conn) serve(ctx context.Context) {
+	s := c.server
+	bridge := s.config.Bridge
+	remote := c.nc.RemoteAddr().String()
+	defer c.nc.Close()
+
+	if err := c.register(ctx); err != nil {
+		s.logger.Printf("设备注册失败: remote=%s, err=%v", remote, err)
+		return
+	}
+	defer bridge.Detach(c.deviceID, c)
+
+	for {
+		frame, err := c.readFrame(s.config.IdleTimeout)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				s.logger.Printf("设备连接空闲超时: deviceID=%s, remote=%s", c.deviceID, remote)
+			}
+			return
+		}
+		bridge.Touch(c.deviceID)
+
+		values, err := s.config.Codec.Decode(frame)
+		if err != nil {
+			s.logger.Printf("解码设备报文失败: deviceID=%s, err=%v", c.deviceID, err)
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := bridge.Publish(ctx, c.deviceID, values); err != nil {
+			s.logger.Printf("上报遥测失败: deviceID=%s, err=%v", c.deviceID, err)
+		}
+	}
+}
+
+// register 读取注册包，解析设备并登记连接；未开启 TrustIdentity 时按凭证认证
+func (c *conn) register(ctx context.Context) error {
+	s := c.server
+	frame, err := c.readFrame(s.config.RegisterTimeout)
+	if err != nil {
+		return fmt.Errorf("读取注册包失败: %w", err)
+	}
+	id, err := s.config.Identify(frame)
+	if err != nil {
+		return err
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, s.config.RegisterTimeout)
+	defer cancel()
+	var entry *client.DeviceEntry
+	if s.config.TrustIdentity {
+		entry, err = s.config.Bridge.Resolve(rctx, id)
+	} else {
+		entry, err = s.config.Bridge.Authenticate(rctx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.deviceID = entry.ID
+	if len(s.config.RegisterAck) > 0 {
+		if err := c.writeFrame(s.config.RegisterAck); err != nil {
+			return fmt.Errorf("回复注册包失败: %w", err)
+		}
+	}
+	s.config.Bridge.Attach(entry.ID, c)
+	s.logger.Printf("设备注册成功: deviceID=%s, remote=%s", entry.ID, c.nc.RemoteAddr())
+	return nil
+}
@@ -0,0 +1,74 @@
+// gateway/tcp/server_test.go
+
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+func TestServerRegister(t *testing.T) {
+	tests := []struct {
+		name   string
+		trust  bool
+		packet string
+		ok     bool
+	}{
+		{"凭证", false, `{"voucher":"v1"}`, true},
+		{"凭证与设备编号一致", false, `{"device_number":"SN1","voucher":"v1"}`, true},
+		{"凭证与设备ID不符", false, `{"device_id":"d2","voucher":"v1"}`, false},
+		{"默认拒绝设备编号", false, `{"device_number":"SN1"}`, false},
+		{"默认拒绝设备ID", false, `{"device_id":"d1"}`, false},
+		{"默认拒绝裸设备编号", false, `SN1`, false},
+		{"TrustIdentity 接受设备编号", true, `{"device_number":"SN1"}`, true},
+		{"TrustIdentity 接受裸设备编号", true, `SN1`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			registry := client.NewDeviceRegistry(nil)
+			registry.AddDevice(types.Device{ID: "d1", DeviceNumber: "SN1", Voucher: "v1"})
+			registry.AddDevice(types.Device{ID: "d2", DeviceNumber: "SN2", Voucher: "v2"})
+			srv, err := NewServer(Config{
+				Bridge:        gateway.New(gateway.Config{Registry: registry, Logger: logger}),
+				RegisterAck:   []byte("OK"),
+				TrustIdentity: tt.trust,
+				Logger:        logger,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go srv.Serve(context.Background(), ln)
+			defer srv.Close()
+
+			nc, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer nc.Close()
+			nc.SetDeadline(time.Now().Add(2 * time.Second))
+			if _, err := nc.Write([]byte(tt.packet + "\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			// 注册成功时回复 OK，失败时服务端关闭连接
+			ack, err := bufio.NewReader(nc).ReadString('\n')
+			if got := err == nil && ack == "OK\n"; got != tt.ok {
+				t.Errorf("注册结果 = %v (ack=%q, err=%v), 期望 %v", got, ack, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+// gateway/udp/server.go
+
+// Package udp 设备以UDP报文接入：按报文中的设备身份或来源地址识别设备，
+// 报文解码后作为遥测上报，控制指令发往设备最近一次上报的地址
+package udp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+)
+
+// UDP报文最大长度
+const maxDatagram = 65535
+
+// Config UDP服务配置
+type Config struct {
+	Address string          // 监听地址，ListenAndServe 使用
+	Bridge  *gateway.Bridge // 网关
+	Codec   gateway.Codec   // 报文编解码，默认JSON
+	// Identify 从报文解析设备身份，返回去掉身份信息后的负载；身份为空时按来源地址识别。
+	// 默认 ParseDatagram
+	Identify func(addr net.Addr, data []byte) (gateway.Identity, []byte, error)
+	// Addresses 静态地址映射，来源地址 "ip:port" 或 "ip" -> 设备编号
+	Addresses map[string]string
+	// TTL 地址映射有效期，超过该时间未收到设备报文时删除映射并将设备置为离线，默认5分钟
+	TTL time.Duration
+	// TrustIdentity 为 true 时信任报文中不带凭证的 device_id、device_number，
+	// 任何来源都能以此把设备的控制指令地址改为自己的地址，仅适用于可信网络。
+	// 默认只有携带 voucher 的报文可以登记或变更设备地址，不带凭证的身份只在来源地址已绑定到同一设备时接受
+	TrustIdentity bool
+	// Workers 处理报文的协程数，报文按来源地址分配，同一地址的报文按顺序处理，默认8
+	Workers int
+	// QueueSize 每个处理协程的报文队列长度，队列已满时丢弃报文，默认64
+	QueueSize int
+	Logger    *log.Logger
+}
+
+// identityKeys 报文中表示设备身份的字段
+var identityKeys = []string{"device_id", "device_number", "voucher"}
+
+// ParseDatagram 默认的报文解析：JSON对象中的 device_id、device_number、voucher 字段作为设备身份，
+// 其余字段作为负载；不是JSON对象或没有身份字段时原样返回，按来源地址识别。
+// 不带 voucher 的身份能否登记新地址由 Config.TrustIdentity 决定
+func ParseDatagram(_ net.Addr, data []byte) (gateway.Identity, []byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return gateway.Identity{}, data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return gateway.Identity{}, nil, fmt.Errorf("报文格式错误: %w", err)
+	}
+
+	found := false
+	for _, k := range identityKeys {
+		if _, ok := fields[k]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return gateway.Identity{}, data, nil
+	}
+	id, err := gateway.ParseIdentity(trimmed)
+	if err != nil {
+		return gateway.Identity{}, nil, err
+	}
+	for _, k := range identityKeys {
+		delete(fields, k)
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return gateway.Identity{}, nil, err
+	}
+	return id, payload, nil
+}
+
+// Server UDP设备接入服务
+type Server struct {
+	config Config
+	logger *log.Logger
+
+	mu       sync.Mutex
+	pc       net.PacketConn
+	byAddr   map[string]*session // 来源地址 -> 设备
+	byDevice map[string]*session // 设备ID -> 设备
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer 创建UDP服务
+func NewServer(config Config) (*Server, error) {
+	if config.Bridge == nil {
+		return nil, fmt.Errorf("UDP服务未配置网关")
+	}
+	if config.Codec == nil {
+		config.Codec = gateway.JSONCodec{}
+	}
+	if config.Identify == nil {
+		config.Identify = ParseDatagram
+	}
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.Workers <= 0 {
+		config.Workers = 8
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 64
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = config.Bridge.Logger()
+	}
+	return &Server{
+		config:   config,
+		logger:   logger,
+		byAddr:   make(map[string]*session),
+		byDevice: make(map[string]*session),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// ListenAndServe 监听 Config.Address 并处理报文，直到 ctx 取消或调用 Close
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	pc, err := net.ListenPacket("udp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("UDP监听失败: %w", err)
+	}
+	return s.Serve(ctx, pc)
+}
+
+// Serve 在 pc 上处理报文，直到 ctx 取消或调用 Close
+func (s *Server) Serve(ctx context.Context, pc net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		pc.Close()
+		return net.ErrClosed
+	}
+	s.pc = pc
+	s.wg.Add(1)
+	s.mu.Unlock()
+	s.logger.Printf("UDP服务已启动: %s", pc.LocalAddr())
+
+	go func() {
+		defer s.wg.Done()
+		s.janitor()
+	}()
+	stop := context.AfterFunc(ctx, func() { s.Close() })
+	defer stop()
+
+	// 识别设备可能请求平台接口，报文交给处理协程，读取循环不被阻塞
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queues := make([]chan datagram, s.config.Workers)
+	for i := range queues {
+		queues[i] = make(chan datagram, s.config.QueueSize)
+		s.wg.Add(1)
+		go func(queue <-chan datagram) {
+			defer s.wg.Done()
+			s.worker(ctx, queue)
+		}(queues[i])
+	}
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("UDP读取失败: %w", err)
+		}
+		s.dispatch(queues, datagram{addr: addr, data: append([]byte(nil), buf[:n]...)})
+	}
+}
+
+// datagram 待处理的报文
+type datagram struct {
+	addr net.Addr
+	data []byte
+}
+
+// dispatch 按来源地址把报文放入处理队列，队列已满时丢弃
+func (s *Server) dispatch(queues []chan datagram, d datagram) {
+	h := fnv.New32a()
+	h.Write([]byte(d.addr.String()))
+	select {
+	case queues[h.Sum32()%uint32(len(queues))] <- d:
+	default:
+		s.logger.Printf("报文处理队列已满，丢弃报文: remote=%s", d.addr)
+	}
+}
+
+// worker 依次处理队列中的报文，直到 ctx 取消
+func (s *Server) worker(ctx context.Context, queue <-chan datagram) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-queue:
+			s.handle(ctx, d.addr, d.data)
+		}
+	}
+}
+
+// Addr 返回监听地址，未监听时返回空
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pc == nil {
+		return ""
+	}
+	return s.pc.LocalAddr().String()
+}
+
+// Close 停止监听并注销全部设备
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	var err error
+	if s.pc != nil {
+		err = s.pc.Close()
+	}
+	sessions := make([]*session, 0, len(s.byDevice))
+	for _, sess := range s.byDevice {
+		sessions = append(sessions, sess)
+	}
+	s.byAddr = make(map[string]*session)
+	s.byDevice = make(map[string]*session)
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		s.config.Bridge.Detach(sess.deviceID, sess)
+	}
+	s.wg.Wait()
+	return err
+}
+
+// DeviceAddr 返回设备最近一次上报的地址
+func (s *Server) DeviceAddr(deviceID string) (net.Addr, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.byDevice[deviceID]
+	if !ok {
+		return nil, false
+	}
+	return sess.addr, true
+}
+
+// handle 处理一个报文
+func (s *Server) handle(ctx context.Context, addr net.Addr, data []byte) {
+	id, payload, err := s.config.Identify(addr, data)
+	if err != nil {
+		s.logger.Printf("解析报文失败: remote=%s, err=%v", addr, err)
+		return
+	}
+
+	deviceID, err := s.identify(ctx, addr, id)
+	if err != nil {
+		s.logger.Printf("识别设备失败: remote=%s, err=%v", addr, err)
+		return
+	}
+	s.bind(deviceID, addr)
+
+	values, err := s.config.Codec.Decode(payload)
+	if err != nil {
+		s.logger.Printf("解码设备报文失败: deviceID=%s, err=%v", deviceID, err)
+		return
+	}
+	if len(values) == 0 {
+		return
+	}
+	if err := s.config.Bridge.Publish(ctx, deviceID, values); err != nil {
+		s.logger.Printf("上报遥测失败: deviceID=%s, err=%v", deviceID, err)
+	}
+}
+
+// identify 按报文中的身份、已记录的地址映射、静态地址映射的顺序识别设备
+func (s *Server) identify(ctx context.Context, addr net.Addr, id gateway.Identity) (string, error) {
+	key := addr.String()
+	s.mu.Lock()
+	sess, bound := s.byAddr[key]
+	s.mu.Unlock()
+
+	if id != (gateway.Identity{}) {
+		if s.config.TrustIdentity {
+			entry, err := s.config.Bridge.Resolve(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return entry.ID, nil
+		}
+		if id.Voucher != "" {
+			entry, err := s.config.Bridge.Authenticate(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return entry.ID, nil
+		}
+		// 不带凭证的身份不能登记或变更设备地址
+		if !bound {
+			return "", fmt.Errorf("报文未携带凭证，不能登记新的来源地址")
+		}
+		entry, err := s.config.Bridge.Resolve(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if entry.ID != sess.deviceID {
+			return "", fmt.Errorf("报文身份与来源地址绑定的设备不一致: deviceID=%s, 已绑定=%s", entry.ID, sess.deviceID)
+		}
+		return entry.ID, nil
+	}
+
+	if bound {
+		return sess.deviceID, nil
+	}
+
+	number, ok := s.config.Addresses[key]
+	if !ok {
+		if host, _, err := net.SplitHostPort(key); err == nil {
+			number, ok = s.config.Addresses[host]
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("未知的来源地址")
+	}
+	entry, err := s.config.Bridge.Resolve(ctx, gateway.Identity{DeviceNumber: number})
+	if err != nil {
+		return "", err
+	}
+	return entry.ID, nil
+}
+
+// bind 记录设备最近一次上报的地址，设备首次上报时登记到网关
+func (s *Server) bind(deviceID string, addr net.Addr) {
+	key := addr.String()
+	now := time.Now()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	sess, ok := s.byDevice[deviceID]
+	if !ok {
+		sess = &session{server: s, deviceID: deviceID}
+		s.byDevice[deviceID] = sess
+	}
+	if sess.addr != nil && sess.addr.String() != key {
+		delete(s.byAddr, sess.addr.String())
+		s.logger.Printf("设备地址变化: deviceID=%s, %s -> %s", deviceID, sess.addr, key)
+	}
+	if old, ok := s.byAddr[key]; ok && old != sess {
+		// 地址被其他设备复用
+		old.addr = nil
+	}
+	sess.addr = addr
+	sess.lastSeen = now
+	s.byAddr[key] = sess
+	s.mu.Unlock()
+
+	if !ok {
+		s.config.Bridge.Attach(deviceID, sess)
+	} else {
+		s.config.Bridge.Touch(deviceID)
+	}
+}
+
+// unbind 删除设备的地址映射，返回设备是否存在
+func (s *Server) unbind(sess *session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byDevice[sess.deviceID] != sess {
+		return false
+	}
+	delete(s.byDevice, sess.deviceID)
+	if sess.addr != nil && s.byAddr[sess.addr.String()] == sess {
+		delete(s.byAddr, sess.addr.String())
+	}
+	return true
+}
+
+// janitor 定期清理过期的地址映射
+func (s *Server) janitor() {
+	interval := s.config.TTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.expire(time.Now())
+		}
+	}
+}
+
+func (s *Server) expire(now time.Time) {
+	s.mu.Lock()
+	var expired []*session
+	for _, sess := range s.byDevice {
+		if now.Sub(sess.lastSeen) >= s.config.TTL {
+			expired = append(expired, sess)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sess := range expired {
+		if s.unbind(sess) {
+			s.logger.Printf("设备地址映射过期: deviceID=%s", sess.deviceID)
+			s.config.Bridge.Detach(sess.deviceID, sess)
+		}
+	}
+}
+
+// session 一个设备的地址映射，实现 gateway.Session
+type session struct {
+	server   *Server
+	deviceID string
+	addr     net.Addr // 最近一次上报的地址，受 server.mu 保护
+	lastSeen time.Time
+}
+
+// Send 编码控制指令并发往设备最近一次上报的地址
+func (sess *session) Send(_ context.Context, values driver.Values) error {
+	s := sess.server
+	data, err := s.config.Codec.Encode(values)
+	if err != nil {
+		return fmt.Errorf("编码控制指令失败: %w", err)
+	}
+	s.mu.Lock()
+	addr, pc := sess.addr, s.pc
+	s.mu.Unlock()
+	if addr == nil || pc == nil {
+		return fmt.Errorf("设备地址未知: deviceID=%s", sess.deviceID)
+	}
+	_, err = pc.WriteTo(data, addr)
+	return err
+}
+
+// Close 删除设备的地址映射，设备再次上报时重新登记
+func (sess *session) Close() error {
+	sess.server.unbind(sess)
+	return nil
+}
@@ -0,0 +1,100 @@
+// gateway/udp/server_test.go
+
+package udp
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+func startServer(t *testing.T, trust bool) (*Server, net.Addr) {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	registry := client.NewDeviceRegistry(nil)
+	registry.AddDevice(types.Device{ID: "d1", DeviceNumber: "SN1", Voucher: "v1"})
+	registry.AddDevice(types.Device{ID: "d2", DeviceNumber: "SN2", Voucher: "v2"})
+	srv, err := NewServer(Config{
+		Bridge:        gateway.New(gateway.Config{Registry: registry, Logger: logger}),
+		TrustIdentity: trust,
+		Logger:        logger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), pc)
+	t.Cleanup(func() { srv.Close() })
+	return srv, pc.LocalAddr()
+}
+
+// dial 创建一个设备端，发送报文到服务
+func dial(t *testing.T, addr net.Addr) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, addr.(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitAddr 等待设备地址变为 want
+func waitAddr(t *testing.T, srv *Server, deviceID string, want net.Addr) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if addr, ok := srv.DeviceAddr(deviceID); ok && addr.String() == want.String() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	addr, _ := srv.DeviceAddr(deviceID)
+	t.Fatalf("设备 %s 地址 = %v, 期望 %v", deviceID, addr, want)
+}
+
+func TestServerBindIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		trust    bool
+		bind     string // 设备A先发送的报文，为空时不发送
+		hijack   string // 设备B发送的报文
+		hijacked bool   // d1 的地址是否变为设备B
+	}{
+		{"默认拒绝不带凭证的新地址", false, "", `{"device_id":"d1","temp":1}`, false},
+		{"默认不允许不带凭证改绑地址", false, `{"voucher":"v1"}`, `{"device_number":"SN1","temp":1}`, false},
+		{"凭证与设备ID不符", false, `{"voucher":"v1"}`, `{"device_id":"d1","voucher":"v2"}`, false},
+		{"凭证可以改绑地址", false, `{"voucher":"v1"}`, `{"device_id":"d1","voucher":"v1"}`, true},
+		{"TrustIdentity 信任设备ID", true, `{"voucher":"v1"}`, `{"device_id":"d1"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, addr := startServer(t, tt.trust)
+			a, b := dial(t, addr), dial(t, addr)
+			if tt.bind != "" {
+				a.Write([]byte(tt.bind))
+				waitAddr(t, srv, "d1", a.LocalAddr())
+			}
+			b.Write([]byte(tt.hijack))
+			// 同一来源地址的报文按顺序处理，d2 登记后前一个报文已处理完
+			b.Write([]byte(`{"voucher":"v2"}`))
+			waitAddr(t, srv, "d2", b.LocalAddr())
+
+			// 改绑到设备B后，d2 复用该地址会清空 d1 的地址；未改绑时 d1 仍指向设备A或没有登记
+			addr, ok := srv.DeviceAddr("d1")
+			if got := ok && (addr == nil || addr.String() != a.LocalAddr().String()); got != tt.hijacked {
+				t.Errorf("d1 地址 = %v, 期望改为设备B: %v", addr, tt.hijacked)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// gateway/ws/auth.go
+
+package ws
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// HeaderVoucher 携带设备凭证原文的请求头
+const HeaderVoucher = "X-TP-Voucher"
+
+// requestVoucher 从握手请求中读取设备凭证，依次读取 X-TP-Voucher 请求头、
+// Authorization（Bearer 为访问令牌，Basic 为用户名密码）；
+// allowQuery 为 true 且请求经过TLS时再读取 voucher 和 access_token 查询参数，没有凭证时返回空
+func requestVoucher(r *http.Request, allowQuery, trustProto bool) string {
+	if v := r.Header.Get(HeaderVoucher); v != "" {
+		return v
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && strings.TrimSpace(token) != "" {
+		return types.NewAccessTokenVoucher(strings.TrimSpace(token)).String()
+	}
+	if user, pass, ok := r.BasicAuth(); ok && user != "" {
+		if pass == "" {
+			return types.NewUsernameVoucher(user).String()
+		}
+		return types.NewBasicVoucher(user, pass).String()
+	}
+	if !allowQuery || !secure(r, trustProto) {
+		return ""
+	}
+	q := r.URL.Query()
+	if v := q.Get("voucher"); v != "" {
+		return v
+	}
+	if token := q.Get("access_token"); token != "" {
+		return types.NewAccessTokenVoucher(token).String()
+	}
+	return ""
+}
+
+// secure 请求是否经过TLS；X-Forwarded-Proto 可由客户端伪造，只有 trustProto 为 true
+// （服务只能经由终止TLS的可信代理访问）时才读取
+func secure(r *http.Request, trustProto bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return trustProto && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
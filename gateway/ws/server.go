@@ -0,0 +1,342 @@
+// gateway/ws/server.go
+
+// Package ws 设备以WebSocket长连接接入：握手时使用设备凭证认证，
+// 连接上以JSON文本消息上报遥测、属性和事件，平台的控制指令、属性设置和命令推送到连接
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+)
+
+// PathWebSocket 默认的WebSocket接入路径
+const PathWebSocket = "/api/v1/device/ws"
+
+// 上行消息类型，下行消息类型见 gateway.DownlinkType
+const (
+	TypeTelemetry  = "telemetry"
+	TypeAttributes = "attributes"
+	TypeEvent      = "event"
+	TypeError      = "error" // 上行消息处理失败时回复
+)
+
+// Message 连接上收发的消息，遥测、属性、控制指令和属性设置使用 values，事件和命令使用 method 和 params
+type Message struct {
+	Type      string        `json:"type"`
+	MessageID string        `json:"message_id,omitempty"`
+	Method    string        `json:"method,omitempty"`
+	Values    driver.Values `json:"values,omitempty"`
+	Params    driver.Values `json:"params,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Config WebSocket服务配置
+type Config struct {
+	// Bridge 网关，需要设置 gateway.Config.Downlinks 才会收到属性设置和命令
+	Bridge *gateway.Bridge
+	// CheckOrigin 校验握手请求的 Origin，为空时要求与 Host 同源，浏览器跨域接入时需要设置
+	CheckOrigin func(r *http.Request) bool
+	// PingInterval 心跳间隔，超过两个间隔没有收到设备消息或 Pong 时断开，默认30秒
+	PingInterval time.Duration
+	// WriteTimeout 单条消息写超时，默认10秒
+	WriteTimeout time.Duration
+	// MaxMessageBytes 上行消息大小上限，默认64KB
+	MaxMessageBytes int64
+	// SendQueue 每个连接的下行消息队列长度，队列满时下发失败，默认64
+	SendQueue int
+	// AllowQueryCredentials 允许浏览器等无法设置请求头的客户端在 voucher 或 access_token 查询参数中携带凭证，
+	// 默认关闭；开启后也只在请求经过TLS时读取，避免凭证以明文出现在URL和访问日志中
+	AllowQueryCredentials bool
+	// TrustForwardedProto 为 true 时以 X-Forwarded-Proto 为 https 判断请求经过TLS，
+	// 该请求头可由客户端伪造，仅在服务只能经由终止TLS的可信代理访问时开启
+	TrustForwardedProto bool
+	Logger              *log.Logger
+}
+
+// Server WebSocket设备接入服务，实现 http.Handler
+type Server struct {
+	config   Config
+	logger   *log.Logger
+	upgrader websocket.Upgrader
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer 创建WebSocket服务
+func NewServer(config Config) (*Server, error) {
+	if config.Bridge == nil {
+		return nil, fmt.Errorf("WebSocket服务未配置网关")
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = 30 * time.Second
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	if config.MaxMessageBytes <= 0 {
+		config.MaxMessageBytes = 64 * 1024
+	}
+	if config.SendQueue <= 0 {
+		config.SendQueue = 64
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = config.Bridge.Logger()
+	}
+	return &Server{
+		config:   config,
+		logger:   logger,
+		upgrader: websocket.Upgrader{CheckOrigin: config.CheckOrigin},
+		conns:    make(map[*conn]struct{}),
+	}, nil
+}
+
+// Register 将WebSocket接入注册到回调服务的 PathWebSocket，不经过回调认证
+func (s *Server) Register(h *handler.Handler) {
+	h.Handle(http.MethodGet, PathWebSocket, s)
+}
+
+// ServeHTTP 认证设备凭证并升级为WebSocket连接，凭证放在 X-TP-Voucher 请求头、
+// Authorization 请求头，开启 AllowQueryCredentials 时也可放在查询参数中
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	voucher := requestVoucher(r, s.config.AllowQueryCredentials, s.config.TrustForwardedProto)
+	if voucher == "" {
+		writeJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	entry, err := s.config.Bridge.Resolve(r.Context(), gateway.Identity{Voucher: voucher})
+	if err != nil {
+		s.logger.Printf("WebSocket设备认证失败: remote=%s, err=%v", r.RemoteAddr, err)
+		writeJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		writeJSON(w, http.StatusServiceUnavailable, "server closed")
+		return
+	}
+
+	wsConn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已写入错误响应
+		s.logger.Printf("WebSocket握手失败: deviceID=%s, err=%v", entry.ID, err)
+		return
+	}
+
+	c := &conn{
+		server:   s,
+		ws:       wsConn,
+		deviceID: entry.ID,
+		send:     make(chan []byte, s.config.SendQueue),
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		wsConn.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	c.serve(context.WithoutCancel(r.Context()))
+}
+
+// Close 关闭全部连接并等待连接处理结束，之后的握手请求返回503
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// writeJSON 写入与回调接口相同格式的错误响应
+func writeJSON(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(handler.CommonResponse{Code: status, Message: message})
+}
+
+// conn 一个设备连接，实现 gateway.DownlinkSession
+type conn struct {
+	server   *Server
+	ws       *websocket.Conn
+	deviceID string
+	send     chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (c *conn) serve(ctx context.Context) {
+	s := c.server
+	bridge := s.config.Bridge
+	bridge.Attach(c.deviceID, c)
+	defer bridge.Detach(c.deviceID, c)
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+	defer func() {
+		c.Close()
+		<-writerDone
+	}()
+
+	timeout := 2 * s.config.PingInterval
+	c.ws.SetReadLimit(s.config.MaxMessageBytes)
+	c.ws.SetReadDeadline(time.Now().Add(timeout))
+	c.ws.SetPongHandler(func(string) error {
+		c.ws.SetReadDeadline(time.Now().Add(timeout))
+		bridge.Touch(c.deviceID)
+		return nil
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.Printf("WebSocket连接异常断开: deviceID=%s, err=%v", c.deviceID, err)
+			}
+			return
+		}
+		c.ws.SetReadDeadline(time.Now().Add(timeout))
+		bridge.Touch(c.deviceID)
+		if err := c.handle(ctx, data); err != nil {
+			s.logger.Printf("WebSocket上行消息处理失败: deviceID=%s, err=%v", c.deviceID, err)
+			c.reply(Message{Type: TypeError, Error: err.Error()})
+		}
+	}
+}
+
+// handle 处理一条上行消息
+func (c *conn) handle(ctx context.Context, data []byte) error {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("消息格式错误: %w", err)
+	}
+	bridge := c.server.config.Bridge
+	switch msg.Type {
+	case TypeTelemetry:
+		return bridge.Publish(ctx, c.deviceID, msg.Values)
+	case TypeAttributes:
+		return bridge.PublishAttributes(ctx, c.deviceID, msg.Values)
+	case TypeEvent:
+		return bridge.PublishEvent(ctx, c.deviceID, gateway.Event{Method: msg.Method, Params: msg.Params})
+	default:
+		return fmt.Errorf("消息类型不支持: %s", msg.Type)
+	}
+}
+
+// reply 回复消息，队列满时丢弃
+func (c *conn) reply(msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.enqueue(data)
+}
+
+func (c *conn) enqueue(data []byte) error {
+	select {
+	case <-c.done:
+		return fmt.Errorf("连接已关闭: deviceID=%s", c.deviceID)
+	default:
+	}
+	select {
+	case c.send <- data:
+		return nil
+	default:
+		return fmt.Errorf("发送队列已满: deviceID=%s", c.deviceID)
+	}
+}
+
+// writeLoop 发送队列中的消息和心跳，连接关闭时发送关闭帧
+func (c *conn) writeLoop() {
+	s := c.server
+	ticker := time.NewTicker(s.config.PingInterval)
+	defer ticker.Stop()
+	defer c.ws.Close()
+
+	for {
+		select {
+		case data := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(s.config.WriteTimeout)
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			deadline := time.Now().Add(s.config.WriteTimeout)
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+			return
+		}
+	}
+}
+
+// Send 推送控制指令
+func (c *conn) Send(ctx context.Context, values driver.Values) error {
+	return c.SendDownlink(ctx, gateway.Downlink{Type: gateway.DownlinkControl, Values: values})
+}
+
+// SendDownlink 推送控制指令、属性设置或命令
+func (c *conn) SendDownlink(_ context.Context, d gateway.Downlink) error {
+	msg := Message{Type: string(d.Type), MessageID: d.MessageID, Method: d.Method}
+	if d.Type == gateway.DownlinkCommand {
+		msg.Params = d.Values
+	} else {
+		msg.Values = d.Values
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化下发消息失败: %w", err)
+	}
+	return c.enqueue(data)
+}
+
+// Close 发送关闭帧并关闭连接
+func (c *conn) Close() error {
+	// 写协程发送关闭帧后关闭底层连接，读循环随之退出
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
@@ -0,0 +1,208 @@
+// gateway/ws/server_test.go
+
+package ws
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/driver"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/gateway"
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// recordMQTT 记录发布的主题
+type recordMQTT struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (m *recordMQTT) PublishContext(_ context.Context, topic string, _ byte, _ interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.topics = append(m.topics, topic)
+	return nil
+}
+
+func (m *recordMQTT) SubscribeContext(string, byte, client.ContextMessageHandler) error {
+	return nil
+}
+
+func (m *recordMQTT) published() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.topics...)
+}
+
+// startServer 启动服务，注册表中有设备 d1（访问令牌 tok）
+func startServer(t *testing.T, config Config) (string, *gateway.Bridge, *recordMQTT) {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	registry := client.NewDeviceRegistry(nil)
+	registry.AddDevice(types.Device{ID: "d1", Voucher: `{"access_token":"tok"}`})
+	mqtt := &recordMQTT{}
+	bridge := gateway.New(gateway.Config{ServiceIdentifier: "svc", MQTT: mqtt, Registry: registry, Logger: logger, Downlinks: true})
+	config.Bridge = bridge
+	config.Logger = logger
+	srv, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		srv.Close()
+		hs.Close()
+	})
+	return "ws" + strings.TrimPrefix(hs.URL, "http") + PathWebSocket, bridge, mqtt
+}
+
+// dial 连接服务，返回连接和握手响应状态码
+func dial(t *testing.T, url string, header http.Header) (*websocket.Conn, int) {
+	t.Helper()
+	c, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		if resp == nil {
+			t.Fatal(err)
+		}
+		return nil, resp.StatusCode
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, resp.StatusCode
+}
+
+// waitSession 等待设备连接登记到网关
+func waitSession(t *testing.T, bridge *gateway.Bridge, deviceID string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := bridge.Session(deviceID); ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("设备 %s 未登记连接", deviceID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerUpgradeAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		query  string
+		header http.Header
+		status int
+	}{
+		{"无凭证", Config{}, "", nil, http.StatusUnauthorized},
+		{"Bearer令牌", Config{}, "", http.Header{"Authorization": {"Bearer tok"}}, http.StatusSwitchingProtocols},
+		{"凭证请求头", Config{}, "", http.Header{HeaderVoucher: {`{"access_token":"tok"}`}}, http.StatusSwitchingProtocols},
+		{"错误令牌", Config{}, "", http.Header{"Authorization": {"Bearer bad"}}, http.StatusUnauthorized},
+		{"未开启查询参数凭证", Config{}, "access_token=tok", nil, http.StatusUnauthorized},
+		{"明文连接不读取查询参数", Config{AllowQueryCredentials: true}, "access_token=tok", nil, http.StatusUnauthorized},
+		{"不信任伪造的 X-Forwarded-Proto", Config{AllowQueryCredentials: true}, "access_token=tok",
+			http.Header{"X-Forwarded-Proto": {"https"}}, http.StatusUnauthorized},
+		{"可信代理的 X-Forwarded-Proto", Config{AllowQueryCredentials: true, TrustForwardedProto: true}, "access_token=tok",
+			http.Header{"X-Forwarded-Proto": {"https"}}, http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, _, _ := startServer(t, tt.config)
+			if tt.query != "" {
+				url += "?" + tt.query
+			}
+			if _, status := dial(t, url, tt.header); status != tt.status {
+				t.Errorf("握手状态码 = %d, 期望 %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestServerUplink(t *testing.T) {
+	url, bridge, mqtt := startServer(t, Config{})
+	c, _ := dial(t, url, http.Header{"Authorization": {"Bearer tok"}})
+	waitSession(t, bridge, "d1")
+
+	for _, msg := range []Message{
+		{Type: TypeTelemetry, Values: driver.Values{"temp": 1}},
+		{Type: TypeAttributes, Values: driver.Values{"version": "1.0"}},
+		{Type: TypeEvent, Method: "alarm", Params: driver.Values{"level": 2}},
+		{Type: "unknown"},
+	} {
+		if err := c.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 同一连接上的消息按顺序处理，收到错误回复时之前的消息已发布
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var reply Message
+	if err := c.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type != TypeError || reply.Error == "" {
+		t.Errorf("回复 = %+v, 期望不支持的消息类型错误", reply)
+	}
+
+	want := []string{"plugin/svc/" + driver.TelemetryTopic, "plugin/svc/" + gateway.AttributesTopic + "/", "plugin/svc/" + gateway.EventTopic + "/"}
+	topics := mqtt.published()
+	if len(topics) != len(want) {
+		t.Fatalf("发布主题 = %v", topics)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(topics[i], prefix) {
+			t.Errorf("第%d条主题 = %s, 期望前缀 %s", i+1, topics[i], prefix)
+		}
+	}
+}
+
+func TestServerDownlink(t *testing.T) {
+	url, bridge, _ := startServer(t, Config{})
+	c, _ := dial(t, url, http.Header{"Authorization": {"Bearer tok"}})
+	waitSession(t, bridge, "d1")
+	ctx := context.Background()
+
+	if err := bridge.Send(ctx, "d1", driver.Values{"switch": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bridge.SendDownlink(ctx, "d1", gateway.Downlink{Type: gateway.DownlinkCommand, MessageID: "m1", Method: "reboot", Values: driver.Values{"delay": 5}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var control, command Message
+	if err := c.ReadJSON(&control); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadJSON(&command); err != nil {
+		t.Fatal(err)
+	}
+	if control.Type != string(gateway.DownlinkControl) || control.Values["switch"] != float64(1) {
+		t.Errorf("控制指令 = %+v", control)
+	}
+	if command.Type != string(gateway.DownlinkCommand) || command.MessageID != "m1" || command.Method != "reboot" || command.Params["delay"] != float64(5) {
+		t.Errorf("命令 = %+v", command)
+	}
+
+	// 设备断开后注销连接
+	c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := bridge.Session("d1"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("设备断开后连接未注销")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,292 @@
+// handler/auth.go
+
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 回调签名相关请求头
+const (
+	HeaderTimestamp = "X-TP-Timestamp" // 签名时间戳，Unix秒
+	HeaderSignature = "X-TP-Signature" // HMAC-SHA256签名，十六进制
+)
+
+// 默认重放窗口
+const defaultReplayWindow = 5 * time.Minute
+
+// 签名校验默认读取的请求体上限
+const defaultAuthMaxBodyBytes = 1 << 20
+
+// AuthConfig 回调认证配置，配置的多种方式需同时满足
+type AuthConfig struct {
+	// HMACSecret 共享密钥，非空时校验 X-TP-Timestamp 和 X-TP-Signature
+	HMACSecret string
+	// ReplayWindow 时间戳允许偏差，窗口内重复的签名会被拒绝，默认5分钟
+	ReplayWindow time.Duration
+	// BearerToken 非空时要求 Authorization: Bearer <token>
+	BearerToken string
+	// AllowedIPs 来源IP或CIDR白名单，为空时不限制
+	AllowedIPs []string
+	// TrustForwardedFor 为 true 时从 X-Forwarded-For 中取来源IP，仅在可信代理后使用。
+	// 代理会把上一跳地址追加到客户端发来的 X-Forwarded-For 之后，左侧的地址可由客户端伪造，
+	// 因此取从右数第 TrustedProxies 个地址，地址数量不足时拒绝请求
+	TrustForwardedFor bool
+	// TrustedProxies 请求经过的可信代理层数，TrustForwardedFor 为 true 时生效，默认1（取最右侧的地址）
+	TrustedProxies int
+	// MaxBodyBytes 签名校验时读取的请求体上限，超过时返回413，默认1MB
+	MaxBodyBytes int64
+}
+
+// Authenticate 创建回调认证中间件，认证失败时返回标准错误响应并记录原因
+func Authenticate(config AuthConfig, logger *log.Logger) (Middleware, error) {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	nets, err := parseAllowedIPs(config.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	window := config.ReplayWindow
+	if window <= 0 {
+		window = defaultReplayWindow
+	}
+	replay := newReplayCache(window)
+
+	hops := config.TrustedProxies
+	if hops <= 0 {
+		hops = 1
+	}
+	maxBody := config.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = defaultAuthMaxBodyBytes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(nets) > 0 {
+				ip := clientIP(r, config.TrustForwardedFor, hops)
+				if !ipAllowed(ip, nets) {
+					logger.Printf("回调认证失败: 来源IP不在白名单, ip=%s, path=%s", ip, r.URL.Path)
+					writeEnvelope(w, http.StatusForbidden, 0, "forbidden", nil)
+					return
+				}
+			}
+
+			if config.BearerToken != "" {
+				token, ok := bearerToken(r)
+				if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.BearerToken)) != 1 {
+					logger.Printf("回调认证失败: Bearer令牌无效, remote=%s, path=%s", r.RemoteAddr, r.URL.Path)
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					writeEnvelope(w, http.StatusUnauthorized, 0, "unauthorized", nil)
+					return
+				}
+			}
+
+			if config.HMACSecret != "" {
+				// 签名校验前需读取完整请求体，限制大小避免未认证的请求占用内存
+				if r.Body != nil && r.Body != http.NoBody {
+					r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+				}
+				if reason, err := verifySignature(r, config.HMACSecret, window, replay); reason != "" {
+					logger.Printf("回调认证失败: %s, remote=%s, path=%s", reason, r.RemoteAddr, r.URL.Path)
+					// 请求体超过 MaxBodyBytes 或 BodyLimit 时与参数绑定一致返回413
+					var maxBytesErr *http.MaxBytesError
+					if errors.As(err, &maxBytesErr) {
+						writeEnvelope(w, http.StatusRequestEntityTooLarge, 0, "request body too large", nil)
+						return
+					}
+					writeEnvelope(w, http.StatusUnauthorized, 0, "unauthorized", nil)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// SignRequest 为请求计算签名并设置 X-TP-Timestamp 和 X-TP-Signature 头，
+// 供平台侧或测试调用方使用，会读取并恢复请求体
+func SignRequest(r *http.Request, secret string, now time.Time) error {
+	body, err := readAndRestoreBody(r)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	r.Header.Set(HeaderTimestamp, ts)
+	r.Header.Set(HeaderSignature, computeSignature(secret, r.Method, r.URL.RequestURI(), ts, body))
+	return nil
+}
+
+// computeSignature 签名内容为 方法\n请求URI\n时间戳\n请求体SHA256十六进制
+func computeSignature(secret, method, uri, ts string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, uri, ts, hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature 校验签名，返回失败原因，通过时返回空字符串；读取请求体失败时同时返回读取错误
+func verifySignature(r *http.Request, secret string, window time.Duration, replay *replayCache) (string, error) {
+	ts := r.Header.Get(HeaderTimestamp)
+	sig := r.Header.Get(HeaderSignature)
+	if ts == "" || sig == "" {
+		return "缺少签名头", nil
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "时间戳格式错误", nil
+	}
+	now := time.Now()
+	if skew := now.Sub(time.Unix(sec, 0)); skew > window || skew < -window {
+		return fmt.Sprintf("时间戳超出重放窗口, skew=%v", skew), nil
+	}
+
+	body, err := readAndRestoreBody(r)
+	if err != nil {
+		return fmt.Sprintf("读取请求体失败: %v", err), err
+	}
+	expected := computeSignature(secret, r.Method, r.URL.RequestURI(), ts, body)
+	if !hmac.Equal([]byte(strings.ToLower(sig)), []byte(expected)) {
+		return "签名不匹配", nil
+	}
+
+	if !replay.add(expected, now) {
+		return "重复的签名请求", nil
+	}
+	return "", nil
+}
+
+func readAndRestoreBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
+
+func parseAllowedIPs(items []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的IP地址: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的CIDR: %s", item)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// clientIP 返回来源IP，信任 X-Forwarded-For 时取从右数第 hops 个地址，数量不足时返回空
+func clientIP(r *http.Request, trustForwardedFor bool, hops int) string {
+	if trustForwardedFor {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			var addrs []string
+			for _, v := range values {
+				for _, addr := range strings.Split(v, ",") {
+					if addr = strings.TrimSpace(addr); addr != "" {
+						addrs = append(addrs, addr)
+					}
+				}
+			}
+			if len(addrs) < hops {
+				return ""
+			}
+			return addrs[len(addrs)-hops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ipAllowed(ipStr string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// replayCache 记录重放窗口内已使用的签名
+type replayCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func newReplayCache(window time.Duration) *replayCache {
+	return &replayCache{window: window, seen: make(map[string]time.Time)}
+}
+
+// add 记录签名，已存在时返回 false
+func (c *replayCache) add(sig string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, t := range c.seen {
+		if now.Sub(t) > 2*c.window {
+			delete(c.seen, k)
+		}
+	}
+	if _, ok := c.seen[sig]; ok {
+		return false
+	}
+	c.seen[sig] = now
+	return true
+}
@@ -0,0 +1,143 @@
+// handler/auth_test.go
+
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewInvalidAuth(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	if _, err := New(HandlerConfig{Logger: logger, Auth: &AuthConfig{AllowedIPs: []string{"not-an-ip"}}}); err == nil {
+		t.Fatal("无效的白名单应返回错误")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewHandler 遇到无效的认证配置应panic")
+		}
+	}()
+	NewHandler(HandlerConfig{Logger: logger, Auth: &AuthConfig{AllowedIPs: []string{"not-an-ip"}}})
+}
+
+func TestAuthSignatureBodyLimit(t *testing.T) {
+	const secret = "secret"
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"未超过限制", `{"device_id":"d1"}`, http.StatusOK},
+		{"超过限制", `{"device_id":"` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(HandlerConfig{Logger: log.New(io.Discard, "", 0), Auth: &AuthConfig{HMACSecret: secret}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.Use(BodyLimit(32))
+			h.SetDeviceDisconnectHandler(func(req *DeviceDisconnectRequest) error { return nil })
+
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			r := httptest.NewRequest(http.MethodPost, PathDeviceDisconnect, strings.NewReader(tt.body))
+			r.ContentLength = -1 // 分块传输时长度未知，由 MaxBytesReader 在读取时限制
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set(HeaderTimestamp, ts)
+			r.Header.Set(HeaderSignature, computeSignature(secret, r.Method, r.URL.RequestURI(), ts, []byte(tt.body)))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("状态码 = %d, 期望 %d, 响应 %s", w.Code, tt.status, w.Body)
+			}
+			var resp CommonResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("响应不是JSON信封: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies int
+		xff     []string
+		status  int
+	}{
+		{"代理追加的地址在白名单", 0, []string{"203.0.113.9, 10.0.0.5"}, http.StatusOK},
+		{"客户端伪造的前缀被忽略", 0, []string{"10.0.0.5, 203.0.113.9"}, http.StatusForbidden},
+		{"多个请求头按顺序拼接", 0, []string{"10.0.0.5", "203.0.113.9"}, http.StatusForbidden},
+		{"两层可信代理", 2, []string{"10.0.0.5, 10.0.0.5, 203.0.113.9, 192.168.0.1"}, http.StatusForbidden},
+		{"两层可信代理取倒数第二个", 2, []string{"203.0.113.9, 10.0.0.5, 192.168.0.1"}, http.StatusOK},
+		{"地址数量少于代理层数", 2, []string{"10.0.0.5"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(HandlerConfig{Logger: log.New(io.Discard, "", 0), Auth: &AuthConfig{
+				AllowedIPs:        []string{"10.0.0.0/24"},
+				TrustForwardedFor: true,
+				TrustedProxies:    tt.proxies,
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.SetDeviceDisconnectHandler(func(req *DeviceDisconnectRequest) error { return nil })
+
+			r := httptest.NewRequest(http.MethodPost, PathDeviceDisconnect, strings.NewReader(`{"device_id":"d1"}`))
+			r.Header.Set("Content-Type", "application/json")
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("状态码 = %d, 期望 %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAuthSignatureMaxBodyBytes(t *testing.T) {
+	const secret = "secret"
+	tests := []struct {
+		name   string
+		limit  int64
+		size   int
+		status int
+	}{
+		{"默认上限以内", 0, 1024, http.StatusOK},
+		{"超过默认上限", 0, 2 << 20, http.StatusRequestEntityTooLarge},
+		{"超过配置的上限", 64, 128, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(HandlerConfig{Logger: log.New(io.Discard, "", 0), Auth: &AuthConfig{HMACSecret: secret, MaxBodyBytes: tt.limit}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.SetDeviceDisconnectHandler(func(req *DeviceDisconnectRequest) error { return nil })
+
+			body := `{"device_id":"d1","pad":"` + strings.Repeat("x", tt.size) + `"}`
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			r := httptest.NewRequest(http.MethodPost, PathDeviceDisconnect, strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set(HeaderTimestamp, ts)
+			r.Header.Set(HeaderSignature, computeSignature(secret, r.Method, r.URL.RequestURI(), ts, []byte(body)))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("状态码 = %d, 期望 %d", w.Code, tt.status)
+			}
+		})
+	}
+}
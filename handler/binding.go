@@ -0,0 +1,177 @@
+// handler/binding.go
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/internal/binding"
+)
+
+// 表单请求体解析的最大内存
+const maxMultipartMemory = 8 << 20
+
+// FieldError 请求参数字段错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// BindError 请求参数校验错误，列出所有缺失或格式错误的字段
+type BindError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error 实现 error 接口
+func (e *BindError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return "请求参数错误: " + strings.Join(parts, "; ")
+}
+
+// Bind 将请求参数绑定到 obj（结构体指针）
+//
+// 带 form 标签的字段从查询参数或表单请求体读取，带 json 标签的字段从JSON请求体读取，
+// 字符串会按字段类型转换为整数、布尔等，binding:"required" 的字段缺失时报错，
+// 校验失败时返回 *BindError
+func Bind(r *http.Request, obj interface{}) error {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("绑定目标必须为结构体指针")
+	}
+
+	values, body, err := readRequestValues(r)
+	if err != nil {
+		return err
+	}
+
+	var errs []FieldError
+	bindStruct(rv.Elem(), values, body, &errs)
+	if len(errs) > 0 {
+		return &BindError{Errors: errs}
+	}
+	return nil
+}
+
+// readRequestValues 读取查询参数/表单值以及JSON请求体
+func readRequestValues(r *http.Request) (url.Values, map[string]interface{}, error) {
+	values := r.URL.Query()
+	if r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return values, nil, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, nil, fmt.Errorf("解析表单请求体失败: %w", err)
+		}
+		return r.Form, nil, nil
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return nil, nil, fmt.Errorf("解析表单请求体失败: %w", err)
+		}
+		return r.Form, nil, nil
+	}
+
+	// 其余情况按JSON请求体处理，空请求体视为没有字段
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取请求体失败: %w", err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return values, nil, nil
+	}
+	body := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("请求体格式错误: %w", err)
+	}
+	return values, body, nil
+}
+
+func bindStruct(rv reflect.Value, values url.Values, body map[string]interface{}, errs *[]FieldError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		if sf.Anonymous && sf.Tag.Get("form") == "" && sf.Tag.Get("json") == "" && fv.Kind() == reflect.Struct {
+			bindStruct(fv, values, body, errs)
+			continue
+		}
+
+		name, src, present := lookupField(sf, fv, values, body)
+		if name == "" {
+			continue
+		}
+
+		rules, err := binding.ParseRules(sf.Tag.Get("binding"))
+		if err != nil {
+			*errs = append(*errs, FieldError{Field: name, Message: err.Error()})
+			continue
+		}
+
+		if !present || binding.IsEmpty(src) {
+			def, hasDefault := sf.Tag.Lookup("default")
+			switch {
+			case hasDefault:
+				src = def
+			case rules.Required:
+				*errs = append(*errs, FieldError{Field: name, Message: "必填字段缺失"})
+				continue
+			default:
+				continue
+			}
+		}
+
+		if err := binding.SetValue(fv, src); err != nil {
+			*errs = append(*errs, FieldError{Field: name, Message: err.Error()})
+			continue
+		}
+		if msg := rules.Check(fv); msg != "" {
+			*errs = append(*errs, FieldError{Field: name, Message: msg})
+		}
+	}
+}
+
+// lookupField 按 form 标签从查询参数/表单读取，按 json 标签从JSON请求体读取
+func lookupField(sf reflect.StructField, fv reflect.Value, values url.Values, body map[string]interface{}) (string, interface{}, bool) {
+	if _, ok := sf.Tag.Lookup("form"); ok {
+		name, ok := binding.FieldName(sf, "form")
+		if !ok {
+			return "", nil, false
+		}
+		vals, present := values[name]
+		if !present || len(vals) == 0 {
+			return name, nil, false
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			items := make([]interface{}, len(vals))
+			for i, v := range vals {
+				items[i] = v
+			}
+			return name, items, true
+		}
+		return name, vals[0], true
+	}
+
+	name, ok := binding.FieldName(sf, "json")
+	if !ok {
+		return "", nil, false
+	}
+	src, present := body[name]
+	return name, src, present
+}
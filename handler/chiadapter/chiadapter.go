@@ -0,0 +1,17 @@
+// handler/chiadapter/chiadapter.go
+
+// Package chiadapter 将 handler.Handler 的路由挂载到 chi
+package chiadapter
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+)
+
+// Register 将全部路由注册到 chi 路由，需要路径前缀时使用 r.Route("/prefix", ...)
+func Register(r chi.Router, h *handler.Handler) {
+	for _, rt := range h.Routes() {
+		r.Method(rt.Method, rt.Path, rt.Handler)
+	}
+}
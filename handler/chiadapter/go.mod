@@ -0,0 +1,13 @@
+module github.com/ThingsPanel/tp-protocol-sdk-go/handler/chiadapter
+
+go 1.22
+
+require (
+	github.com/ThingsPanel/tp-protocol-sdk-go v1.2.0
+	github.com/go-chi/chi/v5 v5.1.0
+)
+
+require (
+	go.opentelemetry.io/otel v1.28.0 // indirect
+	go.opentelemetry.io/otel/trace v1.28.0 // indirect
+)
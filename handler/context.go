@@ -0,0 +1,52 @@
+// handler/context.go
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	requestInfoKey
+)
+
+// RequestInfo 回调请求元数据，随 context 传入回调函数
+type RequestInfo struct {
+	RequestID  string    // 请求ID，来自 RequestID 中间件或 X-Request-ID 请求头
+	Method     string    // 请求方法
+	Path       string    // 请求路径
+	RemoteAddr string    // 来源地址
+	UserAgent  string    // 客户端标识
+	ReceivedAt time.Time // 接收时间
+}
+
+// RequestInfoFromContext 获取回调请求元数据
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey).(*RequestInfo)
+	return info, ok
+}
+
+// withRequestInfo 将请求元数据写入请求上下文
+func withRequestInfo(r *http.Request) *http.Request {
+	if _, ok := RequestInfoFromContext(r.Context()); ok {
+		return r
+	}
+	id := RequestIDFromContext(r.Context())
+	if id == "" {
+		id = r.Header.Get(HeaderRequestID)
+	}
+	info := &RequestInfo{
+		RequestID:  id,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		ReceivedAt: time.Now(),
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+}
@@ -0,0 +1,22 @@
+// handler/echoadapter/echoadapter.go
+
+// Package echoadapter 将 handler.Handler 的路由挂载到 echo
+package echoadapter
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+)
+
+// Router *echo.Echo 与 *echo.Group 共有的路由注册接口
+type Router interface {
+	Add(method, path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route
+}
+
+// Register 将全部路由注册到 echo，需要路径前缀时传入 e.Group("/prefix")
+func Register(r Router, h *handler.Handler) {
+	for _, rt := range h.Routes() {
+		r.Add(rt.Method, rt.Path, echo.WrapHandler(rt.Handler))
+	}
+}
@@ -0,0 +1,71 @@
+// handler/errors.go
+
+package handler
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error 回调处理错误，同时携带HTTP状态码和业务码
+// 回调函数返回 *Error 时，处理器按其状态码和业务码写入响应，
+// 返回其他错误时按 500 处理
+type Error struct {
+	Status  int    // HTTP状态码，为0时使用500
+	Code    int    // 业务码，写入响应的 code 字段，为0时与 Status 相同
+	Message string // 错误描述，写入响应的 message 字段
+	Err     error  // 原始错误
+}
+
+// NewError 创建回调处理错误
+func NewError(status, code int, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// WrapError 用HTTP状态码和业务码包装已有错误
+func WrapError(status, code int, err error) *Error {
+	e := &Error{Status: status, Code: code, Err: err}
+	if err != nil {
+		e.Message = err.Error()
+	}
+	return e
+}
+
+// Error 实现 error 接口
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return http.StatusText(e.status())
+}
+
+// Unwrap 返回原始错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) status() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+
+func (e *Error) code() int {
+	if e.Code == 0 {
+		return e.status()
+	}
+	return e.Code
+}
+
+// errorStatus 解析错误对应的HTTP状态码、业务码和描述
+func errorStatus(err error) (status, code int, message string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.status(), e.code(), e.Error()
+	}
+	return http.StatusInternalServerError, http.StatusInternalServerError, err.Error()
+}
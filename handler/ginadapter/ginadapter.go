@@ -0,0 +1,17 @@
+// handler/ginadapter/ginadapter.go
+
+// Package ginadapter 将 handler.Handler 的路由挂载到 gin
+package ginadapter
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+)
+
+// Register 将全部路由注册到 gin 路由，需要路径前缀时传入 engine.Group("/prefix")
+func Register(r gin.IRoutes, h *handler.Handler) {
+	for _, rt := range h.Routes() {
+		r.Handle(rt.Method, rt.Path, gin.WrapH(rt.Handler))
+	}
+}
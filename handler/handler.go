@@ -3,189 +3,266 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
+	"sync"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
 )
 
 // HandlerConfig 处理器配置
 type HandlerConfig struct {
-	Logger *log.Logger // 日志记录器
+	Logger *log.Logger  // 日志记录器
+	Auth   *AuthConfig  // 回调认证配置，为空时不认证
+	Server ServerConfig // HTTP服务超时配置
+
+	// Metrics 指标记录器，为空时不记录，Prometheus 实现见 metrics/prommetrics
+	Metrics metrics.Recorder
+
+	// Tracing OpenTelemetry 链路追踪配置，为回调路由创建服务端span
+	Tracing TracingConfig
 }
 
 // Handler 回调处理器
 type Handler struct {
 	logger                  *log.Logger
-	formConfigHandler       func(req *GetFormConfigRequest) (interface{}, error)
-	deviceDisconnectHandler func(req *DeviceDisconnectRequest) error
-	notificationHandler     func(req *NotificationRequest) error
-	getDeviceListHandler    func(req *GetDeviceListRequest) (*DeviceListResponse, error)
-	getDeviceInfoHandler    func(req *GetDeviceInfoRequest) (*GetDeviceInfoResponse, error)
+	formConfigHandler       func(ctx context.Context, req *GetFormConfigRequest) (interface{}, error)
+	deviceDisconnectHandler func(ctx context.Context, req *DeviceDisconnectRequest) error
+	notificationHandler     func(ctx context.Context, req *NotificationRequest) error
+	getDeviceListHandler    func(ctx context.Context, req *GetDeviceListRequest) (*DeviceListResponse, error)
+	getDeviceInfoHandler    func(ctx context.Context, req *GetDeviceInfoRequest) (*GetDeviceInfoResponse, error)
+
+	listenerMu          sync.RWMutex
+	disconnectListeners []func(ctx context.Context, deviceID string) // 设备断开监听器
+
+	middlewares []Middleware // 中间件列表
+	auth        Middleware   // 回调认证，仅作用于平台回调路由
+	routes      []route      // 自定义路由
+	health      healthRegistry
+	metrics     metrics.Recorder
+	tracing     tracing
+	chain       http.Handler // 中间件包装后的处理链
+
+	serverConfig ServerConfig
+	mu           sync.Mutex
+	server       *http.Server // 运行中的HTTP服务
 }
 
-// NewHandler 创建一个新的处理器实例
-func NewHandler(config HandlerConfig) *Handler {
+// New 创建处理器，回调认证配置无效时返回错误
+func New(config HandlerConfig) (*Handler, error) {
 	logger := config.Logger
 	if logger == nil {
 		logger = log.New(log.Writer(), "[TP-Handler] ", log.LstdFlags|log.Lshortfile)
 	}
 
-	return &Handler{
-		logger: logger,
+	h := &Handler{
+		logger:       logger,
+		serverConfig: config.Server,
+		metrics:      metrics.OrNop(config.Metrics),
+		tracing:      newTracing(config.Tracing),
 	}
-}
-
-// parseQueryParams 解析查询参数
-func parseQueryParams(r *http.Request, obj interface{}) error {
-	// 这里可以使用反射来实现，为了简单起见，我们针对具体类型处理
-	switch v := obj.(type) {
-	case *GetFormConfigRequest:
-		v.ProtocolType = r.URL.Query().Get("protocol_type")
-		v.DeviceType = r.URL.Query().Get("device_type")
-		v.FormType = r.URL.Query().Get("form_type")
 
-		// 验证必填参数
-		if v.ProtocolType == "" || v.FormType == "" {
-			return fmt.Errorf("missing required query parameters")
-		}
-
-	case *GetDeviceListRequest:
-		v.Voucher = r.URL.Query().Get("voucher")
-		v.ServiceIdentifier = r.URL.Query().Get("service_identifier")
-
-		pageSize := r.URL.Query().Get("page_size")
-		page := r.URL.Query().Get("page")
-
-		if v.Voucher == "" || pageSize == "" || page == "" {
-			return fmt.Errorf("missing required query parameters")
-		}
-
-		var err error
-		v.PageSize, err = strconv.Atoi(pageSize)
+	if config.Auth != nil {
+		auth, err := Authenticate(*config.Auth, logger)
 		if err != nil {
-			return fmt.Errorf("invalid page_size")
+			return nil, fmt.Errorf("回调认证配置无效: %w", err)
 		}
+		h.auth = auth
+	}
 
-		v.Page, err = strconv.Atoi(page)
-		if err != nil {
-			return fmt.Errorf("invalid page")
-		}
+	return h, nil
+}
+
+// NewHandler 创建一个新的处理器实例，同 New，回调认证配置无效时panic，
+// 避免回调接口在无保护或全部拒绝的状态下启动
+func NewHandler(config HandlerConfig) *Handler {
+	h, err := New(config)
+	if err != nil {
+		panic(err)
 	}
-	return nil
+	return h
 }
 
 func (h *Handler) handleFormConfig(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	if h.formConfigHandler == nil {
+		h.writeNotImplemented(w, r)
 		return
 	}
 
 	var req GetFormConfigRequest
-	if err := parseQueryParams(r, &req); err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+	if err := Bind(r, &req); err != nil {
+		h.writeBindError(w, err)
 		return
 	}
 
-	data, err := h.formConfigHandler(&req)
+	data, err := h.formConfigHandler(r.Context(), &req)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err.Error())
+		h.writeHandlerError(w, err)
 		return
 	}
 
-	h.writeResponse(w, http.StatusOK, "success", data)
+	h.writeResponse(w, http.StatusOK, http.StatusOK, "success", data)
 }
 
 func (h *Handler) handleDeviceDisconnect(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	h.listenerMu.RLock()
+	listeners := h.disconnectListeners
+	h.listenerMu.RUnlock()
+
+	if h.deviceDisconnectHandler == nil && len(listeners) == 0 {
+		h.writeNotImplemented(w, r)
 		return
 	}
 
 	var req DeviceDisconnectRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "invalid request body")
+	if err := Bind(r, &req); err != nil {
+		h.writeBindError(w, err)
 		return
 	}
 
-	if err := h.deviceDisconnectHandler(&req); err != nil {
-		h.writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	if h.deviceDisconnectHandler != nil {
+		if err := h.deviceDisconnectHandler(r.Context(), &req); err != nil {
+			h.writeHandlerError(w, err)
+			return
+		}
+	}
+	for _, listener := range listeners {
+		listener(r.Context(), req.DeviceID)
 	}
 
-	h.writeResponse(w, http.StatusOK, "success", nil)
+	h.writeResponse(w, http.StatusOK, http.StatusOK, "success", nil)
 }
 
 func (h *Handler) handleNotification(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	if h.notificationHandler == nil {
+		h.writeNotImplemented(w, r)
 		return
 	}
 
 	var req NotificationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "invalid request body")
+	if err := Bind(r, &req); err != nil {
+		h.writeBindError(w, err)
 		return
 	}
 
-	if err := h.notificationHandler(&req); err != nil {
-		h.writeError(w, http.StatusInternalServerError, err.Error())
+	if err := h.notificationHandler(r.Context(), &req); err != nil {
+		h.writeHandlerError(w, err)
 		return
 	}
 
-	h.writeResponse(w, http.StatusOK, "success", nil)
+	h.writeResponse(w, http.StatusOK, http.StatusOK, "success", nil)
 }
 
 func (h *Handler) handleGetDeviceList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	if h.getDeviceListHandler == nil {
+		h.writeNotImplemented(w, r)
 		return
 	}
 
 	var req GetDeviceListRequest
-	if err := parseQueryParams(r, &req); err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+	if err := Bind(r, &req); err != nil {
+		h.writeBindError(w, err)
 		return
 	}
 
-	resp, err := h.getDeviceListHandler(&req)
+	resp, err := h.getDeviceListHandler(r.Context(), &req)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err.Error())
+		h.writeHandlerError(w, err)
+		return
+	}
+
+	if resp == nil {
+		h.writeResponse(w, http.StatusOK, http.StatusOK, "success", nil)
 		return
 	}
 
-	h.writeResponse(w, http.StatusOK, "success", resp.Data)
+	h.writeResponse(w, http.StatusOK, resp.Code, resp.Message, resp.Data)
 }
 
 // 通过密钥获取设备信息
 func (h *Handler) handleGetDeviceInfo(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	if h.getDeviceInfoHandler == nil {
+		h.writeNotImplemented(w, r)
 		return
 	}
 
 	var req GetDeviceInfoRequest
-	if err := parseQueryParams(r, &req); err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+	if err := Bind(r, &req); err != nil {
+		h.writeBindError(w, err)
 		return
 	}
 
-	data, err := h.getDeviceInfoHandler(&req)
+	resp, err := h.getDeviceInfoHandler(r.Context(), &req)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err.Error())
+		h.writeHandlerError(w, err)
 		return
 	}
 
-	h.writeResponse(w, http.StatusOK, "success", data)
+	if resp == nil {
+		h.writeResponse(w, http.StatusOK, http.StatusOK, "success", nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, resp.Code, resp.Message, resp.Data)
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
+	h.writeResponse(w, status, status, message, nil)
+}
+
+// writeMethodNotAllowed 写入405响应并设置 Allow 头
+func (h *Handler) writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// writeHandlerError 写入回调函数返回的错误，*Error 携带的状态码和业务码会原样返回
+func (h *Handler) writeHandlerError(w http.ResponseWriter, err error) {
+	status, code, message := errorStatus(err)
+	h.logger.Printf("回调处理失败: status=%d, code=%d, err=%v", status, code, err)
+	h.writeResponse(w, status, code, message, nil)
+}
+
+// writeNotImplemented 回调未注册时返回未实现响应，避免空指针panic
+func (h *Handler) writeNotImplemented(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("回调未注册: %s %s", r.Method, r.URL.Path)
+	h.writeError(w, http.StatusNotImplemented, "not implemented")
+}
+
+// writeBindError 写入参数绑定错误，字段错误列表放在 data 中
+func (h *Handler) writeBindError(w http.ResponseWriter, err error) {
+	var bindErr *BindError
+	if errors.As(err, &bindErr) {
+		h.writeResponse(w, http.StatusBadRequest, http.StatusBadRequest, bindErr.Error(), bindErr.Errors)
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	h.writeError(w, http.StatusBadRequest, err.Error())
 }
 
-func (h *Handler) writeError(w http.ResponseWriter, code int, message string) {
-	h.writeResponse(w, code, message, nil)
+func (h *Handler) writeResponse(w http.ResponseWriter, status, code int, message string, data interface{}) {
+	writeEnvelope(w, status, code, message, data)
 }
 
-func (h *Handler) writeResponse(w http.ResponseWriter, code int, message string, data interface{}) {
+// writeEnvelope 写入平台响应信封，status 为HTTP状态码，code 为业务码，
+// 业务码为0时使用HTTP状态码，成功响应的 message 为空时使用 "success"
+func writeEnvelope(w http.ResponseWriter, status, code int, message string, data interface{}) {
+	if code == 0 {
+		code = status
+	}
+	if message == "" && status < http.StatusBadRequest {
+		message = "success"
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	resp := CommonResponse{
 		Code:    code,
 		Message: message,
@@ -194,48 +271,119 @@ func (h *Handler) writeResponse(w http.ResponseWriter, code int, message string,
 	json.NewEncoder(w).Encode(resp)
 }
 
+// Use 追加中间件，先添加的中间件位于外层，应在启动服务前调用
+func (h *Handler) Use(mw ...Middleware) {
+	h.middlewares = append(h.middlewares, mw...)
+	h.buildChain()
+}
+
+// buildChain 构建处理链：中间件 -> 路由分发，回调认证在路由内层执行
+func (h *Handler) buildChain() {
+	h.chain = chainMiddlewares(http.HandlerFunc(h.dispatch), h.middlewares)
+}
+
 // ServeHTTP 实现 http.Handler 接口
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.logger.Printf("收到请求: %s %s", r.Method, r.URL.Path)
-
-	switch r.URL.Path {
-	case "/api/v1/form/config":
-		h.handleFormConfig(w, r)
-	case "/api/v1/device/disconnect":
-		h.handleDeviceDisconnect(w, r)
-	case "/api/v1/plugin/notification":
-		h.handleNotification(w, r)
-	case "/api/v1/plugin/device/list":
-		h.handleGetDeviceList(w, r)
-	case "/api/v1/plugin/device/info":
-		h.handleGetDeviceInfo(w, r)
-	default:
-		http.NotFound(w, r)
+	if h.chain == nil {
+		h.dispatch(w, r)
+		return
 	}
+	h.chain.ServeHTTP(w, r)
 }
 
 // SetFormConfigHandler 设置表单配置处理函数
 func (h *Handler) SetFormConfigHandler(handler func(req *GetFormConfigRequest) (interface{}, error)) {
+	if handler == nil {
+		h.formConfigHandler = nil
+		return
+	}
+	h.formConfigHandler = func(_ context.Context, req *GetFormConfigRequest) (interface{}, error) {
+		return handler(req)
+	}
+}
+
+// SetFormConfigHandlerWithContext 设置表单配置处理函数，ctx 为请求上下文
+func (h *Handler) SetFormConfigHandlerWithContext(handler func(ctx context.Context, req *GetFormConfigRequest) (interface{}, error)) {
 	h.formConfigHandler = handler
 }
 
 // SetDeviceDisconnectHandler 设置设备断开处理函数
 func (h *Handler) SetDeviceDisconnectHandler(handler func(req *DeviceDisconnectRequest) error) {
+	if handler == nil {
+		h.deviceDisconnectHandler = nil
+		return
+	}
+	h.deviceDisconnectHandler = func(_ context.Context, req *DeviceDisconnectRequest) error {
+		return handler(req)
+	}
+}
+
+// SetDeviceDisconnectHandlerWithContext 设置设备断开处理函数，ctx 为请求上下文
+func (h *Handler) SetDeviceDisconnectHandlerWithContext(handler func(ctx context.Context, req *DeviceDisconnectRequest) error) {
 	h.deviceDisconnectHandler = handler
 }
 
+// AddDisconnectListener 添加设备断开监听器，在断开处理函数成功返回后依次调用，
+// 用于状态管理、网关连接清理等需要感知设备断开的组件；
+// 未设置断开处理函数但添加了监听器时，断开请求同样返回成功
+func (h *Handler) AddDisconnectListener(listener func(ctx context.Context, deviceID string)) {
+	if listener == nil {
+		return
+	}
+	h.listenerMu.Lock()
+	defer h.listenerMu.Unlock()
+	h.disconnectListeners = append(h.disconnectListeners, listener)
+}
+
 // SetNotificationHandler 设置通知处理函数
 func (h *Handler) SetNotificationHandler(handler func(req *NotificationRequest) error) {
+	if handler == nil {
+		h.notificationHandler = nil
+		return
+	}
+	h.notificationHandler = func(_ context.Context, req *NotificationRequest) error {
+		return handler(req)
+	}
+}
+
+// SetNotificationHandlerWithContext 设置通知处理函数，ctx 为请求上下文
+func (h *Handler) SetNotificationHandlerWithContext(handler func(ctx context.Context, req *NotificationRequest) error) {
 	h.notificationHandler = handler
 }
 
 // SetGetDeviceListHandler 设置获取设备列表处理函数
 func (h *Handler) SetGetDeviceListHandler(handler func(req *GetDeviceListRequest) (*DeviceListResponse, error)) {
+	if handler == nil {
+		h.getDeviceListHandler = nil
+		return
+	}
+	h.getDeviceListHandler = func(_ context.Context, req *GetDeviceListRequest) (*DeviceListResponse, error) {
+		return handler(req)
+	}
+}
+
+// SetGetDeviceListHandlerWithContext 设置获取设备列表处理函数，ctx 为请求上下文
+func (h *Handler) SetGetDeviceListHandlerWithContext(handler func(ctx context.Context, req *GetDeviceListRequest) (*DeviceListResponse, error)) {
 	h.getDeviceListHandler = handler
 }
 
-// Start 启动HTTP服务
+// SetGetDeviceInfoHandler 设置通过密钥获取设备信息处理函数
+func (h *Handler) SetGetDeviceInfoHandler(handler func(req *GetDeviceInfoRequest) (*GetDeviceInfoResponse, error)) {
+	if handler == nil {
+		h.getDeviceInfoHandler = nil
+		return
+	}
+	h.getDeviceInfoHandler = func(_ context.Context, req *GetDeviceInfoRequest) (*GetDeviceInfoResponse, error) {
+		return handler(req)
+	}
+}
+
+// SetGetDeviceInfoHandlerWithContext 设置通过密钥获取设备信息处理函数，ctx 为请求上下文
+func (h *Handler) SetGetDeviceInfoHandlerWithContext(handler func(ctx context.Context, req *GetDeviceInfoRequest) (*GetDeviceInfoResponse, error)) {
+	h.getDeviceInfoHandler = handler
+}
+
+// Start 启动HTTP服务，阻塞直到调用 Shutdown
 func (h *Handler) Start(addr string) error {
-	h.logger.Printf("启动HTTP服务: %s", addr)
-	return http.ListenAndServe(addr, h)
+	return h.Serve(context.Background(), addr)
 }
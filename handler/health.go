@@ -0,0 +1,167 @@
+// handler/health.go
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 健康状态
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// 默认检查超时
+const defaultCheckTimeout = 5 * time.Second
+
+// HealthConfig 健康检查接口配置，零值字段使用默认值
+type HealthConfig struct {
+	LivenessPath  string        // 存活探针路径，默认 /healthz
+	ReadinessPath string        // 就绪探针路径，默认 /readyz
+	DebugPath     string        // 诊断信息路径，为空时不开启
+	CheckTimeout  time.Duration // 单个检查超时，默认5秒
+}
+
+// ComponentHealth 单个组件的检查结果
+type ComponentHealth struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// HealthReport 健康检查结果
+type HealthReport struct {
+	Status     string            `json:"status"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Components []ComponentHealth `json:"components,omitempty"`
+}
+
+// healthCheck 已注册的检查
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthRegistry 健康检查与诊断信息注册表
+type healthRegistry struct {
+	mu        sync.RWMutex
+	liveness  []healthCheck
+	readiness []healthCheck
+	debug     map[string]func() interface{}
+}
+
+// AddCheck 添加就绪检查，返回错误表示组件不可用，如 MQTT 未连接
+func (h *Handler) AddCheck(name string, check func(ctx context.Context) error) {
+	h.health.mu.Lock()
+	defer h.health.mu.Unlock()
+	h.health.readiness = append(h.health.readiness, healthCheck{name: name, check: check})
+}
+
+// AddLivenessCheck 添加存活检查，存活检查失败通常意味着进程需要重启
+func (h *Handler) AddLivenessCheck(name string, check func(ctx context.Context) error) {
+	h.health.mu.Lock()
+	defer h.health.mu.Unlock()
+	h.health.liveness = append(h.health.liveness, healthCheck{name: name, check: check})
+}
+
+// AddDebugInfo 添加诊断信息，如订阅列表和队列深度，在诊断接口中以 name 为键输出
+func (h *Handler) AddDebugInfo(name string, info func() interface{}) {
+	h.health.mu.Lock()
+	defer h.health.mu.Unlock()
+	if h.health.debug == nil {
+		h.health.debug = make(map[string]func() interface{})
+	}
+	h.health.debug[name] = info
+}
+
+// EnableHealth 注册存活、就绪和诊断接口，这些接口不经过回调认证
+func (h *Handler) EnableHealth(config HealthConfig) {
+	if config.LivenessPath == "" {
+		config.LivenessPath = "/healthz"
+	}
+	if config.ReadinessPath == "" {
+		config.ReadinessPath = "/readyz"
+	}
+	timeout := durationOr(config.CheckTimeout, defaultCheckTimeout)
+
+	h.HandleFunc(http.MethodGet, config.LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		h.health.mu.RLock()
+		checks := h.health.liveness
+		h.health.mu.RUnlock()
+		writeHealthReport(w, runChecks(r.Context(), checks, timeout))
+	})
+
+	h.HandleFunc(http.MethodGet, config.ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		h.health.mu.RLock()
+		checks := append(append([]healthCheck{}, h.health.liveness...), h.health.readiness...)
+		h.health.mu.RUnlock()
+		writeHealthReport(w, runChecks(r.Context(), checks, timeout))
+	})
+
+	if config.DebugPath != "" {
+		h.HandleFunc(http.MethodGet, config.DebugPath, func(w http.ResponseWriter, r *http.Request) {
+			h.health.mu.RLock()
+			out := make(map[string]interface{}, len(h.health.debug))
+			for name, info := range h.health.debug {
+				out[name] = info()
+			}
+			h.health.mu.RUnlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(out)
+		})
+	}
+}
+
+// runChecks 并发执行检查
+func runChecks(ctx context.Context, checks []healthCheck, timeout time.Duration) HealthReport {
+	report := HealthReport{Status: StatusUp, Timestamp: time.Now()}
+	results := make([]ComponentHealth, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(checkCtx)
+			result := ComponentHealth{Name: c.name, Status: StatusUp, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	for _, r := range results {
+		if r.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	report.Components = results
+	return report
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	status := http.StatusOK
+	if report.Status != StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,257 @@
+// handler/middleware.go
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware HTTP中间件
+type Middleware func(http.Handler) http.Handler
+
+// HeaderRequestID 请求ID头
+const HeaderRequestID = "X-Request-ID"
+
+// chainMiddlewares 按顺序包装处理器，mws[0] 位于最外层
+func chainMiddlewares(h http.Handler, mws []Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// statusWriter 记录响应状态码和字节数
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("ResponseWriter 不支持 Hijack")
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusOrOK 返回响应状态码，未显式写入时为200
+func (w *statusWriter) statusOrOK() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func wrapStatusWriter(w http.ResponseWriter) *statusWriter {
+	if sw, ok := w.(*statusWriter); ok {
+		return sw
+	}
+	return &statusWriter{ResponseWriter: w}
+}
+
+// Recovery 捕获处理过程中的panic，记录堆栈并返回500错误响应，避免连接被直接断开
+func Recovery(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := wrapStatusWriter(w)
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				logger.Printf("处理请求发生panic: %s %s, err=%v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+				if sw.status == 0 {
+					writeEnvelope(sw, http.StatusInternalServerError, 0, "internal server error", nil)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// RequestID 为每个请求分配请求ID，优先沿用请求头中的 X-Request-ID，
+// 并写入响应头和请求上下文，可通过 RequestIDFromContext 获取
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(HeaderRequestID)
+			if id == "" {
+				id = newRequestID()
+			}
+			w.Header().Set(HeaderRequestID, id)
+			ctx := context.WithValue(r.Context(), requestIDKey, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext 获取请求ID，未使用 RequestID 中间件时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLog 记录访问日志，包括状态码、响应大小和耗时
+func AccessLog(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := wrapStatusWriter(w)
+			next.ServeHTTP(sw, r)
+
+			logger.Printf("访问日志: method=%s, path=%s, status=%d, bytes=%d, latency=%v, remote=%s, request_id=%s",
+				r.Method, r.URL.Path, sw.statusOrOK(), sw.bytes, time.Since(start), r.RemoteAddr, RequestIDFromContext(r.Context()))
+		})
+	}
+}
+
+// BodyLimit 限制请求体大小，超过 maxBytes 时返回413
+func BodyLimit(maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeEnvelope(w, http.StatusRequestEntityTooLarge, 0, "request body too large", nil)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	AllowedOrigins   []string      // 允许的来源，"*" 表示全部，为空时允许全部
+	AllowedMethods   []string      // 允许的方法，为空时为 GET、POST、OPTIONS
+	AllowedHeaders   []string      // 允许的请求头，为空时回显预检请求的头
+	ExposedHeaders   []string      // 允许前端读取的响应头
+	AllowCredentials bool          // 是否允许携带凭证
+	MaxAge           time.Duration // 预检结果缓存时间
+}
+
+// CORS 跨域中间件，预检请求直接返回204
+func CORS(config CORSConfig) Middleware {
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	}
+	allowMethods := strings.Join(methods, ", ")
+
+	allowOrigin := func(origin string) string {
+		if len(config.AllowedOrigins) == 0 {
+			if config.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		for _, o := range config.AllowedOrigins {
+			if o == "*" {
+				if config.AllowCredentials {
+					return origin
+				}
+				return "*"
+			}
+			if strings.EqualFold(o, origin) {
+				return origin
+			}
+		}
+		return ""
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			allowed := allowOrigin(origin)
+			if allowed == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			header.Set("Access-Control-Allow-Origin", allowed)
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if len(config.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+			}
+
+			// 预检请求
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				header.Set("Access-Control-Allow-Methods", allowMethods)
+				if len(config.AllowedHeaders) > 0 {
+					header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+				} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", reqHeaders)
+				}
+				if config.MaxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
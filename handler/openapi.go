@@ -0,0 +1,92 @@
+// handler/openapi.go
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/openapi"
+)
+
+// TagCallback 平台回调接口分组
+const TagCallback = "callback"
+
+// DescribeAPI 将回调接口和自定义路由添加到 OpenAPI 文档
+func (h *Handler) DescribeAPI(doc *openapi.Document) {
+	doc.AddTag(TagCallback, "插件提供给ThingsPanel平台的回调接口")
+
+	for _, rt := range h.allRoutes() {
+		spec := openapi.OperationSpec{
+			Method:      rt.method,
+			Path:        rt.path,
+			OperationID: rt.name,
+			Summary:     rt.summary,
+			Query:       rt.query,
+			Body:        rt.body,
+			Response:    rt.response,
+		}
+		if rt.callback {
+			spec.Tags = []string{TagCallback}
+			spec.Errors = callbackErrors(rt)
+		}
+		doc.Add(spec)
+	}
+}
+
+// BindErrorResponse 参数校验失败时的响应信封，data 为字段错误列表，用于文档描述
+type BindErrorResponse struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Data    []FieldError `json:"data"`
+}
+
+// callbackErrors 回调接口可能返回的错误响应，响应体均为 CommonResponse 信封
+func callbackErrors(rt route) []openapi.ErrorSpec {
+	var errs []openapi.ErrorSpec
+	if rt.query != nil || rt.body != nil {
+		errs = append(errs, openapi.ErrorSpec{Status: http.StatusBadRequest,
+			Description: "请求参数缺失或格式错误", Body: BindErrorResponse{}})
+	}
+	errs = append(errs,
+		openapi.ErrorSpec{Status: http.StatusUnauthorized,
+			Description: "回调认证失败，配置 HandlerConfig.Auth 时返回", Body: CommonResponse{}},
+		openapi.ErrorSpec{Status: http.StatusNotFound,
+			Description: "资源不存在，回调返回状态码为404的 *Error 时返回", Body: CommonResponse{}},
+		openapi.ErrorSpec{Status: http.StatusMethodNotAllowed,
+			Description: "请求方法与路由不匹配，Allow 头列出支持的方法", Body: CommonResponse{}},
+	)
+	if rt.body != nil {
+		errs = append(errs, openapi.ErrorSpec{Status: http.StatusRequestEntityTooLarge,
+			Description: "请求体超过 BodyLimit 中间件的限制", Body: CommonResponse{}})
+	}
+	errs = append(errs,
+		openapi.ErrorSpec{Status: http.StatusInternalServerError,
+			Description: "回调处理失败", Body: CommonResponse{}},
+		openapi.ErrorSpec{Status: http.StatusNotImplemented,
+			Description: "未注册对应的回调函数", Body: CommonResponse{}},
+	)
+	return errs
+}
+
+// OpenAPI 生成包含回调接口的 OpenAPI 文档，extra 可追加其他接口，如 client.DescribeAPI
+func (h *Handler) OpenAPI(extra ...func(*openapi.Document)) *openapi.Document {
+	doc := openapi.New("ThingsPanel Protocol Plugin API", "1.0.0")
+	h.DescribeAPI(doc)
+	for _, fn := range extra {
+		fn(doc)
+	}
+	return doc
+}
+
+// EnableDocs 在 path 提供 OpenAPI 文档（JSON），文档在每次请求时根据当前路由生成
+func (h *Handler) EnableDocs(path string, extra ...func(*openapi.Document)) {
+	h.HandleFunc(http.MethodGet, path, func(w http.ResponseWriter, r *http.Request) {
+		data, err := h.OpenAPI(extra...).JSON()
+		if err != nil {
+			h.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
@@ -0,0 +1,99 @@
+// handler/openapi_test.go
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+)
+
+// 解析后的文档，只保留校验需要的字段
+type testDoc struct {
+	Paths map[string]map[string]struct {
+		OperationID string                     `json:"operationId"`
+		Responses   map[string]json.RawMessage `json:"responses"`
+	} `json:"paths"`
+}
+
+// 期望出现在文档中的接口
+type routeCase struct {
+	name   string
+	method string
+	path   string
+	errors []int // 需要描述的错误响应
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	h := NewHandler(HandlerConfig{})
+	data, err := h.OpenAPI(client.DescribeAPI).JSON()
+	if err != nil {
+		t.Fatalf("序列化文档失败: %v", err)
+	}
+	var doc testDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("解析文档失败: %v", err)
+	}
+
+	tests := []routeCase{
+		{"getDeviceConfig", http.MethodPost, client.PathDeviceConfig, nil},
+		{"deviceDynamicAuth", http.MethodPost, client.PathDeviceAuth, nil},
+		{"getDeviceByServiceIdentifier", http.MethodPost, client.PathServiceDevices, nil},
+		{"getServiceAccessList", http.MethodPost, client.PathServiceAccessList, nil},
+		{"getServiceAccess", http.MethodPost, client.PathServiceAccess, nil},
+		{"sendHeartbeat", http.MethodPost, client.PathHeartbeat, nil},
+	}
+	for _, rt := range h.callbackRoutes() {
+		tests = append(tests, routeCase{rt.name, rt.method, rt.path, []int{400, 401, 404, 405, 501}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, ok := doc.Paths[tt.path]
+			if !ok {
+				t.Fatalf("文档缺少路径 %s", tt.path)
+			}
+			op, ok := item[strings.ToLower(tt.method)]
+			if !ok {
+				t.Fatalf("路径 %s 缺少方法 %s", tt.path, tt.method)
+			}
+			if op.OperationID != tt.name {
+				t.Errorf("operationId = %q, 期望 %q", op.OperationID, tt.name)
+			}
+			if len(item) != 1 {
+				t.Errorf("路径 %s 有 %d 个方法, 期望 1", tt.path, len(item))
+			}
+			for _, status := range append([]int{200}, tt.errors...) {
+				if _, ok := op.Responses[strconv.Itoa(status)]; !ok {
+					t.Errorf("缺少 %d 响应", status)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIBindErrorEnvelope(t *testing.T) {
+	doc := NewHandler(HandlerConfig{}).OpenAPI()
+	op := doc.Paths[PathDeviceDisconnect].Post
+	if op == nil {
+		t.Fatalf("文档缺少 %s", PathDeviceDisconnect)
+	}
+	resp := op.Responses["400"]
+	if resp == nil || resp.Content["application/json"] == nil {
+		t.Fatalf("400 响应缺少响应体")
+	}
+	if ref := resp.Content["application/json"].Schema.Ref; ref != "#/components/schemas/handler.BindErrorResponse" {
+		t.Errorf("400 响应体 = %q", ref)
+	}
+	schema := doc.Components.Schemas["handler.BindErrorResponse"]
+	if schema == nil || schema.Properties["data"] == nil || schema.Properties["data"].Items == nil {
+		t.Fatalf("BindErrorResponse 的 data 应为字段错误列表")
+	}
+	if _, ok := op.Responses["413"]; !ok {
+		t.Errorf("带请求体的接口缺少 413 响应")
+	}
+}
@@ -0,0 +1,151 @@
+// handler/routes.go
+
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 平台回调接口路径
+const (
+	PathFormConfig       = "/api/v1/form/config"
+	PathDeviceDisconnect = "/api/v1/device/disconnect"
+	PathNotification     = "/api/v1/plugin/notification"
+	PathDeviceList       = "/api/v1/plugin/device/list"
+	PathDeviceInfo       = "/api/v1/plugin/device/info"
+)
+
+// Route 可挂载的路由
+type Route struct {
+	Name     string       // 路由名称
+	Method   string       // 请求方法
+	Path     string       // 请求路径
+	Callback bool         // 是否为平台回调路由，回调路由受 HandlerConfig.Auth 保护
+	Handler  http.Handler // 已包装中间件和回调认证的处理器
+}
+
+// route 内部路由定义
+type route struct {
+	name     string
+	method   string
+	path     string
+	callback bool
+	handler  http.Handler
+
+	// 以下字段用于生成 OpenAPI 文档
+	summary  string
+	query    interface{}
+	body     interface{}
+	response interface{}
+}
+
+// callbackRoutes 平台回调路由
+func (h *Handler) callbackRoutes() []route {
+	return []route{
+		{name: "form_config", method: http.MethodGet, path: PathFormConfig, callback: true,
+			handler: http.HandlerFunc(h.handleFormConfig), summary: "获取表单配置",
+			query: GetFormConfigRequest{}, response: CommonResponse{}},
+		{name: "device_disconnect", method: http.MethodPost, path: PathDeviceDisconnect, callback: true,
+			handler: http.HandlerFunc(h.handleDeviceDisconnect), summary: "设备断开通知",
+			body: DeviceDisconnectRequest{}, response: CommonResponse{}},
+		{name: "notification", method: http.MethodPost, path: PathNotification, callback: true,
+			handler: http.HandlerFunc(h.handleNotification), summary: "事件通知",
+			body: NotificationRequest{}, response: CommonResponse{}},
+		{name: "device_list", method: http.MethodGet, path: PathDeviceList, callback: true,
+			handler: http.HandlerFunc(h.handleGetDeviceList), summary: "获取设备列表",
+			query: GetDeviceListRequest{}, response: DeviceListResponse{}},
+		{name: "device_info", method: http.MethodGet, path: PathDeviceInfo, callback: true,
+			handler: http.HandlerFunc(h.handleGetDeviceInfo), summary: "通过密钥获取设备信息",
+			query: GetDeviceInfoRequest{}, response: GetDeviceInfoResponse{}},
+	}
+}
+
+// allRoutes 平台回调路由与自定义路由
+func (h *Handler) allRoutes() []route {
+	return append(h.callbackRoutes(), h.routes...)
+}
+
+// Handle 注册自定义路由，与回调接口共用同一服务和中间件，但不经过回调认证，
+// 应在启动服务前调用
+func (h *Handler) Handle(method, path string, handler http.Handler) {
+	h.routes = append(h.routes, route{
+		name:    strings.ToLower(method) + " " + path,
+		method:  method,
+		path:    path,
+		handler: handler,
+	})
+}
+
+// HandleFunc 注册自定义路由处理函数，规则同 Handle
+func (h *Handler) HandleFunc(method, path string, handler http.HandlerFunc) {
+	h.Handle(method, path, handler)
+}
+
+// Routes 返回全部路由，每个路由的 Handler 已包装中间件和回调认证，
+// 可挂载到 gin、echo、chi 等任意路由框架
+func (h *Handler) Routes() []Route {
+	all := h.allRoutes()
+	out := make([]Route, 0, len(all))
+	for _, rt := range all {
+		out = append(out, Route{
+			Name:     rt.name,
+			Method:   rt.method,
+			Path:     rt.path,
+			Callback: rt.callback,
+			Handler:  chainMiddlewares(h.routeHandler(rt), h.middlewares),
+		})
+	}
+	return out
+}
+
+// Mount 将全部路由以 Go 1.22 方法模式（如 "GET /tp/api/v1/form/config"）注册到 mux，
+// prefix 为路径前缀，可为空
+func (h *Handler) Mount(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+	for _, rt := range h.Routes() {
+		mux.Handle(rt.Method+" "+prefix+rt.Path, rt.Handler)
+	}
+}
+
+// routeHandler 为路由附加请求元数据、日志和回调认证
+func (h *Handler) routeHandler(rt route) http.Handler {
+	var next http.Handler = rt.handler
+	if rt.callback && h.auth != nil {
+		next = h.auth(next)
+	}
+	next = h.tracing.traceRoute(rt, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.logger.Printf("收到请求: %s %s", r.Method, r.URL.Path)
+		start := time.Now()
+		sw := wrapStatusWriter(w)
+		next.ServeHTTP(sw, withRequestInfo(r))
+		h.metrics.CallbackRequest(rt.name, sw.statusOrOK(), time.Since(start))
+	})
+}
+
+// dispatch 按方法和路径分发请求
+func (h *Handler) dispatch(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, rt := range h.allRoutes() {
+		if rt.path != r.URL.Path {
+			continue
+		}
+		if rt.method != r.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+		h.routeHandler(rt).ServeHTTP(w, r)
+		return
+	}
+
+	h.logger.Printf("收到请求: %s %s", r.Method, r.URL.Path)
+	if len(allowed) > 0 {
+		h.metrics.CallbackRequest("unmatched", http.StatusMethodNotAllowed, 0)
+		h.writeMethodNotAllowed(w, strings.Join(allowed, ", "))
+		return
+	}
+	h.metrics.CallbackRequest("unmatched", http.StatusNotFound, 0)
+	h.writeError(w, http.StatusNotFound, "not found")
+}
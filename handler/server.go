@@ -0,0 +1,127 @@
+// handler/server.go
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTP服务默认超时
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// ServerConfig HTTP服务配置，零值字段使用默认值
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration // 读取请求头超时，默认10秒
+	ReadTimeout       time.Duration // 读取请求超时，默认30秒
+	WriteTimeout      time.Duration // 写响应超时，默认30秒
+	IdleTimeout       time.Duration // 空闲连接超时，默认120秒
+	ShutdownTimeout   time.Duration // ctx 取消后等待请求处理完成的最长时间，默认30秒
+}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// newServer 按配置创建 http.Server
+func (h *Handler) newServer() *http.Server {
+	cfg := h.serverConfig
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: durationOr(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       durationOr(cfg.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      durationOr(cfg.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       durationOr(cfg.IdleTimeout, defaultIdleTimeout),
+		ErrorLog:          h.logger,
+	}
+}
+
+// Serve 在 addr 上启动HTTP服务，ctx 取消时停止接收新连接并等待处理中的请求完成
+func (h *Handler) Serve(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		h.logger.Printf("监听地址失败: %s, err=%v", addr, err)
+		return fmt.Errorf("监听地址失败: %w", err)
+	}
+	return h.ServeListener(ctx, ln)
+}
+
+// ServeListener 在调用方提供的监听器上启动HTTP服务，行为同 Serve
+func (h *Handler) ServeListener(ctx context.Context, ln net.Listener) error {
+	srv := h.newServer()
+
+	h.mu.Lock()
+	if h.server != nil {
+		h.mu.Unlock()
+		ln.Close()
+		return errors.New("HTTP服务已在运行")
+	}
+	h.server = srv
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		h.server = nil
+		h.mu.Unlock()
+	}()
+
+	h.logger.Printf("启动HTTP服务: %s", ln.Addr())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		h.logger.Printf("HTTP服务异常退出: %v", err)
+		return err
+	case <-ctx.Done():
+		timeout := durationOr(h.serverConfig.ShutdownTimeout, defaultShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		err := h.shutdownServer(shutdownCtx, srv)
+		<-errCh
+		return err
+	}
+}
+
+// Shutdown 优雅关闭HTTP服务，等待处理中的请求完成或 ctx 超时
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	srv := h.server
+	h.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return h.shutdownServer(ctx, srv)
+}
+
+func (h *Handler) shutdownServer(ctx context.Context, srv *http.Server) error {
+	h.logger.Printf("开始关闭HTTP服务")
+	if err := srv.Shutdown(ctx); err != nil {
+		h.logger.Printf("HTTP服务关闭超时，强制关闭: %v", err)
+		srv.Close()
+		return fmt.Errorf("关闭HTTP服务失败: %w", err)
+	}
+	h.logger.Printf("HTTP服务已关闭")
+	return nil
+}
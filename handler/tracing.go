@@ -0,0 +1,69 @@
+// handler/tracing.go
+
+package handler
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName 回调处理器的 Tracer 名称
+const tracerName = "github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// TracerProvider 为空时不产生链路数据
+	TracerProvider trace.TracerProvider
+	// Propagator 为空时使用 W3C Trace Context
+	Propagator propagation.TextMapPropagator
+}
+
+// tracing 回调链路追踪
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracing(config TracingConfig) tracing {
+	tp := config.TracerProvider
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	prop := config.Propagator
+	if prop == nil {
+		prop = propagation.TraceContext{}
+	}
+	return tracing{tracer: tp.Tracer(tracerName), propagator: prop}
+}
+
+// traceRoute 为路由创建服务端span，从请求头提取上游链路上下文
+func (t tracing) traceRoute(rt route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.tracer.Start(ctx, rt.method+" "+rt.path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", rt.path),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+				attribute.String("tp.callback.route", rt.name),
+			),
+		)
+		defer span.End()
+
+		sw := wrapStatusWriter(w)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		status := sw.statusOrOK()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
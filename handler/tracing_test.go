@@ -0,0 +1,103 @@
+// handler/tracing_test.go
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/internal/tracetest"
+)
+
+const (
+	upstreamTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	upstreamSpanID  = "00f067aa0ba902b7"
+)
+
+func TestTracingServerSpan(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   codes.Code
+	}{
+		{"成功", nil, http.StatusOK, codes.Unset},
+		{"回调失败", errors.New("boom"), http.StatusInternalServerError, codes.Error},
+		{"业务错误", NewError(http.StatusNotFound, 0, "not found"), http.StatusNotFound, codes.Unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tracetest.NewRecorder()
+			h := NewHandler(HandlerConfig{Tracing: TracingConfig{TracerProvider: rec}})
+			var handlerSpan trace.SpanContext
+			h.SetDeviceDisconnectHandlerWithContext(func(ctx context.Context, req *DeviceDisconnectRequest) error {
+				handlerSpan = trace.SpanContextFromContext(ctx)
+				return tt.err
+			})
+
+			req := httptest.NewRequest(http.MethodPost, PathDeviceDisconnect, strings.NewReader(`{"device_id":"d1"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("traceparent", "00-"+upstreamTraceID+"-"+upstreamSpanID+"-01")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("状态码 = %d, 期望 %d", w.Code, tt.status)
+			}
+
+			spans := rec.SpansByKind(trace.SpanKindServer)
+			if len(spans) != 1 {
+				t.Fatalf("服务端span数量 = %d, 期望 1", len(spans))
+			}
+			s := spans[0]
+			if s.Name != http.MethodPost+" "+PathDeviceDisconnect {
+				t.Errorf("span名称 = %q", s.Name)
+			}
+			if s.Parent.TraceID().String() != upstreamTraceID || s.Parent.SpanID().String() != upstreamSpanID || !s.Parent.IsRemote() {
+				t.Errorf("父span = %v, 期望从 traceparent 提取", s.Parent)
+			}
+			if s.SpanContext.TraceID().String() != upstreamTraceID {
+				t.Errorf("TraceID = %s, 期望沿用上游", s.SpanContext.TraceID())
+			}
+			if handlerSpan.SpanID() != s.SpanContext.SpanID() {
+				t.Errorf("回调函数的 ctx 未携带服务端span")
+			}
+			if got := s.Attribute("tp.callback.route").AsString(); got != "device_disconnect" {
+				t.Errorf("tp.callback.route = %q", got)
+			}
+			if got := s.Attribute("http.response.status_code").AsInt64(); got != int64(tt.status) {
+				t.Errorf("http.response.status_code = %d, 期望 %d", got, tt.status)
+			}
+			if s.Status != tt.code {
+				t.Errorf("span状态 = %v, 期望 %v", s.Status, tt.code)
+			}
+		})
+	}
+}
+
+func TestTracingCustomRoute(t *testing.T) {
+	rec := tracetest.NewRecorder()
+	h := NewHandler(HandlerConfig{Tracing: TracingConfig{TracerProvider: rec}})
+	h.HandleFunc(http.MethodGet, "/custom", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/custom", nil))
+
+	spans := rec.SpansByKind(trace.SpanKindServer)
+	if len(spans) != 1 {
+		t.Fatalf("服务端span数量 = %d, 期望 1", len(spans))
+	}
+	if spans[0].Parent.IsValid() {
+		t.Errorf("没有 traceparent 时应为根span")
+	}
+	if got := spans[0].Attribute("http.response.status_code").AsInt64(); got != http.StatusNoContent {
+		t.Errorf("http.response.status_code = %d", got)
+	}
+}
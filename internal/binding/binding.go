@@ -0,0 +1,508 @@
+// internal/binding/binding.go
+
+// Package binding 提供基于反射的弱类型赋值与 binding 标签校验，
+// 供 types 配置解码和 handler 请求绑定共用
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError 单个字段的错误
+type FieldError struct {
+	Field   string // 字段路径，如 points[0].address
+	Message string // 错误描述
+}
+
+// Rules binding 标签解析结果，如 binding:"required,min=1,max=65535,oneof=tcp udp"
+type Rules struct {
+	Required bool
+	Min      *float64
+	Max      *float64
+	OneOf    []string
+}
+
+// ParseRules 解析 binding 标签
+func ParseRules(tag string) (Rules, error) {
+	var r Rules
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "omitempty" {
+			continue
+		}
+		key, val, _ := strings.Cut(part, "=")
+		switch key {
+		case "required":
+			r.Required = true
+		case "min", "max":
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return r, fmt.Errorf("无效的%s规则: %s", key, val)
+			}
+			if key == "min" {
+				r.Min = &f
+			} else {
+				r.Max = &f
+			}
+		case "oneof":
+			r.OneOf = strings.Fields(val)
+		default:
+			return r, fmt.Errorf("不支持的校验规则: %s", key)
+		}
+	}
+	return r, nil
+}
+
+// Check 对已赋值的字段执行范围与枚举校验，返回空字符串表示通过
+func (r Rules) Check(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	var (
+		n     float64
+		label string
+	)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, label = float64(v.Int()), "值"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, label = float64(v.Uint()), "值"
+	case reflect.Float32, reflect.Float64:
+		n, label = v.Float(), "值"
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		n, label = float64(v.Len()), "长度"
+	default:
+		return ""
+	}
+	if r.Min != nil && n < *r.Min {
+		return fmt.Sprintf("%s %v 小于最小值 %v", label, n, *r.Min)
+	}
+	if r.Max != nil && n > *r.Max {
+		return fmt.Sprintf("%s %v 大于最大值 %v", label, n, *r.Max)
+	}
+
+	if len(r.OneOf) > 0 {
+		s := fmt.Sprint(v.Interface())
+		for _, opt := range r.OneOf {
+			if s == opt {
+				return ""
+			}
+		}
+		return fmt.Sprintf("值 %s 不在可选范围 [%s] 内", s, strings.Join(r.OneOf, " "))
+	}
+	return ""
+}
+
+// FieldName 返回字段在指定标签下的名称，第二个返回值为 false 表示忽略该字段
+func FieldName(f reflect.StructField, tag string) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+	name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+// IsEmpty 判断原始值是否视为缺失
+func IsEmpty(src interface{}) bool {
+	if src == nil {
+		return true
+	}
+	if s, ok := src.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+	return false
+}
+
+// DecodeMap 将 map 按 tag 标签解码到结构体 out（必须为结构体指针），
+// 支持 default 默认值标签与 binding 校验标签，返回全部字段错误
+func DecodeMap(m map[string]interface{}, out interface{}, tag string) []FieldError {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return []FieldError{{Field: "", Message: "解码目标必须为非空指针"}}
+	}
+	var errs []FieldError
+	decodeStruct(m, rv.Elem(), "", tag, &errs)
+	return errs
+}
+
+func decodeStruct(m map[string]interface{}, rv reflect.Value, prefix, tag string, errs *[]FieldError) {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		if err := SetValue(rv, m); err != nil {
+			*errs = append(*errs, FieldError{Field: prefix, Message: err.Error()})
+		}
+		return
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		// 匿名嵌入且未命名的结构体字段展开到同一层
+		if sf.Anonymous && sf.Tag.Get(tag) == "" && indirectType(sf.Type).Kind() == reflect.Struct {
+			decodeStruct(m, fv, prefix, tag, errs)
+			continue
+		}
+
+		name, ok := FieldName(sf, tag)
+		if !ok || !fv.CanSet() {
+			continue
+		}
+		path := joinPath(prefix, name)
+
+		rules, err := ParseRules(sf.Tag.Get("binding"))
+		if err != nil {
+			*errs = append(*errs, FieldError{Field: path, Message: err.Error()})
+			continue
+		}
+
+		src, present := m[name]
+		if !present || IsEmpty(src) {
+			if def, hasDefault := sf.Tag.Lookup("default"); hasDefault {
+				src, present = def, true
+			} else if rules.Required {
+				*errs = append(*errs, FieldError{Field: path, Message: "必填字段缺失"})
+				continue
+			} else {
+				continue
+			}
+		}
+
+		if err := setValue(fv, src, path, tag, errs); err != nil {
+			*errs = append(*errs, FieldError{Field: path, Message: err.Error()})
+			continue
+		}
+		if msg := rules.Check(fv); msg != "" {
+			*errs = append(*errs, FieldError{Field: path, Message: msg})
+		}
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// SetValue 将任意原始值弱类型转换后赋给 dst
+// 数字可来自 float64、json.Number 或字符串，布尔可来自字符串或数字，
+// time.Duration 支持 "5s" 形式或以秒为单位的数字
+func SetValue(dst reflect.Value, src interface{}) error {
+	var errs []FieldError
+	if err := setValue(dst, src, "", "json", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message)
+	}
+	return nil
+}
+
+func setValue(dst reflect.Value, src interface{}, path, tag string, errs *[]FieldError) error {
+	if src == nil {
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return setValue(dst.Elem(), src, path, tag, errs)
+	}
+
+	if dst.Type() == durationType {
+		d, err := toDuration(src)
+		if err != nil {
+			return err
+		}
+		dst.SetInt(int64(d))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(src))
+	case reflect.String:
+		s, err := toString(src)
+		if err != nil {
+			return err
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		b, err := toBool(src)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt(src)
+		if err == errOverflow || (err == nil && dst.OverflowInt(n)) {
+			return fmt.Errorf("值 %v 超出类型 %s 的范围", src, dst.Type())
+		}
+		if err != nil {
+			return err
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toUint(src)
+		if err == errOverflow || (err == nil && dst.OverflowUint(n)) {
+			return fmt.Errorf("值 %v 超出类型 %s 的范围", src, dst.Type())
+		}
+		if err != nil {
+			return err
+		}
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowFloat(f) {
+			return fmt.Errorf("值 %v 超出类型 %s 的范围", src, dst.Type())
+		}
+		dst.SetFloat(f)
+	case reflect.Struct:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("期望对象，实际为 %T", src)
+		}
+		decodeStruct(m, dst, path, tag, errs)
+	case reflect.Slice:
+		items, ok := src.([]interface{})
+		if !ok {
+			if s, isStr := src.(string); isStr && dst.Type().Elem().Kind() == reflect.Uint8 {
+				dst.SetBytes([]byte(s))
+				return nil
+			}
+			// 单个值视为只有一个元素的切片
+			items = []interface{}{src}
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if err := setValue(slice.Index(i), item, itemPath, tag, errs); err != nil {
+				*errs = append(*errs, FieldError{Field: itemPath, Message: err.Error()})
+			}
+		}
+		dst.Set(slice)
+	case reflect.Map:
+		m, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("期望对象，实际为 %T", src)
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, item := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			itemPath := joinPath(path, k)
+			if err := setValue(elem, item, itemPath, tag, errs); err != nil {
+				*errs = append(*errs, FieldError{Field: itemPath, Message: err.Error()})
+				continue
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(out)
+	default:
+		return fmt.Errorf("不支持的字段类型 %s", dst.Type())
+	}
+	return nil
+}
+
+func toString(src interface{}) (string, error) {
+	switch v := src.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool, int, int64, int32, uint, uint64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("期望字符串，实际为 %T", src)
+	}
+}
+
+// errOverflow 整数超出 64 位范围，由调用方补充目标类型
+var errOverflow = errors.New("整数超出范围")
+
+// toInt 将原始值转换为 int64，整数形式的字符串和 json.Number 直接按整数解析，
+// 避免经过 float64 丢失 2^53 以上的精度
+func toInt(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case uint:
+		return toInt(uint64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, errOverflow
+		}
+		return int64(v), nil
+	case json.Number, string:
+		s := strings.TrimSpace(fmt.Sprint(v))
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err == nil {
+			return n, nil
+		}
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, errOverflow
+		}
+	}
+
+	f, err := toFloat(src)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("值 %v 不是整数", src)
+	}
+	// -2^63 可精确表示，2^63 已超出 int64
+	if f < math.MinInt64 || f >= -math.MinInt64 {
+		return 0, errOverflow
+	}
+	return int64(f), nil
+}
+
+// toUint 将原始值转换为 uint64，规则同 toInt
+func toUint(src interface{}) (uint64, error) {
+	switch v := src.(type) {
+	case int:
+		return toUint(int64(v))
+	case int32:
+		return toUint(int64(v))
+	case int64:
+		if v < 0 {
+			return 0, fmt.Errorf("值 %v 不是非负整数", src)
+		}
+		return uint64(v), nil
+	case uint:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case json.Number, string:
+		s := strings.TrimSpace(fmt.Sprint(v))
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err == nil {
+			return n, nil
+		}
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, errOverflow
+		}
+	}
+
+	f, err := toFloat(src)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) || f < 0 {
+		return 0, fmt.Errorf("值 %v 不是非负整数", src)
+	}
+	if f >= math.MaxUint64 {
+		return 0, errOverflow
+	}
+	return uint64(f), nil
+}
+
+func toFloat(src interface{}) (float64, error) {
+	switch v := src.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		return strconv.ParseFloat(v.String(), 64)
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("值 %q 不是有效数字", v)
+		}
+		return f, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("期望数字，实际为 %T", src)
+	}
+}
+
+func toBool(src interface{}) (bool, error) {
+	switch v := src.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("值 %q 不是有效布尔值", v)
+		}
+		return b, nil
+	default:
+		f, err := toFloat(src)
+		if err != nil {
+			return false, fmt.Errorf("期望布尔值，实际为 %T", src)
+		}
+		return f != 0, nil
+	}
+}
+
+func toDuration(src interface{}) (time.Duration, error) {
+	if s, ok := src.(string); ok {
+		s = strings.TrimSpace(s)
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+	}
+	f, err := toFloat(src)
+	if err != nil {
+		return 0, fmt.Errorf("值 %v 不是有效时长", src)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
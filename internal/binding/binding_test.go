@@ -0,0 +1,114 @@
+// internal/binding/binding_test.go
+
+package binding
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetValueInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		dst     interface{}
+		src     interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"float64", new(int), 42.0, 42, ""},
+		{"字符串", new(int), " 7 ", 7, ""},
+		{"科学计数法字符串", new(int), "1e3", 1000, ""},
+		{"json.Number 大整数", new(int64), json.Number("9007199254740993"), int64(9007199254740993), ""},
+		{"字符串大整数", new(int64), "9223372036854775807", int64(9223372036854775807), ""},
+		{"最小值", new(int64), "-9223372036854775808", int64(-9223372036854775808), ""},
+		{"uint64 大整数", new(uint64), json.Number("18446744073709551615"), uint64(18446744073709551615), ""},
+		{"布尔", new(uint8), true, uint8(1), ""},
+		{"小数", new(int), 1.5, nil, "不是整数"},
+		{"小数字符串", new(int), "1.5", nil, "不是整数"},
+		{"负数赋给无符号", new(uint), -1.0, nil, "不是非负整数"},
+		{"负数字符串赋给无符号", new(uint), "-1", nil, "不是非负整数"},
+		{"超出 int8", new(int8), 128.0, nil, "超出类型"},
+		{"超出 int64 的浮点数", new(int64), 1e30, nil, "超出类型"},
+		{"2^63", new(int64), 9223372036854775808.0, nil, "超出类型"},
+		{"超出 int64 的字符串", new(int64), "9223372036854775808", nil, "超出类型"},
+		{"超出 uint64 的浮点数", new(uint64), 1e30, nil, "超出类型"},
+		{"超出 uint64 的 json.Number", new(uint64), json.Number("18446744073709551616"), nil, "超出类型"},
+		{"uint64 超出 int64", new(int64), uint64(1 << 63), nil, "超出类型"},
+		{"无效字符串", new(int), "abc", nil, "不是有效数字"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := reflect.ValueOf(tt.dst).Elem()
+			err := SetValue(dst, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, 期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dst.Interface(); got != tt.want {
+				t.Errorf("结果 = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetValueDuration(t *testing.T) {
+	var d time.Duration
+	dst := reflect.ValueOf(&d).Elem()
+	for src, want := range map[interface{}]time.Duration{"5s": 5 * time.Second, 1.5: 1500 * time.Millisecond, "2": 2 * time.Second} {
+		if err := SetValue(dst, src); err != nil || d != want {
+			t.Errorf("SetValue(%v) = %v, %v, 期望 %v", src, d, err, want)
+		}
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	type point struct {
+		Name    string `json:"name" binding:"required"`
+		Address uint16 `json:"address"`
+	}
+	type config struct {
+		Host    string  `json:"host" binding:"required"`
+		Port    int     `json:"port" default:"502" binding:"min=1,max=65535"`
+		Mode    string  `json:"mode" default:"tcp" binding:"oneof=tcp udp"`
+		ID      int64   `json:"id"`
+		Points  []point `json:"points"`
+		Enabled *bool   `json:"enabled"`
+	}
+
+	var m map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(`{"host":"h","id":9007199254740993,"points":[{"name":"a","address":1}],"enabled":"true"}`))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	var c config
+	if errs := DecodeMap(m, &c, "json"); len(errs) > 0 {
+		t.Fatalf("解码错误: %v", errs)
+	}
+	if c.Port != 502 || c.Mode != "tcp" || c.ID != 9007199254740993 || len(c.Points) != 1 || c.Points[0].Address != 1 || c.Enabled == nil || !*c.Enabled {
+		t.Errorf("解码结果 = %+v", c)
+	}
+
+	errs := DecodeMap(map[string]interface{}{
+		"port":   70000.0,
+		"mode":   "rtu",
+		"points": []interface{}{map[string]interface{}{"address": 1e30}},
+	}, &config{}, "json")
+	got := map[string]bool{}
+	for _, e := range errs {
+		got[e.Field] = true
+	}
+	for _, field := range []string{"host", "port", "mode", "points[0].name", "points[0].address"} {
+		if !got[field] {
+			t.Errorf("缺少字段 %s 的错误, 实际 %v", field, errs)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// internal/tracetest/recorder.go
+
+// Package tracetest 提供记录span的最小 TracerProvider，供测试检查生成的链路数据，
+// 只依赖 OpenTelemetry 的 trace API，不引入 SDK
+package tracetest
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// Span 已结束的span
+type Span struct {
+	Name        string
+	Kind        trace.SpanKind
+	SpanContext trace.SpanContext
+	Parent      trace.SpanContext // 父span，根span时无效
+	Attributes  []attribute.KeyValue
+	Status      codes.Code
+}
+
+// Attribute 返回属性值，不存在时返回空值
+func (s Span) Attribute(key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// Recorder 记录span的 TracerProvider，span 在 End 时记录
+type Recorder struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewRecorder 创建 Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Tracer 实现 trace.TracerProvider
+func (r *Recorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &tracer{recorder: r}
+}
+
+// Spans 返回已结束的span，按结束顺序排列
+func (r *Recorder) Spans() []Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Span(nil), r.spans...)
+}
+
+// SpansByKind 返回指定类型的已结束span
+func (r *Recorder) SpansByKind(kind trace.SpanKind) []Span {
+	var out []Span
+	for _, s := range r.Spans() {
+		if s.Kind == kind {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (r *Recorder) record(s Span) {
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+}
+
+type tracer struct {
+	embedded.Tracer
+	recorder *Recorder
+}
+
+// Start 创建span，ctx 中有有效的span上下文时沿用其 TraceID 作为子span
+func (t *tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	parent := trace.SpanContextFromContext(ctx)
+	if cfg.NewRoot() {
+		parent = trace.SpanContext{}
+	}
+
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		rand.Read(traceID[:])
+	}
+	var spanID trace.SpanID
+	rand.Read(spanID[:])
+
+	s := &span{
+		recorder: t.recorder,
+		data: Span{
+			Name: name,
+			Kind: cfg.SpanKind(),
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    traceID,
+				SpanID:     spanID,
+				TraceFlags: trace.FlagsSampled,
+			}),
+			Parent:     parent,
+			Attributes: cfg.Attributes(),
+		},
+	}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	embedded.Span
+	recorder *Recorder
+
+	mu    sync.Mutex
+	data  Span
+	ended bool
+}
+
+func (s *span) End(...trace.SpanEndOption) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := s.data
+	data.Attributes = append([]attribute.KeyValue(nil), s.data.Attributes...)
+	s.mu.Unlock()
+	s.recorder.record(data)
+}
+
+func (s *span) AddEvent(string, ...trace.EventOption) {}
+
+func (s *span) AddLink(trace.Link) {}
+
+func (s *span) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.ended
+}
+
+func (s *span) RecordError(error, ...trace.EventOption) {}
+
+func (s *span) SpanContext() trace.SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetStatus(code codes.Code, _ string) {
+	s.mu.Lock()
+	s.data.Status = code
+	s.mu.Unlock()
+}
+
+func (s *span) SetName(name string) {
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+func (s *span) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, kv...)
+	s.mu.Unlock()
+}
+
+func (s *span) TracerProvider() trace.TracerProvider {
+	return s.recorder
+}
@@ -0,0 +1,85 @@
+// metrics/metrics.go
+
+// Package metrics 定义SDK的指标记录接口，client 和 handler 通过它上报
+// API请求、MQTT消息、回调请求和心跳等指标，prommetrics 子包提供 Prometheus 实现
+package metrics
+
+import (
+	"strings"
+	"time"
+)
+
+// Recorder 指标记录接口，实现需并发安全
+type Recorder interface {
+	// APIRequest 平台API请求，endpoint 为接口名称（未知接口为 EndpointOther），status 为0表示请求未得到响应
+	APIRequest(method, endpoint string, status int, duration time.Duration)
+	// MQTTPublish MQTT发布，err 非空表示发布失败
+	MQTTPublish(topicClass string, err error)
+	// MQTTSubscribe MQTT订阅，err 非空表示订阅失败
+	MQTTSubscribe(topicClass string, err error)
+	// MQTTDelivery 收到订阅消息
+	MQTTDelivery(topicClass string)
+	// MQTTConnectionLost MQTT连接丢失
+	MQTTConnectionLost()
+	// MQTTReconnect MQTT重连成功
+	MQTTReconnect()
+	// CallbackRequest 平台回调请求，route 为路由名称
+	CallbackRequest(route string, status int, duration time.Duration)
+	// Heartbeat 服务心跳，err 非空表示心跳失败
+	Heartbeat(err error)
+}
+
+// Nop 不记录任何指标
+type Nop struct{}
+
+func (Nop) APIRequest(string, string, int, time.Duration) {}
+func (Nop) MQTTPublish(string, error)                     {}
+func (Nop) MQTTSubscribe(string, error)                   {}
+func (Nop) MQTTDelivery(string)                           {}
+func (Nop) MQTTConnectionLost()                           {}
+func (Nop) MQTTReconnect()                                {}
+func (Nop) CallbackRequest(string, int, time.Duration)    {}
+func (Nop) Heartbeat(error)                               {}
+
+// OrNop 为空时返回 Nop
+func OrNop(r Recorder) Recorder {
+	if r == nil {
+		return Nop{}
+	}
+	return r
+}
+
+// EndpointOther 不在SDK已知平台接口中的API请求，调用方传入的任意路径都归入该类，避免标签基数无限增长
+const EndpointOther = "other"
+
+// 主题分类
+const (
+	TopicTelemetry  = "telemetry"
+	TopicAttributes = "attributes"
+	TopicEvent      = "event"
+	TopicCommand    = "command"
+	TopicStatus     = "status"
+	TopicOTA        = "ota"
+	TopicOther      = "other"
+)
+
+// TopicClass 将MQTT主题归类，避免以设备ID等高基数主题作为指标标签
+func TopicClass(topic string) string {
+	for _, seg := range strings.Split(topic, "/") {
+		switch seg {
+		case "telemetry":
+			return TopicTelemetry
+		case "attributes":
+			return TopicAttributes
+		case "event", "events":
+			return TopicEvent
+		case "command", "commands":
+			return TopicCommand
+		case "status":
+			return TopicStatus
+		case "ota":
+			return TopicOTA
+		}
+	}
+	return TopicOther
+}
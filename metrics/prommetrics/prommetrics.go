@@ -0,0 +1,178 @@
+// metrics/prommetrics/prommetrics.go
+
+// Package prommetrics 提供基于 Prometheus 的 metrics.Recorder 实现
+package prommetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/metrics"
+)
+
+// 默认指标命名空间
+const defaultNamespace = "tp_sdk"
+
+// Recorder Prometheus 指标记录器
+type Recorder struct {
+	gatherer prometheus.Gatherer
+
+	apiRequests      *prometheus.CounterVec
+	apiLatency       *prometheus.HistogramVec
+	mqttPublishes    *prometheus.CounterVec
+	mqttSubscribes   *prometheus.CounterVec
+	mqttDeliveries   *prometheus.CounterVec
+	mqttConnLost     prometheus.Counter
+	mqttReconnects   prometheus.Counter
+	callbackRequests *prometheus.CounterVec
+	callbackLatency  *prometheus.HistogramVec
+	heartbeats       *prometheus.CounterVec
+}
+
+var _ metrics.Recorder = (*Recorder)(nil)
+
+// Options 记录器配置
+type Options struct {
+	Namespace string // 指标命名空间，默认 tp_sdk
+	// Registerer 注册指标，为空时新建独立注册表，也可传入 prometheus.DefaultRegisterer
+	// 或 prometheus.WrapRegistererWith 包装后的注册器
+	Registerer prometheus.Registerer
+	// Gatherer Handler 采集指标的来源，为空时 Registerer 实现了 Gatherer（如 *prometheus.Registry）则使用它，
+	// 否则使用 prometheus.DefaultGatherer
+	Gatherer prometheus.Gatherer
+	Buckets  []float64 // 耗时直方图桶，默认 prometheus.DefBuckets
+}
+
+// New 创建 Prometheus 指标记录器
+func New(opts Options) *Recorder {
+	ns := opts.Namespace
+	if ns == "" {
+		ns = defaultNamespace
+	}
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+	gatherer := opts.Gatherer
+	if gatherer == nil {
+		if g, ok := reg.(prometheus.Gatherer); ok {
+			gatherer = g
+		} else {
+			gatherer = prometheus.DefaultGatherer
+		}
+	}
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	r := &Recorder{
+		gatherer: gatherer,
+		apiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "api", Name: "requests_total",
+			Help: "平台API请求数",
+		}, []string{"method", "endpoint", "status"}),
+		apiLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Subsystem: "api", Name: "request_duration_seconds",
+			Help: "平台API请求耗时", Buckets: buckets,
+		}, []string{"method", "endpoint"}),
+		mqttPublishes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "mqtt", Name: "publishes_total",
+			Help: "MQTT发布数",
+		}, []string{"topic_class", "result"}),
+		mqttSubscribes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "mqtt", Name: "subscribes_total",
+			Help: "MQTT订阅数",
+		}, []string{"topic_class", "result"}),
+		mqttDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "mqtt", Name: "deliveries_total",
+			Help: "收到的MQTT订阅消息数",
+		}, []string{"topic_class"}),
+		mqttConnLost: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "mqtt", Name: "connection_lost_total",
+			Help: "MQTT连接丢失次数",
+		}),
+		mqttReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "mqtt", Name: "reconnects_total",
+			Help: "MQTT重连成功次数",
+		}),
+		callbackRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "callback", Name: "requests_total",
+			Help: "平台回调请求数",
+		}, []string{"route", "status"}),
+		callbackLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Subsystem: "callback", Name: "request_duration_seconds",
+			Help: "平台回调请求耗时", Buckets: buckets,
+		}, []string{"route"}),
+		heartbeats: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "heartbeat", Name: "total",
+			Help: "服务心跳次数",
+		}, []string{"result"}),
+	}
+
+	reg.MustRegister(
+		r.apiRequests, r.apiLatency,
+		r.mqttPublishes, r.mqttSubscribes, r.mqttDeliveries, r.mqttConnLost, r.mqttReconnects,
+		r.callbackRequests, r.callbackLatency,
+		r.heartbeats,
+	)
+	return r
+}
+
+// Handler 返回 /metrics 接口处理器
+func (r *Recorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.gatherer, promhttp.HandlerOpts{})
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// APIRequest 实现 metrics.Recorder
+func (r *Recorder) APIRequest(method, endpoint string, status int, duration time.Duration) {
+	r.apiRequests.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	r.apiLatency.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+}
+
+// MQTTPublish 实现 metrics.Recorder
+func (r *Recorder) MQTTPublish(topicClass string, err error) {
+	r.mqttPublishes.WithLabelValues(topicClass, result(err)).Inc()
+}
+
+// MQTTSubscribe 实现 metrics.Recorder
+func (r *Recorder) MQTTSubscribe(topicClass string, err error) {
+	r.mqttSubscribes.WithLabelValues(topicClass, result(err)).Inc()
+}
+
+// MQTTDelivery 实现 metrics.Recorder
+func (r *Recorder) MQTTDelivery(topicClass string) {
+	r.mqttDeliveries.WithLabelValues(topicClass).Inc()
+}
+
+// MQTTConnectionLost 实现 metrics.Recorder
+func (r *Recorder) MQTTConnectionLost() {
+	r.mqttConnLost.Inc()
+}
+
+// MQTTReconnect 实现 metrics.Recorder
+func (r *Recorder) MQTTReconnect() {
+	r.mqttReconnects.Inc()
+}
+
+// CallbackRequest 实现 metrics.Recorder
+func (r *Recorder) CallbackRequest(route string, status int, duration time.Duration) {
+	r.callbackRequests.WithLabelValues(route, strconv.Itoa(status)).Inc()
+	r.callbackLatency.WithLabelValues(route).Observe(duration.Seconds())
+}
+
+// Heartbeat 实现 metrics.Recorder
+func (r *Recorder) Heartbeat(err error) {
+	r.heartbeats.WithLabelValues(result(err)).Inc()
+}
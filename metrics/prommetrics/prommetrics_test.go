@@ -0,0 +1,64 @@
+// metrics/prommetrics/prommetrics_test.go
+
+package prommetrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrape 请求指标接口并返回文本
+func scrape(t *testing.T, r *Recorder) string {
+	t.Helper()
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestRecorder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"独立注册表", Options{}, []string{
+			`tp_sdk_api_requests_total{endpoint="device_config",method="POST",status="200"} 1`,
+			`tp_sdk_heartbeat_total{result="failure"} 1`,
+		}},
+		{"包装的注册器和采集器", Options{
+			Namespace:  "plugin",
+			Registerer: prometheus.WrapRegistererWith(prometheus.Labels{"service": "modbus"}, reg),
+			Gatherer:   reg,
+		}, []string{
+			`plugin_api_requests_total{endpoint="device_config",method="POST",service="modbus",status="200"} 1`,
+			`plugin_heartbeat_total{result="failure",service="modbus"} 1`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.opts)
+			r.APIRequest(http.MethodPost, "device_config", http.StatusOK, time.Millisecond)
+			r.Heartbeat(errors.New("timeout"))
+			body := scrape(t, r)
+			for _, line := range tt.want {
+				if !strings.Contains(body, line) {
+					t.Errorf("指标中缺少 %s\n%s", line, body)
+				}
+			}
+		})
+	}
+}
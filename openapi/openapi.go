@@ -0,0 +1,361 @@
+// openapi/openapi.go
+
+// Package openapi 根据Go请求/响应类型生成 OpenAPI 3 文档，
+// handler 和 client 分别用它描述回调接口和平台接口
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version OpenAPI 规范版本
+const Version = "3.0.3"
+
+// Document OpenAPI 文档
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info 文档信息
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server 服务地址
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag 接口分组
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components 可复用组件
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// PathItem 路径下的各方法操作
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+}
+
+// Operation 接口操作
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter 参数
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody 请求体
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response 响应
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType 内容类型
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema 数据结构
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// OperationSpec 以Go类型描述一个接口，由 Document.Add 转换为 OpenAPI 操作
+type OperationSpec struct {
+	Method      string      // 请求方法
+	Path        string      // 请求路径
+	OperationID string      // 操作ID
+	Summary     string      // 摘要
+	Description string      // 描述
+	Tags        []string    // 分组
+	Query       interface{} // 查询参数结构体，字段使用 form 标签
+	Body        interface{} // JSON请求体
+	Response    interface{} // 成功响应体
+	Errors      []ErrorSpec // 错误响应
+}
+
+// ErrorSpec 以Go类型描述一个错误响应
+type ErrorSpec struct {
+	Status      int         // HTTP状态码
+	Description string      // 描述
+	Body        interface{} // 响应体
+}
+
+// New 创建文档
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version},
+		Paths:      make(map[string]*PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+}
+
+// AddTag 添加接口分组，同名分组只保留一个
+func (d *Document) AddTag(name, description string) {
+	for _, t := range d.Tags {
+		if t.Name == name {
+			return
+		}
+	}
+	d.Tags = append(d.Tags, Tag{Name: name, Description: description})
+}
+
+// Add 添加接口，请求和响应类型会注册到 components.schemas
+func (d *Document) Add(spec OperationSpec) {
+	op := &Operation{
+		OperationID: spec.OperationID,
+		Summary:     spec.Summary,
+		Description: spec.Description,
+		Tags:        spec.Tags,
+		Responses:   make(map[string]*Response),
+	}
+
+	if spec.Query != nil {
+		op.Parameters = d.queryParameters(reflect.TypeOf(spec.Query))
+	}
+	if spec.Body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: d.SchemaOf(spec.Body)}},
+		}
+	}
+
+	ok := &Response{Description: "成功"}
+	if spec.Response != nil {
+		ok.Content = map[string]*MediaType{"application/json": {Schema: d.SchemaOf(spec.Response)}}
+	}
+	op.Responses["200"] = ok
+	for _, e := range spec.Errors {
+		resp := &Response{Description: e.Description}
+		if e.Body != nil {
+			resp.Content = map[string]*MediaType{"application/json": {Schema: d.SchemaOf(e.Body)}}
+		}
+		op.Responses[strconv.Itoa(e.Status)] = resp
+	}
+
+	item := d.Paths[spec.Path]
+	if item == nil {
+		item = &PathItem{}
+		d.Paths[spec.Path] = item
+	}
+	switch strings.ToUpper(spec.Method) {
+	case "GET":
+		item.Get = op
+	case "POST":
+		item.Post = op
+	case "PUT":
+		item.Put = op
+	case "DELETE":
+		item.Delete = op
+	case "PATCH":
+		item.Patch = op
+	}
+}
+
+// JSON 序列化文档
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// SchemaOf 返回值对应的 Schema，命名结构体注册为组件并返回引用
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaFor(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time", Nullable: nullable}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean", Nullable: nullable}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Nullable: nullable}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32", Nullable: nullable}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float", Nullable: nullable}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double", Nullable: nullable}
+	case reflect.String:
+		return &Schema{Type: "string", Nullable: nullable}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: nullable}
+		}
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem()), Nullable: nullable}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaFor(t.Elem()), Nullable: nullable}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// 先占位，避免自引用类型无限递归
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{} 等任意类型
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.collectFields(t, s)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (d *Document) collectFields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			d.collectFields(ft, s)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := d.schemaFor(f.Type)
+		if desc := f.Tag.Get("description"); desc != "" && prop.Ref == "" {
+			prop.Description = desc
+		}
+		s.Properties[name] = prop
+		if isRequired(f) && !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// queryParameters 根据 form 标签生成查询参数
+func (d *Document) queryParameters(t reflect.Type) []*Parameter {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var params []*Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		params = append(params, &Parameter{
+			Name:     name,
+			In:       "query",
+			Required: isRequired(f),
+			Schema:   d.schemaFor(f.Type),
+		})
+	}
+	return params
+}
+
+func isRequired(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// componentName 组件名使用 包名.类型名，避免不同包的同名类型冲突
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name := t.Name()
+	// 泛型类型名中含有方括号等字符，替换为合法字符
+	name = strings.NewReplacer("[", "_", "]", "", "/", "_", "*", "", ",", "_", " ", "").Replace(name)
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
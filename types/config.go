@@ -0,0 +1,102 @@
+// types/config.go
+
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/internal/binding"
+)
+
+// ConfigFieldError 配置字段错误
+type ConfigFieldError struct {
+	Field   string `json:"field"`   // 字段路径，如 points[0].address
+	Message string `json:"message"` // 错误描述
+}
+
+// ConfigError 设备配置解码错误，包含出错设备和全部字段错误
+type ConfigError struct {
+	DeviceID     string             `json:"device_id"`
+	DeviceNumber string             `json:"device_number"`
+	Errors       []ConfigFieldError `json:"errors"`
+}
+
+// Error 实现 error 接口
+func (e *ConfigError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return fmt.Sprintf("设备配置无效(device_id=%s, device_number=%s): %s",
+		e.DeviceID, e.DeviceNumber, strings.Join(parts, "; "))
+}
+
+// MergeConfig 合并模板配置与设备配置，设备配置中的同名字段覆盖模板默认值，
+// 嵌套对象逐层合并，返回新的map，不修改入参
+func MergeConfig(template, config map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(template)+len(config))
+	for k, v := range template {
+		merged[k] = v
+	}
+	for k, v := range config {
+		base, baseIsMap := merged[k].(map[string]interface{})
+		override, overrideIsMap := v.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[k] = MergeConfig(base, override)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// MergedConfig 返回模板配置与设备配置合并后的视图
+func (d Device) MergedConfig() map[string]interface{} {
+	return MergeConfig(d.ProtocolConfigTemplate, d.Config)
+}
+
+// MergedConfig 返回模板配置与子设备配置合并后的视图
+func (s SubDevice) MergedConfig() map[string]interface{} {
+	return MergeConfig(s.ProtocolConfigTemplate, s.Config)
+}
+
+// DecodeConfig 将设备的合并配置解码为类型 T
+//
+// 字段名取自 json 标签，支持以下标签：
+//   - default:"502"                      字段缺失时的默认值
+//   - binding:"required,min=1,max=65535" 必填与范围校验（字符串和切片校验长度）
+//   - binding:"oneof=tcp udp"            枚举校验
+//
+// 数字可来自 JSON 数字或字符串，嵌套对象和数组会递归解码，
+// 出错时返回 *ConfigError，列出设备信息和所有出错字段
+func DecodeConfig[T any](dev Device) (T, error) {
+	return decodeConfig[T](dev.MergedConfig(), dev.ID, dev.DeviceNumber)
+}
+
+// DecodeSubDeviceConfig 将子设备的合并配置解码为类型 T，规则同 DecodeConfig
+func DecodeSubDeviceConfig[T any](sub SubDevice) (T, error) {
+	return decodeConfig[T](sub.MergedConfig(), sub.DeviceID, sub.DeviceNumber)
+}
+
+// DecodeConfigMap 将任意配置map解码为类型 T，规则同 DecodeConfig
+func DecodeConfigMap[T any](m map[string]interface{}) (T, error) {
+	return decodeConfig[T](m, "", "")
+}
+
+func decodeConfig[T any](m map[string]interface{}, deviceID, deviceNumber string) (T, error) {
+	var out T
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	errs := binding.DecodeMap(m, &out, "json")
+	if len(errs) == 0 {
+		return out, nil
+	}
+
+	cfgErr := &ConfigError{DeviceID: deviceID, DeviceNumber: deviceNumber}
+	for _, fe := range errs {
+		cfgErr.Errors = append(cfgErr.Errors, ConfigFieldError{Field: fe.Field, Message: fe.Message})
+	}
+	return out, cfgErr
+}
@@ -0,0 +1,243 @@
+// types/voucher.go
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// VoucherType 凭证类型
+type VoucherType string
+
+const (
+	VoucherTypeUsername    VoucherType = "username"     // 仅用户名，如 {"username":"..."}
+	VoucherTypeBasic       VoucherType = "basic"        // 用户名密码，如 {"username":"...","password":"..."}
+	VoucherTypeAccessToken VoucherType = "access_token" // 访问令牌，如 {"access_token":"..."}
+	VoucherTypeForm        VoucherType = "form"         // 服务接入点表单字段，任意键值
+)
+
+// 凭证中平台约定的字段名
+const (
+	voucherKeyUsername    = "username"
+	voucherKeyPassword    = "password"
+	voucherKeyAccessToken = "access_token"
+)
+
+// Voucher 设备或服务接入点凭证
+// 平台下发的凭证是JSON字符串，Voucher 负责解析、构造以及还原为平台格式
+type Voucher struct {
+	Type        VoucherType
+	Username    string
+	Password    string
+	AccessToken string
+	// Fields 凭证中的全部原始字段（服务接入点表单字段也在这里）
+	// username、password、access_token 以上面的类型化字段为准，字段为空时不输出
+	Fields map[string]interface{}
+}
+
+// ParseVoucher 解析平台凭证字符串
+func ParseVoucher(raw string) (*Voucher, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("凭证为空")
+	}
+
+	fields := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("解析凭证失败: %w", err)
+	}
+
+	v := newVoucher(fields)
+	v.Type = detectVoucherType(fields)
+	return v, nil
+}
+
+// newVoucher 从原始字段创建凭证并填充类型化字段
+func newVoucher(fields map[string]interface{}) *Voucher {
+	v := &Voucher{Fields: fields}
+	v.Username, _ = stringField(fields, voucherKeyUsername)
+	v.Password, _ = stringField(fields, voucherKeyPassword)
+	v.AccessToken, _ = stringField(fields, voucherKeyAccessToken)
+	return v
+}
+
+// MustParseVoucher 解析凭证，失败时panic，适用于常量或测试数据
+func MustParseVoucher(raw string) *Voucher {
+	v, err := ParseVoucher(raw)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// NewUsernameVoucher 创建仅包含用户名的凭证
+func NewUsernameVoucher(username string) *Voucher {
+	return &Voucher{Type: VoucherTypeUsername, Username: username}
+}
+
+// NewBasicVoucher 创建用户名密码凭证
+func NewBasicVoucher(username, password string) *Voucher {
+	return &Voucher{Type: VoucherTypeBasic, Username: username, Password: password}
+}
+
+// NewAccessTokenVoucher 创建访问令牌凭证
+func NewAccessTokenVoucher(token string) *Voucher {
+	return &Voucher{Type: VoucherTypeAccessToken, AccessToken: token}
+}
+
+// NewFormVoucher 创建服务接入点表单凭证
+func NewFormVoucher(fields map[string]interface{}) *Voucher {
+	copied := make(map[string]interface{}, len(fields))
+	for k, val := range fields {
+		copied[k] = val
+	}
+	v := newVoucher(copied)
+	v.Type = VoucherTypeForm
+	return v
+}
+
+// detectVoucherType 根据字段推断凭证类型
+func detectVoucherType(fields map[string]interface{}) VoucherType {
+	_, hasUser := fields[voucherKeyUsername]
+	_, hasPass := fields[voucherKeyPassword]
+	_, hasToken := fields[voucherKeyAccessToken]
+
+	switch {
+	case hasUser && hasPass && len(fields) == 2:
+		return VoucherTypeBasic
+	case hasUser && len(fields) == 1:
+		return VoucherTypeUsername
+	case hasToken && len(fields) == 1:
+		return VoucherTypeAccessToken
+	default:
+		return VoucherTypeForm
+	}
+}
+
+// stringField 读取字符串字段，数字等标量转为字符串
+func stringField(fields map[string]interface{}, key string) (string, bool) {
+	val, ok := fields[key]
+	if !ok || val == nil {
+		return "", false
+	}
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case json.Number, bool, float64, int, int64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+// Get 获取凭证字段的字符串值
+func (v *Voucher) Get(key string) string {
+	switch key {
+	case voucherKeyUsername:
+		return v.Username
+	case voucherKeyPassword:
+		return v.Password
+	case voucherKeyAccessToken:
+		return v.AccessToken
+	}
+	s, _ := stringField(v.Fields, key)
+	return s
+}
+
+// Decode 将凭证字段解码到结构体，适用于服务接入点表单凭证
+func (v *Voucher) Decode(out interface{}) error {
+	data, err := json.Marshal(v.toMap())
+	if err != nil {
+		return fmt.Errorf("序列化凭证失败: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解码凭证失败: %w", err)
+	}
+	return nil
+}
+
+// MQTTCredentials 返回用于MQTT连接的用户名和密码
+// 访问令牌凭证以令牌作为用户名，密码为空
+func (v *Voucher) MQTTCredentials() (username, password string) {
+	switch v.Type {
+	case VoucherTypeAccessToken:
+		return v.AccessToken, ""
+	default:
+		return v.Get(voucherKeyUsername), v.Get(voucherKeyPassword)
+	}
+}
+
+// toMap 合并原始字段与类型化字段，类型化字段修改或清空后覆盖原始字段
+func (v *Voucher) toMap() map[string]interface{} {
+	out := make(map[string]interface{}, len(v.Fields)+3)
+	for k, val := range v.Fields {
+		out[k] = val
+	}
+	for key, val := range map[string]string{
+		voucherKeyUsername:    v.Username,
+		voucherKeyPassword:    v.Password,
+		voucherKeyAccessToken: v.AccessToken,
+	} {
+		switch old, _ := stringField(out, key); {
+		case val == "":
+			delete(out, key)
+		case val != old:
+			out[key] = val
+		}
+		// 未修改时保留原始值，如数字类型的用户名
+	}
+	return out
+}
+
+// String 还原为平台凭证字符串格式
+func (v *Voucher) String() string {
+	data, err := json.Marshal(v.toMap())
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// MarshalJSON 序列化为平台凭证对象
+func (v *Voucher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.toMap())
+}
+
+// UnmarshalJSON 支持从凭证对象或凭证字符串反序列化
+func (v *Voucher) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		raw = s
+	}
+	parsed, err := ParseVoucher(raw)
+	if err != nil {
+		return err
+	}
+	*v = *parsed
+	return nil
+}
+
+// ParseVoucher 解析设备凭证
+func (d Device) ParseVoucher() (*Voucher, error) {
+	return ParseVoucher(d.Voucher)
+}
+
+// ParseVoucher 解析子设备凭证
+func (s SubDevice) ParseVoucher() (*Voucher, error) {
+	return ParseVoucher(s.Voucher)
+}
+
+// ParseVoucher 解析服务接入点凭证
+func (s ServiceAccess) ParseVoucher() (*Voucher, error) {
+	return ParseVoucher(s.Voucher)
+}
+
+// ParseVoucher 解析动态认证返回的凭证
+func (d DeviceDynamicAuthData) ParseVoucher() (*Voucher, error) {
+	return ParseVoucher(d.Voucher)
+}
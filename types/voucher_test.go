@@ -0,0 +1,93 @@
+// types/voucher_test.go
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVoucherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		mutate func(v *Voucher)
+		want   string
+	}{
+		{"未修改", `{"username":"u","password":"p"}`, func(v *Voucher) {}, `{"password":"p","username":"u"}`},
+		{"数字用户名保持原样", `{"username":123}`, func(v *Voucher) {}, `{"username":123}`},
+		{"清空密码", `{"username":"u","password":"secret"}`, func(v *Voucher) { v.Password = "" }, `{"username":"u"}`},
+		{"清空令牌", `{"access_token":"secret","extra":1}`, func(v *Voucher) { v.AccessToken = "" }, `{"extra":1}`},
+		{"修改令牌", `{"access_token":"old"}`, func(v *Voucher) { v.AccessToken = "new" }, `{"access_token":"new"}`},
+		{"新增密码", `{"username":"u"}`, func(v *Voucher) { v.Password = "p" }, `{"password":"p","username":"u"}`},
+		{"表单字段", `{"host":"h","port":1883}`, func(v *Voucher) { v.Fields["host"] = "h2" }, `{"host":"h2","port":1883}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ParseVoucher(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.mutate(v)
+			if got := v.String(); got != tt.want {
+				t.Errorf("String() = %s, 期望 %s", got, tt.want)
+			}
+			data, err := json.Marshal(v)
+			if err != nil || string(data) != tt.want {
+				t.Errorf("MarshalJSON = %s, %v, 期望 %s", data, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoucherGetAfterClear(t *testing.T) {
+	v := MustParseVoucher(`{"username":"u","password":"secret"}`)
+	v.Password = ""
+	if p := v.Get("password"); p != "" {
+		t.Errorf("清空后 Get(password) = %q", p)
+	}
+	if u, p := v.MQTTCredentials(); u != "u" || p != "" {
+		t.Errorf("MQTTCredentials() = %q, %q", u, p)
+	}
+}
+
+func TestParseVoucherType(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want VoucherType
+	}{
+		{`{"username":"u"}`, VoucherTypeUsername},
+		{`{"username":"u","password":"p"}`, VoucherTypeBasic},
+		{`{"access_token":"t"}`, VoucherTypeAccessToken},
+		{`{"username":"u","host":"h"}`, VoucherTypeForm},
+	}
+	for _, tt := range tests {
+		if v := MustParseVoucher(tt.raw); v.Type != tt.want {
+			t.Errorf("ParseVoucher(%s).Type = %s, 期望 %s", tt.raw, v.Type, tt.want)
+		}
+	}
+	if _, err := ParseVoucher(" "); err == nil {
+		t.Error("空凭证应返回错误")
+	}
+}
+
+func TestNewFormVoucher(t *testing.T) {
+	fields := map[string]interface{}{"username": "u", "host": "h"}
+	v := NewFormVoucher(fields)
+	fields["host"] = "changed"
+	if v.Get("username") != "u" || v.Get("host") != "h" {
+		t.Errorf("表单凭证字段 = %v", v.Fields)
+	}
+	var out struct {
+		Username string `json:"username"`
+		Host     string `json:"host"`
+	}
+	if err := v.Decode(&out); err != nil || out.Username != "u" || out.Host != "h" {
+		t.Errorf("Decode = %+v, %v", out, err)
+	}
+
+	var back Voucher
+	if err := json.Unmarshal([]byte(`"{\"username\":\"u\"}"`), &back); err != nil || back.Type != VoucherTypeUsername {
+		t.Errorf("从凭证字符串反序列化 = %+v, %v", back, err)
+	}
+}